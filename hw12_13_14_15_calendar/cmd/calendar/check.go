@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+)
+
+// checkConfig runs "config check": it validates the config file and prints the effective config
+// with secrets masked. It returns the exit code.
+func checkConfig(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: calendar config check [--config=path]")
+		return 2
+	}
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	file := flags.String("config", configFile, "Path to configuration file")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	config, err := NewConfig(*file)
+	if err != nil {
+		var validationErr *internalconfig.ValidationError
+		if !errors.As(err, &validationErr) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "config %q is invalid:\n", *file)
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		return 1
+	}
+	if err := internalconfig.Print(os.Stdout, config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -1,54 +1,95 @@
 package main
 
 import (
-	"fmt"
-	"strings"
+	"time"
 
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/caldav"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
 	internalgrpc "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/server/http"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storagebuilder"
-	"github.com/spf13/viper"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/webhook"
 )
 
-const envConfigPrefix = "$env:"
-
 type Config struct {
-	HTTPServer internalhttp.Config
-	GrpcServer internalgrpc.Config
-	Logger     logger.Config
-	Storage    storagebuilder.Config
+	HTTPServer  internalhttp.Config
+	GrpcServer  internalgrpc.Config
+	Logger      logger.Config
+	Storage     storagebuilder.Config
+	RateLimit   ratelimit.Config
+	Lifecycle   lifecycle.Config
+	Idempotency IdempotencyConfig
+	Attachments AttachmentsConfig
+	CaldavSync  caldav.SyncConfig
+	Webhooks    webhook.Config
 }
 
-func NewConfig(configFile string) (Config, error) {
-	config := Config{}
-	viper.SetConfigFile(configFile)
+type IdempotencyConfig struct {
+	// Window is how long repeated creation requests with the same idempotency key get the original result.
+	Window time.Duration
+}
 
-	viper.SetDefault("httpServer.host", "127.0.0.1")
-	viper.SetDefault("httpServer.port", "8005")
-	viper.SetDefault("grpcServer.host", "127.0.0.1")
-	viper.SetDefault("grpcServer.port", "8006")
-	viper.SetDefault("logger.level", "WARN")
-	viper.SetDefault("storage.storageType", "memory")
+type AttachmentsConfig struct {
+	Enabled bool
+	// Dir keeps the content of the attachments, the scheduler deletes it from the same directory.
+	Dir string
+	// MaxSize is the most bytes of a single attachment.
+	MaxSize int
+}
 
-	err := viper.ReadInConfig()
-	if err != nil {
-		return config, fmt.Errorf("failed to read config %q: %w", configFile, err)
-	}
-	keys := viper.AllKeys()
-	for _, key := range keys {
-		env := viper.GetString(key)
-		if strings.HasPrefix(env, envConfigPrefix) {
-			err := viper.BindEnv(key, env[len(envConfigPrefix):])
-			if err != nil {
-				return Config{}, fmt.Errorf("failed to prepare config: %w", err)
-			}
-		}
+// NewConfig loads and validates the config file.
+func NewConfig(configFile string) (Config, error) {
+	config := Config{}
+	defaults := map[string]interface{}{
+		"httpServer.host":           "127.0.0.1",
+		"httpServer.port":           8005,
+		"grpcServer.host":           "127.0.0.1",
+		"grpcServer.port":           8006,
+		"logger.level":              "WARN",
+		"lifecycle.shutdownTimeout": "10s",
+		"storage.storageType":       storagebuilder.MemoryStorage,
+		"rateLimit.enabled":         false,
+		"rateLimit.rate":            10,
+		"rateLimit.burst":           20,
+		"idempotency.window":        app.DefaultIdempotencyWindow.String(),
+		"attachments.enabled":       false,
+		"attachments.dir":           "./attachments",
+		"attachments.maxSize":       app.DefaultMaxAttachmentSize,
+		"caldavSync.interval":       "5m",
+		"caldavSync.timeout":        "30s",
+		"webhooks.enabled":          false,
+		"webhooks.pollInterval":     "5s",
+		"webhooks.timeout":          "10s",
+		"webhooks.batchSize":        100,
+		"webhooks.maxAttempts":      8,
+		"webhooks.minBackoff":       "30s",
+		"webhooks.maxBackoff":       "1h",
+		"webhooks.disableAfter":     20,
+		"webhooks.logRetention":     "168h",
 	}
+	err := internalconfig.Load(configFile, defaults, &config)
+	return config, err
+}
 
-	err = viper.Unmarshal(&config)
-	if err != nil {
-		return config, fmt.Errorf("unable to decode into config struct: %w", err)
+// Validate reports all the problems of the config at once.
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Check("httpServer", c.HTTPServer.Validate())
+	v.Check("grpcServer", c.GrpcServer.Validate())
+	v.Check("logger", c.Logger.Validate())
+	v.Check("storage", c.Storage.Validate())
+	v.Check("rateLimit", c.RateLimit.Validate())
+	v.Check("lifecycle", c.Lifecycle.Validate())
+	v.Duration("idempotency.window", c.Idempotency.Window)
+	if c.Attachments.Enabled {
+		v.Required("attachments.dir", c.Attachments.Dir)
+		v.Positive("attachments.maxSize", c.Attachments.MaxSize)
 	}
-	return config, nil
+	v.Check("caldavSync", c.CaldavSync.Validate())
+	v.Check("webhooks", c.Webhooks.Validate())
+	return v.Err()
 }
@@ -3,16 +3,26 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	// Quick-add takes the time zones of the clients, the runtime image has no zone database.
+	_ "time/tzdata"
 
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	localblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/local"
+	memoryblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/memory"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/caldav"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
 	internalgrpc "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/server/http"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storagebuilder"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/webhook"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,6 +42,9 @@ func main() {
 		printVersion()
 		return
 	}
+	if flag.Arg(0) == "config" {
+		os.Exit(checkConfig(flag.Args()[1:]))
+	}
 
 	config, err := NewConfig(configFile)
 	if err != nil {
@@ -49,48 +62,82 @@ func main() {
 		return
 	}
 
-	calendar := app.New(stor)
-	httpServer := internalhttp.NewServer(config.HTTPServer, calendar)
-	grpcServer := internalgrpc.NewServer(config.GrpcServer, calendar)
-
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-	defer cancel()
-
-	go func() {
-		<-ctx.Done()
-
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
-		if err := grpcServer.Stop(ctx); err != nil {
-			log.Errorf("failed to stop grpc server: %v", err)
+	guard, err := webhook.NewGuard(config.Webhooks.AllowedNetworks)
+	if err != nil {
+		log.Errorf("failed to start %v", err)
+		return
+	}
+	opts := []app.Option{app.WithIdempotencyWindow(config.Idempotency.Window), app.WithWebhookGuard(guard)}
+	if config.Attachments.Enabled {
+		blobs, err := localblob.New(config.Attachments.Dir)
+		if err != nil {
+			log.Errorf("failed to start %v", err)
+			return
 		}
+		opts = append(opts, app.WithAttachments(blobs, int64(config.Attachments.MaxSize)))
+	}
+	calendar := app.New(stor, opts...)
+	// Both servers share the limiter, so a client has a single quota for all the APIs.
+	limiter := ratelimit.New(config.RateLimit)
+	httpServer := internalhttp.NewServer(config.HTTPServer, calendar, limiter)
+	grpcServer := internalgrpc.NewServer(config.GrpcServer, calendar, limiter)
 
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
-		if err := httpServer.Stop(ctx); err != nil {
-			log.Errorf("failed to stop http server: %v", err)
-		}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
-		err := stor.Close(ctx)
+	group := lifecycle.New(config.Lifecycle)
+	group.Add("storage", nil, stor.Close)
+	group.Add("change listener", calendar.ListenChanges, nil)
+	group.Add("idempotency keys purger", calendar.PurgeIdempotencyKeys, nil)
+	group.Add("grpc server", grpcServer.Start, grpcServer.Stop)
+	group.Add("http server", httpServer.Start, httpServer.Stop)
+	if config.CaldavSync.URL != "" {
+		syncer, err := newSyncer(calendar, config.CaldavSync)
 		if err != nil {
-			log.Errorf("failec to close storage: %v", err)
+			log.Errorf("failed to start %v", err)
+			return
 		}
-	}()
+		group.Add("caldav sync", syncer.Run, nil)
+	}
+	if config.Webhooks.Enabled {
+		worker := webhook.NewWorker(stor, &http.Client{}, config.Webhooks, webhook.WithGuard(guard))
+		group.Add("webhook worker", worker.Run, nil)
+	}
+	group.Add("config watcher", func(ctx context.Context) error {
+		return internalconfig.Watch(ctx, configFile, func() { reload(limiter) })
+	}, nil)
 
 	log.Info("calendar is running...")
+	if err := group.Run(ctx); err != nil {
+		log.Errorf("calendar stopped: %v", err)
+		os.Exit(1)
+	}
+}
 
-	go func() {
-		err = grpcServer.Start(ctx)
-		if err != nil {
-			cancel()
-			return
+func newSyncer(calendar *app.App, config caldav.SyncConfig) (*caldav.Syncer, error) {
+	client, err := caldav.NewClient(&http.Client{Timeout: config.Timeout}, config.URL, config.Username, config.Password)
+	if err != nil {
+		return nil, err
+	}
+	var states blob.Store = memoryblob.New()
+	if config.StateDir != "" {
+		if states, err = localblob.New(config.StateDir); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	return caldav.NewSyncer(calendar, client, states, config), nil
+}
 
-	if err := httpServer.Start(ctx); err != nil {
-		log.Error("failed to start http server: " + err.Error())
-		cancel()
+// reload applies the settings which can be changed without a restart, an invalid config is rejected.
+func reload(limiter *ratelimit.Limiter) {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Errorf("failed to reload config, the current one is kept: %v", err)
+		return
+	}
+	if err := logger.PrepareLogger(config.Logger); err != nil {
+		log.Errorf("failed to reload logger config: %v", err)
 	}
+	limiter.Update(config.RateLimit)
+	log.Info("config reloaded")
 }
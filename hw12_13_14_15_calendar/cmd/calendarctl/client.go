@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// actorMetadata identifies the user on whose behalf the call is made.
+const actorMetadata = "x-user-id"
+
+// withClient connects to the server and calls f with a context bounded by the timeout of the config.
+func withClient(f func(ctx context.Context, client api.EventsClient) error) error {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		return err
+	}
+	creds := insecure.NewCredentials()
+	if config.TLS.Enabled {
+		tlsConfig, err := config.TLS.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load tls config: %w", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(config.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", config.Address, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	if config.UserID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, actorMetadata, config.UserID)
+	}
+	return f(ctx, api.NewEventsClient(conn))
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// maxRangeDays bounds --from and --to, the range is requested day by day.
+	maxRangeDays = 366
+)
+
+// timeLayouts are accepted for event times, times without a zone are local.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", dateLayout}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid time %q, expected YYYY-MM-DD[ HH:MM] or RFC 3339", ErrUsage, value)
+}
+
+// parseDate parses a day of the calendar, days are in UTC like on the server.
+func parseDate(value string) (time.Time, error) {
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q, expected YYYY-MM-DD", ErrUsage, value)
+	}
+	return t, nil
+}
+
+// stringsFlag collects the values of a repeated flag, a value may list several items separated by commas.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
+
+// eventFlags are the flags of the event fields, the mask paths are the names of the set fields.
+type eventFlags struct {
+	title         string
+	start         string
+	end           string
+	duration      time.Duration
+	description   string
+	owner         string
+	notifyBefore  int
+	tags          stringsFlag
+	color         string
+	location      string
+	geo           string
+	conferenceURL string
+	allDay        bool
+}
+
+var maskPaths = map[string]string{
+	"title":          "title",
+	"start":          "startTime",
+	"end":            "endTime",
+	"duration":       "endTime",
+	"description":    "description",
+	"owner":          "ownerId",
+	"notify-before":  "notifyBefore",
+	"tag":            "tags",
+	"color":          "color",
+	"location":       "location",
+	"geo":            "location",
+	"conference-url": "conferenceUrl",
+	"all-day":        "allDay",
+}
+
+func (f *eventFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.title, "title", "", "Title of the event")
+	fs.StringVar(&f.start, "start", "", "Start time of the event")
+	fs.StringVar(&f.end, "end", "", "End time of the event")
+	fs.DurationVar(&f.duration, "duration", 0, "Duration of the event, sets the end time")
+	fs.StringVar(&f.description, "description", "", "Description of the event")
+	fs.StringVar(&f.owner, "owner", "", "Owner of the event")
+	fs.IntVar(&f.notifyBefore, "notify-before", 0, "Notify before the event starts")
+	fs.Var(&f.tags, "tag", "Tag of the event, may be repeated")
+	fs.StringVar(&f.color, "color", "", "Color of the event in the #rrggbb notation")
+	fs.StringVar(&f.location, "location", "", "Location of the event, --location and --geo replace both")
+	fs.StringVar(&f.geo, "geo", "", "Coordinates of the location as LATITUDE,LONGITUDE")
+	fs.StringVar(&f.conferenceURL, "conference-url", "", "Conferencing URL of the event")
+	fs.BoolVar(&f.allDay, "all-day", false, "Take whole days from the date of --start to the date of --end inclusive")
+}
+
+// asDate returns the date of the local time as a UTC midnight, the way the server takes all-day dates.
+func asDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// parseGeo parses coordinates given as LATITUDE,LONGITUDE.
+func parseGeo(value string) (*api.GeoPoint, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) == 2 {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if latErr == nil && lonErr == nil {
+			return &api.GeoPoint{Latitude: latitude, Longitude: longitude}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid coordinates %q, expected LATITUDE,LONGITUDE", ErrUsage, value)
+}
+
+func (f eventFlags) event() (*api.Event, error) {
+	e := &api.Event{
+		Title:         f.title,
+		Description:   f.description,
+		OwnerId:       f.owner,
+		NotifyBefore:  int32(f.notifyBefore),
+		Tags:          f.tags,
+		Color:         f.color,
+		Location:      &api.Location{Name: f.location},
+		ConferenceUrl: f.conferenceURL,
+		AllDay:        f.allDay,
+	}
+	if f.geo != "" {
+		geo, err := parseGeo(f.geo)
+		if err != nil {
+			return nil, err
+		}
+		e.Location.Geo = geo
+	}
+	if f.start != "" {
+		start, err := parseTime(f.start)
+		if err != nil {
+			return nil, err
+		}
+		if f.allDay {
+			start = asDate(start)
+		}
+		e.StartTime = timestamppb.New(start)
+	}
+	switch {
+	case f.duration != 0 && f.end != "":
+		return nil, fmt.Errorf("%w: --end and --duration are exclusive", ErrUsage)
+	case f.duration != 0:
+		if e.StartTime == nil {
+			return nil, fmt.Errorf("%w: --duration requires --start", ErrUsage)
+		}
+		e.EndTime = timestamppb.New(e.StartTime.AsTime().Add(f.duration))
+	case f.end != "":
+		end, err := parseTime(f.end)
+		if err != nil {
+			return nil, err
+		}
+		if f.allDay {
+			end = asDate(end).AddDate(0, 0, 1)
+		}
+		e.EndTime = timestamppb.New(end)
+	}
+	return e, nil
+}
+
+func addCommand(args []string) error {
+	fs := newFlagSet("add")
+	var flags eventFlags
+	flags.register(fs)
+	id := fs.String("id", "", "ID of the event, the server generates one when it is empty")
+	if err := parseOptions(fs, args); err != nil {
+		return err
+	}
+	if flags.title == "" || flags.start == "" || (flags.end == "" && flags.duration == 0 && !flags.allDay) {
+		return fmt.Errorf("%w: --title, --start and --end or --duration or --all-day are required", ErrUsage)
+	}
+	e, err := flags.event()
+	if err != nil {
+		return err
+	}
+	e.Id = *id
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.AddEvent(ctx, &api.AddEventRequest{Event: e})
+		if err != nil {
+			return err
+		}
+		return printEvents(os.Stdout, outputFormat, []event{fromAPIEvent(resp.GetEvent())}, true)
+	})
+}
+
+// quickCommand creates the event described by the text, like "Lunch with Anna tomorrow 13:00-14:00 remind 1d".
+func quickCommand(args []string) error {
+	fs := newFlagSet("quick")
+	owner := fs.String("owner", "", "Owner of the event")
+	timeZone := fs.String("tz", os.Getenv("TZ"), "IANA time zone of the text, UTC when empty")
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("%w: no event text", ErrUsage)
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.QuickAddEvent(ctx, &api.QuickAddEventRequest{
+			Text: strings.Join(words, " "), OwnerId: *owner, TimeZone: *timeZone,
+		})
+		if err != nil {
+			return err
+		}
+		return printEvents(os.Stdout, outputFormat, []event{fromAPIEvent(resp.GetEvent())}, true)
+	})
+}
+
+func updateCommand(args []string) error {
+	fs := newFlagSet("update")
+	var flags eventFlags
+	flags.register(fs)
+	version := fs.Int64("version", 0, "Expected version of the event, 0 skips the check")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("%w: update takes a single event ID", ErrUsage)
+	}
+	e, err := flags.event()
+	if err != nil {
+		return err
+	}
+	// Only the given fields are updated.
+	mask := &fieldmaskpb.FieldMask{}
+	fs.Visit(func(f *flag.Flag) {
+		if path, ok := maskPaths[f.Name]; ok {
+			mask.Paths = append(mask.Paths, path)
+		}
+	})
+	if len(mask.Paths) == 0 {
+		return fmt.Errorf("%w: nothing to update", ErrUsage)
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.UpdateEvent(ctx, &api.UpdateEventRequest{
+			Id: ids[0], Event: e, Version: *version, UpdateMask: mask,
+		})
+		if err != nil {
+			return err
+		}
+		return printEvents(os.Stdout, outputFormat, []event{fromAPIEvent(resp.GetEvent())}, true)
+	})
+}
+
+func removeCommand(args []string) error {
+	fs := newFlagSet("rm")
+	version := fs.Int64("version", 0, "Expected version of the event, 0 skips the check")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: no event ID", ErrUsage)
+	}
+	if len(ids) > 1 && *version != 0 {
+		return fmt.Errorf("%w: --version is allowed for a single event only", ErrUsage)
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		for _, id := range ids {
+			if _, err := client.RemoveEvent(ctx, &api.RemoveEventRequest{Id: id, Version: *version}); err != nil {
+				return fmt.Errorf("failed to remove event %q: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+func getCommand(args []string) error {
+	fs := newFlagSet("get")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: no event ID", ErrUsage)
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		events := make([]event, 0, len(ids))
+		for _, id := range ids {
+			resp, err := client.GetEvent(ctx, &api.GetEventRequest{Id: id})
+			if err != nil {
+				return fmt.Errorf("failed to get event %q: %w", id, err)
+			}
+			events = append(events, fromAPIEvent(resp.GetEvent()))
+		}
+		return printEvents(os.Stdout, outputFormat, events, len(ids) == 1)
+	})
+}
+
+// rangeFlags select the events to list, the current day is listed by default.
+type rangeFlags struct {
+	day   string
+	week  string
+	month string
+	from  string
+	to    string
+	tags  stringsFlag
+}
+
+func (f *rangeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.day, "day", "", "List events of the day")
+	fs.StringVar(&f.week, "week", "", "List events of the week of the date")
+	fs.StringVar(&f.month, "month", "", "List events of the month of the date")
+	fs.StringVar(&f.from, "from", "", "List events from the date")
+	fs.StringVar(&f.to, "to", "", "List events to the date inclusive")
+	fs.Var(&f.tags, "tag", "List events having the tag, may be repeated")
+}
+
+// list requests the events of the selected range.
+func (f *rangeFlags) list(ctx context.Context, client api.EventsClient) ([]event, error) {
+	set := 0
+	for _, value := range []string{f.day, f.week, f.month, f.from + f.to} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("%w: --day, --week, --month and --from/--to are exclusive", ErrUsage)
+	}
+	switch {
+	case f.week != "":
+		date, err := parseDate(f.week)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.GetEventsForWeek(ctx, &api.GetEventsRequest{
+			StartDate: timestamppb.New(weekStart(date)), Tags: f.tags,
+		})
+		return fromAPIEvents(resp.GetEvents()), err
+	case f.month != "":
+		date, err := parseDate(f.month)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.GetEventsForMonth(ctx, &api.GetEventsRequest{
+			StartDate: timestamppb.New(monthStart(date)), Tags: f.tags,
+		})
+		return fromAPIEvents(resp.GetEvents()), err
+	case f.from != "" || f.to != "":
+		return f.listRange(ctx, client)
+	default:
+		date := time.Now().UTC().Truncate(24 * time.Hour)
+		if f.day != "" {
+			var err error
+			if date, err = parseDate(f.day); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := client.GetEventsForDay(ctx, &api.GetEventsRequest{StartDate: timestamppb.New(date), Tags: f.tags})
+		return fromAPIEvents(resp.GetEvents()), err
+	}
+}
+
+func (f *rangeFlags) listRange(ctx context.Context, client api.EventsClient) ([]event, error) {
+	if f.from == "" || f.to == "" {
+		return nil, fmt.Errorf("%w: --from and --to are required together", ErrUsage)
+	}
+	from, err := parseDate(f.from)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseDate(f.to)
+	if err != nil {
+		return nil, err
+	}
+	days := rangeDays(from, to)
+	if len(days) == 0 || len(days) > maxRangeDays {
+		return nil, fmt.Errorf("%w: --from must not be after --to, the range is at most %d days", ErrUsage, maxRangeDays)
+	}
+	var events []event
+	seen := make(map[string]bool)
+	for _, day := range days {
+		resp, err := client.GetEventsForDay(ctx, &api.GetEventsRequest{StartDate: timestamppb.New(day), Tags: f.tags})
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range resp.GetEvents() {
+			if !seen[e.GetId()] {
+				seen[e.GetId()] = true
+				events = append(events, fromAPIEvent(e))
+			}
+		}
+	}
+	return events, nil
+}
+
+// weekStart returns the Monday of the week of the date, weeks of the server start on Monday.
+func weekStart(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7
+	return date.AddDate(0, 0, -offset)
+}
+
+func monthStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+}
+
+// rangeDays returns the days from the first to the last date inclusive.
+func rangeDays(from, to time.Time) []time.Time {
+	var days []time.Time
+	for day := from; !day.After(to) && len(days) <= maxRangeDays; day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func listCommand(args []string) error {
+	fs := newFlagSet("ls")
+	var flags rangeFlags
+	flags.register(fs)
+	if err := parseOptions(fs, args); err != nil {
+		return err
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		events, err := flags.list(ctx, client)
+		if err != nil {
+			return err
+		}
+		return printEvents(os.Stdout, outputFormat, events, false)
+	})
+}
+
+// tagsCommand prints the number of events per tag.
+func tagsCommand(args []string) error {
+	fs := newFlagSet("tags")
+	owner := fs.String("owner", "", "Count events of the owner only")
+	if err := parseOptions(fs, args); err != nil {
+		return err
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.GetTagStats(ctx, &api.GetTagStatsRequest{OwnerId: *owner})
+		if err != nil {
+			return err
+		}
+		return printTagStats(os.Stdout, outputFormat, resp.GetStats())
+	})
+}
+
+// searchCommand prints the events matching the query, the most relevant first.
+func searchCommand(args []string) error {
+	fs := newFlagSet("search")
+	owner := fs.String("owner", "", "Search events of the owner only")
+	limit := fs.Int("limit", 0, "Maximum number of events, 0 means the server default")
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("%w: no search query", ErrUsage)
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.SearchEvents(ctx, &api.SearchEventsRequest{
+			Query: strings.Join(words, " "), OwnerId: *owner, Limit: int32(*limit),
+		})
+		if err != nil {
+			return err
+		}
+		events := make([]event, 0, len(resp.GetResults()))
+		for _, result := range resp.GetResults() {
+			events = append(events, fromAPIEvent(result.GetEvent()))
+		}
+		return printEvents(os.Stdout, outputFormat, events, false)
+	})
+}
+
+// exportCommand writes the events of the range in the format read by import, json by default.
+func exportCommand(args []string) error {
+	fs := newFlagSet("export")
+	var flags rangeFlags
+	flags.register(fs)
+	if err := parseOptions(fs, args); err != nil {
+		return err
+	}
+	if outputFormat == formatTable {
+		outputFormat = formatJSON
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		events, err := flags.list(ctx, client)
+		if err != nil {
+			return err
+		}
+		if events == nil {
+			events = []event{}
+		}
+		return printValue(os.Stdout, outputFormat, events)
+	})
+}
+
+// importCommand creates the events of a json or yaml file in a single batch.
+func importCommand(args []string) error {
+	fs := newFlagSet("import")
+	newIDs := fs.Bool("new-ids", false, "Drop IDs of the imported events, so the server generates new ones")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("%w: import takes a single file, - reads stdin", ErrUsage)
+	}
+	events, err := readEvents(files[0])
+	if err != nil {
+		return err
+	}
+	apiEvents := make([]*api.Event, 0, len(events))
+	for _, e := range events {
+		if *newIDs {
+			e.ID = ""
+		}
+		e.Version = 0
+		apiEvents = append(apiEvents, e.toAPI())
+	}
+	return withClient(func(ctx context.Context, client api.EventsClient) error {
+		resp, err := client.BatchCreate(ctx, &api.BatchCreateRequest{Events: apiEvents})
+		if err != nil {
+			return err
+		}
+		return printBatchResults(os.Stdout, outputFormat, resp.GetResults())
+	})
+}
+
+// readEvents reads a list of events, json is read as yaml.
+func readEvents(file string) ([]event, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open events file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var events []event
+	if err := yaml.NewDecoder(r).Decode(&events); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse events file: %w", err)
+	}
+	return events, nil
+}
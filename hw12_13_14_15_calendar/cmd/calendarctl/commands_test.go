@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRanges(t *testing.T) {
+	date := time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), weekStart(date))
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), weekStart(weekStart(date)))
+	// Sunday belongs to the week started on the previous Monday.
+	require.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), weekStart(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), monthStart(date))
+
+	require.Len(t, rangeDays(date, date.AddDate(0, 0, 6)), 7)
+	require.Empty(t, rangeDays(date, date.AddDate(0, 0, -1)))
+}
+
+func TestEventFlags(t *testing.T) {
+	flags := eventFlags{title: "Standup", start: "2026-10-21 10:00", duration: 30 * time.Minute}
+	e, err := flags.event()
+	require.NoError(t, err)
+	start := time.Date(2026, 10, 21, 10, 0, 0, 0, time.Local)
+	require.Equal(t, start, e.GetStartTime().AsTime().Local())
+	require.Equal(t, start.Add(30*time.Minute), e.GetEndTime().AsTime().Local())
+
+	flags = eventFlags{tags: stringsFlag{"ops", "on-call"}, location: "Room 1", geo: "55.75, 37.62"}
+	e, err = flags.event()
+	require.NoError(t, err)
+	require.Equal(t, []string{"ops", "on-call"}, e.GetTags())
+	require.Equal(t, "Room 1", e.GetLocation().GetName())
+	require.Equal(t, 37.62, e.GetLocation().GetGeo().GetLongitude())
+	var tags stringsFlag
+	require.NoError(t, tags.Set("a, b"))
+	require.NoError(t, tags.Set("c"))
+	require.Equal(t, stringsFlag{"a", "b", "c"}, tags)
+
+	flags = eventFlags{start: "2026-10-21 23:30", end: "2026-10-23", allDay: true}
+	e, err = flags.event()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC), e.GetStartTime().AsTime())
+	require.Equal(t, time.Date(2026, 10, 24, 0, 0, 0, 0, time.UTC), e.GetEndTime().AsTime())
+	first, last := fromAPIEvent(e).tableTimes()
+	require.Equal(t, "2026-10-21", first)
+	require.Equal(t, "2026-10-23", last)
+
+	_, err = eventFlags{geo: "north"}.event()
+	require.ErrorIs(t, err, ErrUsage)
+	_, err = eventFlags{duration: time.Hour}.event()
+	require.ErrorIs(t, err, ErrUsage)
+	_, err = eventFlags{start: "tomorrow"}.event()
+	require.ErrorIs(t, err, ErrUsage)
+}
+
+func TestPrintEvents(t *testing.T) {
+	start := time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC)
+	events := []event{{ID: "1", Title: "Standup", StartTime: start, EndTime: start.Add(time.Hour), OwnerID: "alice"}}
+
+	var b strings.Builder
+	require.NoError(t, printEvents(&b, formatJSON, events, true))
+	require.JSONEq(t, `{"id":"1","title":"Standup","startTime":"2026-10-21T10:00:00Z",`+
+		`"endTime":"2026-10-21T11:00:00Z","ownerId":"alice"}`, b.String())
+
+	b.Reset()
+	require.NoError(t, printEvents(&b, formatYAML, events, false))
+	require.Contains(t, b.String(), "- id: \"1\"\n  title: Standup\n")
+
+	b.Reset()
+	require.NoError(t, printEvents(&b, formatTable, events, false))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[1], "1   Standup"))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/tlsconfig"
+)
+
+type Config struct {
+	// Address is the host:port of the gRPC server of the calendar.
+	Address string
+	TLS     tlsconfig.ClientConfig
+	// UserID is recorded as the actor of the changes.
+	UserID  string
+	Timeout time.Duration
+}
+
+const (
+	defaultAddress = "127.0.0.1:8006"
+	defaultTimeout = 10 * time.Second
+)
+
+// defaultConfigFile is used when no config is given, it is fine for it to be missing.
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".calendarctl.yaml")
+}
+
+// NewConfig loads the config file, defaults are used when the default file does not exist.
+func NewConfig(configFile string) (Config, error) {
+	if configFile == defaultConfigFile() {
+		if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
+			return Config{Address: defaultAddress, Timeout: defaultTimeout}, nil
+		}
+	}
+	config := Config{}
+	defaults := map[string]interface{}{"address": defaultAddress, "timeout": defaultTimeout.String()}
+	err := internalconfig.Load(configFile, defaults, &config)
+	return config, err
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Required("address", c.Address)
+	v.Check("tls", c.TLS.Validate())
+	v.Duration("timeout", c.Timeout)
+	return v.Err()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+var ErrUsage = errors.New("usage error")
+
+var (
+	configFile   string
+	outputFormat string
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	// Commands are set up here, as their flag sets refer to the commands for the usage.
+	commands = map[string]command{
+		"add":    {"add --title=TITLE --start=TIME (--end=TIME | --duration=DURATION | --all-day) [event flags]", addCommand},
+		"quick":  {"quick [--owner=OWNER] [--tz=ZONE] TEXT...  (Lunch tomorrow 13:00-14:00 remind 1d)", quickCommand},
+		"update": {"update ID [--version=N] [event flags]", updateCommand},
+		"rm":     {"rm [--version=N] ID...", removeCommand},
+		"get":    {"get ID...", getCommand},
+		"ls":     {"ls [--day=DATE | --week=DATE | --month=DATE | --from=DATE --to=DATE] [--tag=TAG]", listCommand},
+		"tags":   {"tags [--owner=OWNER]", tagsCommand},
+		"search": {`search [--owner=OWNER] [--limit=N] QUERY...  (words, "a phrase", prefix*)`, searchCommand},
+		"export": {"export [ls flags]", exportCommand},
+		"import": {"import [--new-ids] FILE", importCommand},
+	}
+	flag.StringVar(&configFile, "config", defaultConfigFile(), "Path to configuration file")
+	flag.StringVar(&outputFormat, "o", formatTable, "Output format: table, json or yaml")
+	flag.Usage = usage
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: calendarctl [--config=FILE] [-o=FORMAT] COMMAND [flags]")
+	fmt.Fprintln(out, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Parse()
+	if err := run(flag.Args()); err != nil {
+		if errors.Is(err, ErrUsage) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "calendarctl: %v\n", errorMessage(err))
+		os.Exit(1)
+	}
+}
+
+// errorMessage replaces the gRPC status of the error with its code and message.
+func errorMessage(err error) string {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return err.Error()
+	}
+	s := grpcErr.GRPCStatus()
+	return strings.Replace(err.Error(), grpcErr.(error).Error(), fmt.Sprintf("%s: %s", s.Code(), s.Message()), 1)
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return fmt.Errorf("%w: no command", ErrUsage)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		flag.Usage()
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, args[0])
+	}
+	return cmd.run(args[1:])
+}
+
+// newFlagSet returns the flags of a command, the global flags may be given after the command too.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", configFile, "Path to configuration file")
+	fs.StringVar(&outputFormat, "o", outputFormat, "Output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: calendarctl %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags given before and after the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUsage, err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	return positional, checkFormat(outputFormat)
+}
+
+// parseOptions parses the flags of a command without positional arguments.
+func parseOptions(fs *flag.FlagSet, args []string) error {
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("%w: unexpected arguments %v", ErrUsage, positional)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+
+	// tableTimeLayout shows times of the table in the local time zone.
+	tableTimeLayout = "2006-01-02 15:04"
+)
+
+// event is the representation of an event in the output and in imported files.
+type event struct {
+	ID            string    `json:"id,omitempty" yaml:"id,omitempty"`
+	Title         string    `json:"title" yaml:"title"`
+	StartTime     time.Time `json:"startTime" yaml:"startTime"`
+	EndTime       time.Time `json:"endTime" yaml:"endTime"`
+	Description   string    `json:"description,omitempty" yaml:"description,omitempty"`
+	OwnerID       string    `json:"ownerId" yaml:"ownerId"`
+	NotifyBefore  int32     `json:"notifyBefore,omitempty" yaml:"notifyBefore,omitempty"`
+	Version       int64     `json:"version,omitempty" yaml:"version,omitempty"`
+	Tags          []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Color         string    `json:"color,omitempty" yaml:"color,omitempty"`
+	Location      *location `json:"location,omitempty" yaml:"location,omitempty"`
+	ConferenceURL string    `json:"conferenceUrl,omitempty" yaml:"conferenceUrl,omitempty"`
+	AllDay        bool      `json:"allDay,omitempty" yaml:"allDay,omitempty"`
+}
+
+type location struct {
+	Name string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Geo  *geoPoint `json:"geo,omitempty" yaml:"geo,omitempty"`
+}
+
+type geoPoint struct {
+	Latitude  float64 `json:"latitude" yaml:"latitude"`
+	Longitude float64 `json:"longitude" yaml:"longitude"`
+}
+
+// fromAPILocation returns nil for an empty location, so it is omitted from the output.
+func fromAPILocation(l *api.Location) *location {
+	if l.GetName() == "" && l.GetGeo() == nil {
+		return nil
+	}
+	result := &location{Name: l.GetName()}
+	if geo := l.GetGeo(); geo != nil {
+		result.Geo = &geoPoint{Latitude: geo.GetLatitude(), Longitude: geo.GetLongitude()}
+	}
+	return result
+}
+
+func (l *location) toAPI() *api.Location {
+	if l == nil {
+		return nil
+	}
+	result := &api.Location{Name: l.Name}
+	if l.Geo != nil {
+		result.Geo = &api.GeoPoint{Latitude: l.Geo.Latitude, Longitude: l.Geo.Longitude}
+	}
+	return result
+}
+
+func fromAPIEvent(e *api.Event) event {
+	return event{
+		ID:            e.GetId(),
+		Title:         e.GetTitle(),
+		StartTime:     e.GetStartTime().AsTime(),
+		EndTime:       e.GetEndTime().AsTime(),
+		Description:   e.GetDescription(),
+		OwnerID:       e.GetOwnerId(),
+		NotifyBefore:  e.GetNotifyBefore(),
+		Version:       e.GetVersion(),
+		Tags:          e.GetTags(),
+		Color:         e.GetColor(),
+		Location:      fromAPILocation(e.GetLocation()),
+		ConferenceURL: e.GetConferenceUrl(),
+		AllDay:        e.GetAllDay(),
+	}
+}
+
+func fromAPIEvents(events []*api.Event) []event {
+	result := make([]event, 0, len(events))
+	for _, e := range events {
+		result = append(result, fromAPIEvent(e))
+	}
+	return result
+}
+
+func (e event) toAPI() *api.Event {
+	return &api.Event{
+		Id:            e.ID,
+		Title:         e.Title,
+		StartTime:     timestamppb.New(e.StartTime),
+		EndTime:       timestamppb.New(e.EndTime),
+		Description:   e.Description,
+		OwnerId:       e.OwnerID,
+		NotifyBefore:  e.NotifyBefore,
+		Version:       e.Version,
+		Tags:          e.Tags,
+		Color:         e.Color,
+		Location:      e.Location.toAPI(),
+		ConferenceUrl: e.ConferenceURL,
+		AllDay:        e.AllDay,
+	}
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown output format %q", ErrUsage, format)
+	}
+}
+
+// printValue writes a value in the json or yaml format.
+func printValue(w io.Writer, format string, value interface{}) error {
+	switch format {
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode yaml: %w", err)
+		}
+		return enc.Close()
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode json: %w", err)
+		}
+		return nil
+	}
+}
+
+// printEvents writes the events, a single event is written as an object in the json and yaml formats.
+func printEvents(w io.Writer, format string, events []event, single bool) error {
+	if format != formatTable {
+		if single && len(events) == 1 {
+			return printValue(w, format, events[0])
+		}
+		return printValue(w, format, events)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tSTART\tEND\tOWNER\tVERSION\tTAGS")
+	for _, e := range events {
+		start, end := e.tableTimes()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", e.ID, e.Title, start, end,
+			e.OwnerID, e.Version, strings.Join(e.Tags, ","))
+	}
+	return tw.Flush()
+}
+
+// tableTimes formats the times in the local time zone, an all-day event shows its first and last dates.
+func (e event) tableTimes() (string, string) {
+	if e.AllDay {
+		return e.StartTime.UTC().Format(dateLayout), e.EndTime.UTC().AddDate(0, 0, -1).Format(dateLayout)
+	}
+	return e.StartTime.Local().Format(tableTimeLayout), e.EndTime.Local().Format(tableTimeLayout)
+}
+
+type tagCount struct {
+	Tag   string `json:"tag" yaml:"tag"`
+	Count int32  `json:"count" yaml:"count"`
+}
+
+func printTagStats(w io.Writer, format string, stats []*api.TagCount) error {
+	items := make([]tagCount, 0, len(stats))
+	for _, stat := range stats {
+		items = append(items, tagCount{Tag: stat.GetTag(), Count: stat.GetCount()})
+	}
+	if format != formatTable {
+		return printValue(w, format, items)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tEVENTS")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%d\n", item.Tag, item.Count)
+	}
+	return tw.Flush()
+}
+
+type batchResult struct {
+	ID      string `json:"id" yaml:"id"`
+	Version int64  `json:"version,omitempty" yaml:"version,omitempty"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func printBatchResults(w io.Writer, format string, results []*api.BatchResult) error {
+	items := make([]batchResult, 0, len(results))
+	for _, r := range results {
+		item := batchResult{ID: r.GetId(), Version: r.GetVersion()}
+		if codes.Code(r.GetCode()) != codes.OK {
+			item.Error = r.GetError()
+		}
+		items = append(items, item)
+	}
+	if format != formatTable {
+		return printValue(w, format, items)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tVERSION\tERROR")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", item.ID, item.Version, item.Error)
+	}
+	return tw.Flush()
+}
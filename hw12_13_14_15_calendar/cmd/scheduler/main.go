@@ -2,36 +2,25 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	localblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/local"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
-	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/scheduler"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storagebuilder"
 	log "github.com/sirupsen/logrus"
 )
 
 var configFile string
 
-const (
-	removeTimeout = time.Minute * 5
-	checkTimout   = time.Minute
-)
-
-func newMessage(event storage.Event) rabbit.Message {
-	return rabbit.Message{
-		ID:      event.ID,
-		Name:    event.Title,
-		Time:    event.StartTime,
-		OwnerID: event.OwnerID,
-	}
-}
-
 func init() {
 	flag.StringVar(&configFile, "config", "./configs/scheduler_config.yaml", "Path to configuration file")
 	log.SetFormatter(&log.TextFormatter{})
@@ -58,68 +47,59 @@ func main() {
 		log.Errorf("failed to connect to the RabbitMQ: %v", err)
 		return
 	}
-	defer r.Close()
 
 	stor, err := storagebuilder.NewStorage(config.Storage)
 	if err != nil {
+		r.Close()
 		log.Errorf("failed to start %v", err)
 		return
 	}
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
-		stor.Close(ctx)
-	}()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	var blobs blob.Store
+	if config.Attachments.Dir != "" {
+		if blobs, err = localblob.New(config.Attachments.Dir); err != nil {
+			r.Close()
+			stor.Close(context.Background())
+			log.Errorf("failed to start %v", err)
+			return
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	endTime := time.Now()
-	eventLimit := 100
-	checkTicker := time.NewTicker(checkTimout)
-	removeTicker := time.NewTicker(removeTimeout)
-	go func() {
-		for range removeTicker.C {
-			if err := stor.RemoveAfter(ctx, time.Now().Add(-1*(time.Hour*24*365))); err != nil {
-				log.Errorf("failed to remove old events: %s", err)
-				continue
-			}
-		}
-	}()
+	opts := []scheduler.Option{scheduler.WithClock(clock.Real)}
+	if blobs != nil {
+		opts = append(opts, scheduler.WithBlobs(blobs))
+	}
+	s := scheduler.New(stor, r, config.Scheduler, opts...)
+	group := lifecycle.New(config.Lifecycle)
+	group.Add("storage", nil, stor.Close)
+	group.Add("rabbit", nil, func(context.Context) error {
+		r.Close()
+		return nil
+	})
+	group.Add("cleaner", s.Cleanup, nil)
+	group.Add("notifier", s.Notify, nil)
+	group.Add("config watcher", func(ctx context.Context) error {
+		return internalconfig.Watch(ctx, configFile, func() { reload(s) })
+	}, nil)
+	if err := group.Run(ctx); err != nil {
+		log.Errorf("scheduler stopped: %v", err)
+		os.Exit(1)
+	}
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			log.Debugf("get events %s", endTime)
-			events, err := stor.GetEventsByNotifier(ctx, eventLimit, endTime)
-			if err != nil {
-				log.Errorf("failed to get events: %s", err)
-				continue
-			}
-			for _, event := range events {
-				log.Debugf("send event: %v", event)
-				m := newMessage(event)
-				data, err := json.Marshal(m)
-				if err != nil {
-					log.Errorf("failed to marshal event: %s", err)
-					return
-				}
-				r.Publish(data)
-			}
-			err = stor.MarkSentEvents(ctx, events)
-			if err != nil {
-				log.Errorf("failed to mark sent events: %s", err)
-				continue
-			}
-			select {
-			case <-ctx.Done():
-				return
-			case <-checkTicker.C:
-				log.Debug("ticker")
-				endTime = time.Now()
-			}
-		}
+// reload applies the settings which can be changed without a restart, an invalid config is rejected.
+func reload(s *scheduler.Scheduler) {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Errorf("failed to reload config, the current one is kept: %v", err)
+		return
+	}
+	if err := logger.PrepareLogger(config.Logger); err != nil {
+		log.Errorf("failed to reload logger config: %v", err)
 	}
+	s.Update(config.Scheduler)
+	log.Info("config reloaded")
 }
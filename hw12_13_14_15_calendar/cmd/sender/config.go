@@ -1,52 +1,43 @@
 package main
 
 import (
-	"fmt"
-	"strings"
-
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storagebuilder"
-	"github.com/spf13/viper"
 )
 
-const envConfigPrefix = "$env:"
-
 type Config struct {
-	Logger  logger.Config
-	Rabbit  rabbit.Config
-	Storage storagebuilder.Config
+	Logger    logger.Config
+	Rabbit    rabbit.Config
+	Storage   storagebuilder.Config
+	Lifecycle lifecycle.Config
 }
 
+// NewConfig loads and validates the config file.
 func NewConfig(configFile string) (Config, error) {
 	config := Config{}
-	viper.SetConfigFile(configFile)
-
-	viper.SetDefault("rabbit.host", "127.0.0.1")
-	viper.SetDefault("rabbit.port", "5672")
-	viper.SetDefault("rabbit.user", "user")
-	viper.SetDefault("rabbit.password", "pass")
-	viper.SetDefault("rabbit.queue", "calendar.notify")
-	viper.SetDefault("logger.level", "WARN")
-
-	err := viper.ReadInConfig()
-	if err != nil {
-		return config, fmt.Errorf("failed to read config %q: %w", configFile, err)
-	}
-	keys := viper.AllKeys()
-	for _, key := range keys {
-		env := viper.GetString(key)
-		if strings.HasPrefix(env, envConfigPrefix) {
-			err := viper.BindEnv(key, env[len(envConfigPrefix):])
-			if err != nil {
-				return Config{}, fmt.Errorf("failed to prepare config: %w", err)
-			}
-		}
+	defaults := map[string]interface{}{
+		"rabbit.host":               "127.0.0.1",
+		"rabbit.port":               5672,
+		"rabbit.user":               "user",
+		"rabbit.password":           "pass",
+		"rabbit.queue":              "calendar.notify",
+		"logger.level":              "WARN",
+		"lifecycle.shutdownTimeout": "10s",
+		"storage.storageType":       storagebuilder.MemoryStorage,
 	}
+	err := internalconfig.Load(configFile, defaults, &config)
+	return config, err
+}
 
-	err = viper.Unmarshal(&config)
-	if err != nil {
-		return config, fmt.Errorf("unable to decode into config struct: %w", err)
-	}
-	return config, nil
+// Validate reports all the problems of the config at once.
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Check("logger", c.Logger.Validate())
+	v.Check("rabbit", c.Rabbit.Validate())
+	v.Check("storage", c.Storage.Validate())
+	v.Check("lifecycle", c.Lifecycle.Validate())
+	return v.Err()
 }
@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storagebuilder"
 	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
@@ -39,32 +43,68 @@ func main() {
 	}
 
 	r := rabbit.New(config.Rabbit)
-	r.Connect()
-	defer r.Close()
+	if err = r.Connect(); err != nil {
+		log.Errorf("failed to connect to the RabbitMQ: %v", err)
+		return
+	}
 
 	stor, err := storagebuilder.NewStorage(config.Storage)
 	if err != nil {
+		r.Close()
 		log.Errorf("failed to start %v", err)
 		return
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	r.Consume(ctx, func(msg amqp.Delivery) {
-		m := rabbit.Message{}
-		err := json.Unmarshal(msg.Body, &m)
-		if err != nil {
-			log.Errorf("failed to parse bytes: %s", err)
-			cancel()
-			return
-		}
-		log.Printf("sending message %v", m)
-		err = stor.AddSenderLog(ctx, &m)
-		if err != nil {
-			log.Errorf("failed to add sender log: %s", err)
-			cancel()
-			return
-		}
+	group := lifecycle.New(config.Lifecycle)
+	group.Add("storage", nil, stor.Close)
+	// Closing the connection returns unacknowledged messages to the queue.
+	group.Add("rabbit", nil, func(context.Context) error {
+		r.Close()
+		return nil
 	})
+	group.Add("consumer", func(ctx context.Context) error {
+		return r.Consume(ctx, func(ctx context.Context, msg amqp.Delivery) error {
+			return send(ctx, stor, msg)
+		})
+	}, nil)
+	group.Add("config watcher", func(ctx context.Context) error {
+		return internalconfig.Watch(ctx, configFile, reload)
+	}, nil)
+	if err := group.Run(ctx); err != nil {
+		log.Errorf("sender stopped: %v", err)
+		os.Exit(1)
+	}
+}
+
+// reload applies the logger settings, an invalid config is rejected.
+func reload() {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Errorf("failed to reload config, the current one is kept: %v", err)
+		return
+	}
+	if err := logger.PrepareLogger(config.Logger); err != nil {
+		log.Errorf("failed to reload logger config: %v", err)
+		return
+	}
+	log.Info("config reloaded")
+}
+
+// send records the notification. Malformed messages are dropped, a storage failure
+// returns the message to the queue.
+func send(ctx context.Context, stor storage.Storage, msg amqp.Delivery) error {
+	entry := logger.FromContext(ctx)
+	m := rabbit.Message{}
+	if err := json.Unmarshal(msg.Body, &m); err != nil {
+		entry.Errorf("failed to parse bytes: %s", err)
+		return nil
+	}
+	entry.Printf("sending message %v", m)
+	if err := stor.AddSenderLog(ctx, &m); err != nil {
+		return fmt.Errorf("failed to add sender log: %w", err)
+	}
+	return nil
 }
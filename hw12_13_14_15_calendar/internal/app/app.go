@@ -2,42 +2,253 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/quickadd"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/webhook"
 )
 
 type App struct {
-	Storage storage.Storage
+	Storage           storage.Storage
+	changes           *hub
+	idempotencyWindow time.Duration
+	// blobs keep the content of attachments, nil disables them.
+	blobs             blob.Store
+	maxAttachmentSize int64
+	webhookGuard      *webhook.Guard
+	clock             clock.Clock
 }
 
-func New(storage storage.Storage) *App {
-	return &App{Storage: storage}
+func New(storage storage.Storage, opts ...Option) *App {
+	a := &App{
+		Storage:           storage,
+		changes:           newHub(),
+		idempotencyWindow: DefaultIdempotencyWindow,
+		webhookGuard:      &webhook.Guard{},
+		clock:             clock.Real,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
-func (a *App) CreateEvent(ctx context.Context, e storage.Event) (string, error) {
+// WithClock sets the clock stamping the changes, the system one by default.
+// The storage keeps its own clock, it stamps the audit records.
+func WithClock(c clock.Clock) Option {
+	return func(a *App) {
+		a.clock = c
+	}
+}
+
+// CreateEvent stores the event and returns it with the assigned ID and version.
+func (a *App) CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error) {
 	if err := a.Storage.AddEvent(ctx, &e); err != nil {
-		return "", err
+		return storage.Event{}, err
+	}
+	a.created(ctx, e)
+	return e, nil
+}
+
+// UpdateEvent replaces the event and returns its new version. Zero version skips the conflict check.
+func (a *App) UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (int64, error) {
+	version, err := a.Storage.UpdateEvent(ctx, id, e, version)
+	if err != nil {
+		return 0, err
+	}
+	a.updated(ctx, id)
+	return version, nil
+}
+
+// PatchEvent applies a partial update and returns the merged event. Zero version skips the conflict check.
+func (a *App) PatchEvent(ctx context.Context, id string, patch storage.EventPatch, version int64) (storage.Event, error) {
+	e, err := a.Storage.PatchEvent(ctx, id, patch, version)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	a.publish(ctx, storage.ChangeUpdated, e)
+	return e, nil
+}
+
+// RemoveEvent deletes the event. Zero version skips the conflict check.
+func (a *App) RemoveEvent(ctx context.Context, id string, version int64) error {
+	// The removed event is needed to route the change to the owner's watchers.
+	before := a.snapshot(ctx, id)
+	if err := a.Storage.RemoveEvent(ctx, id, version); err != nil {
+		return err
 	}
-	return e.ID, nil
+	a.removed(ctx, id, before)
+	return nil
 }
 
-func (a *App) UpdateEvent(ctx context.Context, id string, e storage.Event) error {
-	return a.Storage.UpdateEvent(ctx, id, e)
+// RestoreEvent moves the removed event back from the trash and returns it.
+func (a *App) RestoreEvent(ctx context.Context, id string) (storage.Event, error) {
+	e, err := a.Storage.RestoreEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	// For watchers the restored event appears again.
+	a.publish(ctx, storage.ChangeCreated, e)
+	return e, nil
+}
+
+// ListTrash returns removed events of the owner, an empty owner lists the whole trash.
+func (a *App) ListTrash(ctx context.Context, ownerID string) ([]storage.Event, error) {
+	return a.Storage.GetTrash(ctx, ownerID)
 }
 
-func (a *App) RemoveEvent(ctx context.Context, id string) error {
-	return a.Storage.RemoveEvent(ctx, id)
+func (a *App) GetEvent(ctx context.Context, id string) (storage.Event, error) {
+	return a.Storage.GetEvent(ctx, id)
+}
+
+func (a *App) BatchCreate(ctx context.Context, events []storage.Event) ([]storage.BatchResult, error) {
+	results, err := a.Storage.BatchCreate(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		if res.Err == nil {
+			a.created(ctx, *res.Event)
+		}
+	}
+	return results, nil
 }
 
-func (a *App) GetEventsForDay(ctx context.Context, date time.Time) ([]storage.Event, error) {
-	return a.Storage.GetEventsForDay(ctx, date)
+func (a *App) BatchUpdate(ctx context.Context, items []storage.BatchUpdateItem) ([]storage.BatchResult, error) {
+	results, err := a.Storage.BatchUpdate(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		if res.Err == nil {
+			a.updated(ctx, res.ID)
+		}
+	}
+	return results, nil
 }
 
-func (a *App) GetEventsForWeek(ctx context.Context, startDate time.Time) ([]storage.Event, error) {
-	return a.Storage.GetEventsForWeek(ctx, startDate)
+func (a *App) BatchDelete(ctx context.Context, items []storage.BatchRemoveItem) ([]storage.BatchResult, error) {
+	before := make([]*storage.Event, len(items))
+	for i, item := range items {
+		before[i] = a.snapshot(ctx, item.ID)
+	}
+	results, err := a.Storage.BatchDelete(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	for i, res := range results {
+		if res.Err == nil {
+			a.removed(ctx, items[i].ID, before[i])
+		}
+	}
+	return results, nil
 }
 
-func (a *App) GetEventsForMonth(ctx context.Context, startDate time.Time) ([]storage.Event, error) {
-	return a.Storage.GetEventsForMonth(ctx, startDate)
+// GetEventsForDay returns events of the day passing the filter.
+func (a *App) GetEventsForDay(
+	ctx context.Context,
+	date time.Time,
+	filter storage.EventFilter,
+) ([]storage.Event, error) {
+	events, err := a.Storage.GetEventsForDay(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Filter(events), nil
+}
+
+func (a *App) GetEventsForWeek(
+	ctx context.Context,
+	startDate time.Time,
+	filter storage.EventFilter,
+) ([]storage.Event, error) {
+	events, err := a.Storage.GetEventsForWeek(ctx, startDate)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Filter(events), nil
+}
+
+func (a *App) GetEventsForMonth(
+	ctx context.Context,
+	startDate time.Time,
+	filter storage.EventFilter,
+) ([]storage.Event, error) {
+	events, err := a.Storage.GetEventsForMonth(ctx, startDate)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Filter(events), nil
+}
+
+// GetOwnerEvents returns the active events of the owner taking any time of [from:to) ordered by start time,
+// zero to means no upper bound.
+func (a *App) GetOwnerEvents(ctx context.Context, ownerID string, from, to time.Time) ([]storage.Event, error) {
+	return a.Storage.GetOwnerEvents(ctx, ownerID, from, to)
+}
+
+// GetTagStats counts active events of the owner per tag, an empty owner counts events of all owners.
+func (a *App) GetTagStats(ctx context.Context, ownerID string) ([]storage.TagCount, error) {
+	return a.Storage.GetTagStats(ctx, ownerID)
+}
+
+// SearchEvents returns up to limit active events matching the text of storage.ParseSearchQuery,
+// the most relevant go first. An empty owner searches events of all owners.
+func (a *App) SearchEvents(ctx context.Context, text, ownerID string, limit int) ([]storage.SearchResult, error) {
+	terms := storage.ParseSearchQuery(text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: no words to search for", storage.ErrInvalidSearchQuery)
+	}
+	return a.Storage.SearchEvents(ctx, storage.SearchQuery{Terms: terms, OwnerID: ownerID, Limit: limit})
+}
+
+// QuickAddEvent creates the event of the owner described by the text, see quickadd.Parse. Dates and
+// times are taken in the IANA time zone, empty means UTC.
+func (a *App) QuickAddEvent(ctx context.Context, text, ownerID, timeZone string) (storage.Event, error) {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("%w: unknown time zone %q", quickadd.ErrInvalidText, timeZone)
+	}
+	e, err := quickadd.Parse(text, a.clock.Now().In(loc))
+	if err != nil {
+		return storage.Event{}, err
+	}
+	e.OwnerID = ownerID
+	return a.CreateEvent(ctx, e)
+}
+
+// snapshot returns the stored event or nil if it can't be read.
+func (a *App) snapshot(ctx context.Context, id string) *storage.Event {
+	e, err := a.Storage.GetEvent(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return &e
+}
+
+func (a *App) created(ctx context.Context, e storage.Event) {
+	a.publish(ctx, storage.ChangeCreated, e)
+}
+
+// updated reads the stored event back to notify watchers of its current state.
+func (a *App) updated(ctx context.Context, id string) {
+	e, err := a.Storage.GetEvent(ctx, id)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to get updated event %q: %v", id, err)
+		return
+	}
+	a.publish(ctx, storage.ChangeUpdated, e)
+}
+
+func (a *App) removed(ctx context.Context, id string, before *storage.Event) {
+	e := storage.Event{ID: id}
+	if before != nil {
+		e = *before
+	}
+	a.publish(ctx, storage.ChangeDeleted, e)
 }
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	// DefaultMaxAttachmentSize bounds the content of a single attachment.
+	DefaultMaxAttachmentSize = 10 << 20
+	// sniffLength is the most bytes http.DetectContentType considers.
+	sniffLength = 512
+	// genericContentType is replaced with the detected one.
+	genericContentType = "application/octet-stream"
+)
+
+var (
+	ErrAttachmentsDisabled = errors.New("attachments are disabled")
+	ErrAttachmentTooLarge  = errors.New("attachment is too large")
+	ErrInvalidAttachment   = errors.New("invalid attachment")
+)
+
+// WithAttachments enables attachments kept in the store, a non-positive size selects DefaultMaxAttachmentSize.
+func WithAttachments(store blob.Store, maxSize int64) Option {
+	return func(a *App) {
+		if maxSize <= 0 {
+			maxSize = DefaultMaxAttachmentSize
+		}
+		a.blobs, a.maxAttachmentSize = store, maxSize
+	}
+}
+
+// UploadAttachment reads the content from r and attaches it to the event. An empty or generic
+// content type is detected from the content. ErrAttachmentTooLarge is returned as soon as
+// the content exceeds the limit, nothing is stored then.
+func (a *App) UploadAttachment(
+	ctx context.Context,
+	eventID, name, contentType string,
+	r io.Reader,
+) (storage.Attachment, error) {
+	if a.blobs == nil {
+		return storage.Attachment{}, ErrAttachmentsDisabled
+	}
+	if name == "" {
+		return storage.Attachment{}, fmt.Errorf("%w: name is required", ErrInvalidAttachment)
+	}
+	// Fail before reading the content, the event is checked again when the attachment is added.
+	if _, err := a.Storage.GetEvent(ctx, eventID); err != nil {
+		return storage.Attachment{}, err
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return storage.Attachment{}, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	head = head[:n]
+	if contentType == "" || contentType == genericContentType {
+		contentType = http.DetectContentType(head)
+	}
+
+	id, err := newAttachmentID()
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	content := &limitedReader{r: io.MultiReader(bytes.NewReader(head), r), left: a.maxAttachmentSize}
+	size, err := a.blobs.Put(ctx, id, content)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	attachment := storage.Attachment{
+		ID:          id,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   a.clock.Now(),
+	}
+	e, err := a.Storage.AddAttachment(ctx, eventID, attachment)
+	if err != nil {
+		a.deleteBlob(ctx, id)
+		return storage.Attachment{}, err
+	}
+	a.publish(ctx, storage.ChangeUpdated, e)
+	return attachment, nil
+}
+
+// OpenAttachment returns the attachment of the event and its content, the caller closes the content.
+func (a *App) OpenAttachment(
+	ctx context.Context,
+	eventID, attachmentID string,
+) (storage.Attachment, io.ReadCloser, error) {
+	if a.blobs == nil {
+		return storage.Attachment{}, nil, ErrAttachmentsDisabled
+	}
+	e, err := a.Storage.GetEvent(ctx, eventID)
+	if err != nil {
+		return storage.Attachment{}, nil, err
+	}
+	attachment, err := e.FindAttachment(attachmentID)
+	if err != nil {
+		return storage.Attachment{}, nil, fmt.Errorf("failed to open %q of event with id %q: %w", attachmentID, eventID, err)
+	}
+	content, err := a.blobs.Get(ctx, attachment.ID)
+	if err != nil {
+		return storage.Attachment{}, nil, err
+	}
+	return attachment, content, nil
+}
+
+// RemoveAttachment detaches the attachment from the event and deletes its content.
+func (a *App) RemoveAttachment(ctx context.Context, eventID, attachmentID string) error {
+	if a.blobs == nil {
+		return ErrAttachmentsDisabled
+	}
+	e, err := a.Storage.RemoveAttachment(ctx, eventID, attachmentID)
+	if err != nil {
+		return err
+	}
+	a.deleteBlob(ctx, attachmentID)
+	a.publish(ctx, storage.ChangeUpdated, e)
+	return nil
+}
+
+// DeleteAttachments deletes the content of the attachments of permanently deleted events.
+func DeleteAttachments(ctx context.Context, store blob.Store, events []storage.Event) {
+	for _, e := range events {
+		for _, attachment := range e.Attachments {
+			err := store.Delete(ctx, attachment.ID)
+			if err != nil && !errors.Is(err, blob.ErrNotFound) {
+				logger.FromContext(ctx).Errorf("failed to delete attachment %q of event %q: %v", attachment.ID, e.ID, err)
+			}
+		}
+	}
+}
+
+// deleteBlob deletes the content of the attachment, a failure only leaves an orphaned blob.
+func (a *App) deleteBlob(ctx context.Context, id string) {
+	if err := a.blobs.Delete(ctx, id); err != nil && !errors.Is(err, blob.ErrNotFound) {
+		logger.FromContext(ctx).Errorf("failed to delete attachment %q: %v", id, err)
+	}
+}
+
+func newAttachmentID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate attachment id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// limitedReader fails with ErrAttachmentTooLarge when more than left bytes are read.
+type limitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return 0, ErrAttachmentTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,75 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	memoryblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/memory"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachments(t *testing.T) {
+	initDate := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
+	blobs := memoryblob.New()
+	a := app.New(memorystorage.New(), app.WithAttachments(blobs, 1024))
+	ctx := context.Background()
+	e, err := a.CreateEvent(ctx, storage.Event{Title: "review", StartTime: initDate, EndTime: initDate.Add(time.Hour)})
+	require.NoError(t, err)
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 600)...)
+	attachment, err := a.UploadAttachment(ctx, e.ID, "diagram.png", "", bytes.NewReader(png))
+	require.NoError(t, err)
+	require.Equal(t, "image/png", attachment.ContentType)
+	require.Equal(t, int64(len(png)), attachment.Size)
+	agenda, err := a.UploadAttachment(ctx, e.ID, "agenda", "text/markdown", strings.NewReader("# Agenda"))
+	require.NoError(t, err)
+	require.Equal(t, "text/markdown", agenda.ContentType)
+
+	// Replacing the event keeps the attachments.
+	e.Title = "design review"
+	_, err = a.UpdateEvent(ctx, e.ID, e, 0)
+	require.NoError(t, err)
+	stored, err := a.GetEvent(ctx, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Attachment{attachment, agenda}, stored.Attachments)
+	require.Equal(t, int64(4), stored.Version)
+
+	got, content, err := a.OpenAttachment(ctx, e.ID, attachment.ID)
+	require.NoError(t, err)
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.NoError(t, content.Close())
+	require.Equal(t, attachment, got)
+	require.Equal(t, png, data)
+
+	_, err = a.UploadAttachment(ctx, e.ID, "large.bin", "", bytes.NewReader(make([]byte, 1025)))
+	require.ErrorIs(t, err, app.ErrAttachmentTooLarge)
+	_, err = a.UploadAttachment(ctx, e.ID, "", "", strings.NewReader("content"))
+	require.ErrorIs(t, err, app.ErrInvalidAttachment)
+	_, err = a.UploadAttachment(ctx, "missing", "agenda", "", strings.NewReader("content"))
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+
+	require.NoError(t, a.RemoveAttachment(ctx, e.ID, attachment.ID))
+	_, err = blobs.Get(ctx, attachment.ID)
+	require.ErrorIs(t, err, blob.ErrNotFound)
+	_, _, err = a.OpenAttachment(ctx, e.ID, attachment.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundAttachment)
+	require.ErrorIs(t, a.RemoveAttachment(ctx, e.ID, attachment.ID), storage.ErrNotFoundAttachment)
+
+	stored, err = a.GetEvent(ctx, e.ID)
+	require.NoError(t, err)
+	app.DeleteAttachments(ctx, blobs, []storage.Event{stored})
+	_, err = blobs.Get(ctx, agenda.ID)
+	require.ErrorIs(t, err, blob.ErrNotFound)
+
+	_, err = app.New(memorystorage.New()).UploadAttachment(ctx, e.ID, "agenda", "", strings.NewReader("content"))
+	require.ErrorIs(t, err, app.ErrAttachmentsDisabled)
+}
@@ -0,0 +1,21 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (a *App) GetEventHistory(ctx context.Context, id string) ([]storage.AuditRecord, error) {
+	return a.Storage.GetEventHistory(ctx, id)
+}
+
+func (a *App) GetOwnerActivity(
+	ctx context.Context,
+	ownerID string,
+	from, to time.Time,
+	limit int,
+) ([]storage.AuditRecord, error) {
+	return a.Storage.GetOwnerActivity(ctx, ownerID, from, to, limit)
+}
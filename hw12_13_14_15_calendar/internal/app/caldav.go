@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// GetCaldavNames returns the IDs of the owner's events put by CalDAV clients by the names of their resources.
+func (a *App) GetCaldavNames(ctx context.Context, ownerID string) (map[string]string, error) {
+	return a.Storage.GetCaldavNames(ctx, ownerID)
+}
+
+// CreateCaldavEvent creates the event put by a CalDAV client with an ID of the storage and links the name
+// of its resource to it. The event is removed when the name can't be linked, so the client may retry.
+func (a *App) CreateCaldavEvent(ctx context.Context, name string, e storage.Event) (storage.Event, error) {
+	e.ID = ""
+	created, err := a.CreateEvent(ctx, e)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.Storage.LinkCaldavName(ctx, created.OwnerID, name, created.ID); err != nil {
+		if rmErr := a.RemoveEvent(ctx, created.ID, created.Version); rmErr != nil {
+			logger.FromContext(ctx).Errorf("failed to remove event %q put as %q: %v", created.ID, name, rmErr)
+		}
+		return storage.Event{}, err
+	}
+	return created, nil
+}
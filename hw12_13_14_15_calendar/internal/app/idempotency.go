@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	// DefaultIdempotencyWindow is how long the result of a request with an idempotency key is kept.
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// idempotencyPurgeInterval is how often expired idempotency keys are deleted.
+	idempotencyPurgeInterval = time.Hour
+)
+
+// Option configures the App.
+type Option func(*App)
+
+// WithIdempotencyWindow sets how long repeated requests with the same idempotency key get the original result.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(a *App) {
+		a.idempotencyWindow = window
+	}
+}
+
+// CreateEventIdempotent creates the event once per idempotency key of the actor. A repeated request
+// returns the originally created event, storage.ErrIdempotencyKeyReused is returned if the payload differs.
+// An empty key creates the event unconditionally.
+func (a *App) CreateEventIdempotent(ctx context.Context, key string, e storage.Event) (storage.Event, error) {
+	if key == "" {
+		return a.CreateEvent(ctx, e)
+	}
+	actor := storage.ActorFromContext(ctx)
+	hash, err := requestHash(e)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	now := a.clock.Now()
+	r := storage.IdempotencyRecord{Key: key, Actor: actor, RequestHash: hash, CreatedAt: now}
+	err = a.Storage.AddIdempotencyRecord(ctx, r, now.Add(-a.idempotencyWindow))
+	if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+		return a.replay(ctx, actor, key, hash)
+	}
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	created, err := a.CreateEvent(ctx, e)
+	if err != nil {
+		// A failed request is not remembered, so the client may retry it with the same key.
+		if rmErr := a.Storage.RemoveIdempotencyRecord(ctx, actor, key); rmErr != nil {
+			logger.FromContext(ctx).Errorf("failed to release idempotency key %q: %v", key, rmErr)
+		}
+		return storage.Event{}, err
+	}
+	if err := a.Storage.SetIdempotencyResult(ctx, actor, key, created); err != nil {
+		logger.FromContext(ctx).Errorf("failed to record result of idempotency key %q: %v", key, err)
+	}
+	return created, nil
+}
+
+// replay returns the result recorded for the key of the actor.
+func (a *App) replay(ctx context.Context, actor, key, hash string) (storage.Event, error) {
+	r, err := a.Storage.GetIdempotencyRecord(ctx, actor, key)
+	if errors.Is(err, storage.ErrNotFoundIdempotencyRecord) {
+		// The first request has just failed and released the key.
+		return storage.Event{}, fmt.Errorf("idempotency key %q: %w", key, storage.ErrIdempotencyKeyInProgress)
+	}
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if r.RequestHash != hash {
+		return storage.Event{}, fmt.Errorf("idempotency key %q: %w", key, storage.ErrIdempotencyKeyReused)
+	}
+	if r.Event == nil {
+		return storage.Event{}, fmt.Errorf("idempotency key %q: %w", key, storage.ErrIdempotencyKeyInProgress)
+	}
+	return *r.Event, nil
+}
+
+// PurgeIdempotencyKeys periodically deletes idempotency keys older than the window until ctx is done.
+func (a *App) PurgeIdempotencyKeys(ctx context.Context) error {
+	ticker := a.clock.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			purged, err := a.Storage.PurgeIdempotencyRecords(ctx, a.clock.Now().Add(-a.idempotencyWindow))
+			if err != nil {
+				logger.FromContext(ctx).Errorf("failed to purge idempotency keys: %v", err)
+				continue
+			}
+			logger.FromContext(ctx).Debugf("purged %d idempotency keys", purged)
+		}
+	}
+}
+
+// requestHash identifies the payload of the creation request.
+func requestHash(e storage.Event) (string, error) {
+	data, err := json.Marshal(struct {
+		ID            string           `json:"id"`
+		Title         string           `json:"title"`
+		StartTime     time.Time        `json:"startTime"`
+		EndTime       time.Time        `json:"endTime"`
+		Description   string           `json:"description"`
+		OwnerID       string           `json:"ownerId"`
+		NotifyBefore  int32            `json:"notifyBefore"`
+		Tags          []string         `json:"tags"`
+		Color         string           `json:"color"`
+		Location      storage.Location `json:"location"`
+		ConferenceURL string           `json:"conferenceUrl"`
+		AllDay        bool             `json:"allDay"`
+	}{
+		ID:            e.ID,
+		Title:         e.Title,
+		StartTime:     e.StartTime.UTC(),
+		EndTime:       e.EndTime.UTC(),
+		Description:   e.Description,
+		OwnerID:       e.OwnerID,
+		NotifyBefore:  e.NotifyBefore,
+		Tags:          storage.NormalizeTags(e.Tags),
+		Color:         e.Color,
+		Location:      e.Location,
+		ConferenceURL: e.ConferenceURL,
+		AllDay:        e.AllDay,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
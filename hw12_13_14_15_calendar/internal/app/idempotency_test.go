@@ -0,0 +1,72 @@
+package app_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateEventIdempotent(t *testing.T) {
+	initDate := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: "owner"}
+
+	t.Run("repeated request", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx := storage.WithActor(context.Background(), "user")
+		first, err := a.CreateEventIdempotent(ctx, "key", event)
+		require.NoError(t, err)
+		// The same instant in another zone is the same payload.
+		moved := event
+		moved.StartTime = event.StartTime.In(time.FixedZone("UTC+3", 3*3600))
+		repeated, err := a.CreateEventIdempotent(ctx, "key", moved)
+		require.NoError(t, err)
+		require.Equal(t, first.ID, repeated.ID)
+		require.Equal(t, first.Version, repeated.Version)
+
+		events, err := a.GetEventsForDay(ctx, initDate, storage.EventFilter{})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(events))
+	})
+
+	t.Run("reused key", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx := storage.WithActor(context.Background(), "user")
+		_, err := a.CreateEventIdempotent(ctx, "key", event)
+		require.NoError(t, err)
+		changed := event
+		changed.Title = "changed"
+		_, err = a.CreateEventIdempotent(ctx, "key", changed)
+		require.ErrorIs(t, err, storage.ErrIdempotencyKeyReused)
+
+		// Keys of different actors do not collide.
+		_, err = a.CreateEventIdempotent(storage.WithActor(context.Background(), "other"), "key", changed)
+		require.NoError(t, err)
+	})
+
+	t.Run("failed request releases key", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx := context.Background()
+		past := event
+		past.StartTime, past.EndTime = time.Now().Add(-time.Hour), time.Now()
+		_, err := a.CreateEventIdempotent(ctx, "key", past)
+		require.ErrorIs(t, err, storage.ErrIncorrectEventTime)
+		_, err = a.CreateEventIdempotent(ctx, "key", event)
+		require.NoError(t, err)
+	})
+
+	t.Run("expired key", func(t *testing.T) {
+		a := app.New(memorystorage.New(), app.WithIdempotencyWindow(time.Nanosecond))
+		ctx := context.Background()
+		first, err := a.CreateEventIdempotent(ctx, "key", event)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		second, err := a.CreateEventIdempotent(ctx, "key", event)
+		require.NoError(t, err)
+		require.NotEqual(t, first.ID, second.ID)
+	})
+}
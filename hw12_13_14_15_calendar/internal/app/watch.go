@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	// watchBuffer is how many changes may wait for a slow watcher before it is dropped.
+	watchBuffer = 64
+	// replayBatch limits a single query of missed changes on resume.
+	replayBatch = 100
+)
+
+type watcher struct {
+	ownerID string
+	ch      chan storage.Change
+}
+
+// hub fans changes out to the watchers of this instance.
+type hub struct {
+	// sequence orders the changes recorded by this instance.
+	sequence sync.Mutex
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+func newHub() *hub {
+	return &hub{watchers: make(map[*watcher]struct{})}
+}
+
+func (h *hub) subscribe(ownerID string) *watcher {
+	w := &watcher{ownerID: ownerID, ch: make(chan storage.Change, watchBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[w] = struct{}{}
+	return w
+}
+
+func (h *hub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.ch)
+	}
+}
+
+func (h *hub) broadcast(c storage.Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if w.ownerID != "" && w.ownerID != c.OwnerID {
+			continue
+		}
+		select {
+		case w.ch <- c:
+		default:
+			// The watcher is too slow, it has to reconnect and resume from its last token.
+			delete(h.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+// ListenChanges forwards changes made by other instances sharing the storage to the watchers.
+// It returns immediately if the storage is not shared.
+func (a *App) ListenChanges(ctx context.Context) error {
+	listener, ok := a.Storage.(storage.ChangeListener)
+	if !ok {
+		return nil
+	}
+	return listener.ListenChanges(ctx, a.changes.broadcast)
+}
+
+// WatchEvents streams changes of the owner's events, an empty owner watches all events.
+// A non-zero token replays the changes made after it before streaming new ones.
+// The channel is closed when ctx is done or the watcher falls behind, then the caller
+// should resume with the token of the last received change.
+func (a *App) WatchEvents(ctx context.Context, ownerID string, after int64) (<-chan storage.Change, error) {
+	w := a.changes.subscribe(ownerID)
+	last := after
+	var backlog []storage.Change
+	for after > 0 {
+		changes, err := a.Storage.GetChanges(ctx, ownerID, last, replayBatch)
+		if err != nil {
+			a.changes.unsubscribe(w)
+			return nil, err
+		}
+		backlog = append(backlog, changes...)
+		if len(changes) > 0 {
+			last = changes[len(changes)-1].Token
+		}
+		if len(changes) < replayBatch {
+			break
+		}
+	}
+
+	out := make(chan storage.Change)
+	go func() {
+		defer close(out)
+		defer a.changes.unsubscribe(w)
+		for _, c := range backlog {
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok := <-w.ch:
+				if !ok {
+					return
+				}
+				// Changes received while replaying the backlog are already sent.
+				if c.Token <= last {
+					continue
+				}
+				last = c.Token
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (a *App) publish(ctx context.Context, changeType storage.ChangeType, e storage.Event) {
+	c, err := a.recordChange(ctx, changeType, e)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to record change of event %q: %v", e.ID, err)
+		return
+	}
+	a.enqueueWebhooks(ctx, c)
+}
+
+// recordChange adds the change to the feed. The token is assigned and the change is broadcast under
+// one lock, so the watchers get the changes in token order and don't skip the ones delivered late.
+func (a *App) recordChange(
+	ctx context.Context, changeType storage.ChangeType, e storage.Event,
+) (storage.Change, error) {
+	a.changes.sequence.Lock()
+	defer a.changes.sequence.Unlock()
+	c := storage.Change{Type: changeType, EventID: e.ID, OwnerID: e.OwnerID, Event: e, Time: a.clock.Now()}
+	if err := a.Storage.AddChange(ctx, &c); err != nil {
+		return storage.Change{}, err
+	}
+	// A shared storage delivers the change to every instance, this one included.
+	if _, ok := a.Storage.(storage.ChangeListener); !ok {
+		a.changes.broadcast(c)
+	}
+	return c, nil
+}
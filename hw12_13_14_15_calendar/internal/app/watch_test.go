@@ -0,0 +1,146 @@
+package app_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchEvents(t *testing.T) {
+	initDate := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
+	newEvent := func(owner string) storage.Event {
+		return storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: owner}
+	}
+
+	t.Run("live changes of owner", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes, err := a.WatchEvents(ctx, "owner", 0)
+		require.NoError(t, err)
+
+		_, err = a.CreateEvent(ctx, newEvent("other"))
+		require.NoError(t, err)
+		e, err := a.CreateEvent(ctx, newEvent("owner"))
+		require.NoError(t, err)
+		_, err = a.UpdateEvent(ctx, e.ID, newEvent("owner"), e.Version)
+		require.NoError(t, err)
+		require.NoError(t, a.RemoveEvent(ctx, e.ID, 0))
+
+		for _, expected := range []storage.ChangeType{storage.ChangeCreated, storage.ChangeUpdated, storage.ChangeDeleted} {
+			c := receive(t, changes)
+			require.Equal(t, expected, c.Type)
+			require.Equal(t, e.ID, c.EventID)
+			require.Equal(t, "owner", c.Event.OwnerID)
+		}
+
+		cancel()
+		require.Eventually(t, func() bool {
+			_, ok := <-changes
+			return !ok
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("resume after token", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first, err := a.CreateEvent(ctx, newEvent("owner"))
+		require.NoError(t, err)
+		second, err := a.CreateEvent(ctx, newEvent("owner"))
+		require.NoError(t, err)
+
+		changes, err := a.WatchEvents(ctx, "owner", 1)
+		require.NoError(t, err)
+		third, err := a.CreateEvent(ctx, newEvent("owner"))
+		require.NoError(t, err)
+
+		c := receive(t, changes)
+		require.Equal(t, second.ID, c.EventID)
+		require.Equal(t, int64(2), c.Token)
+		c = receive(t, changes)
+		require.Equal(t, third.ID, c.EventID)
+		require.NotEqual(t, first.ID, c.EventID)
+	})
+
+	t.Run("concurrent changes in token order", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes, err := a.WatchEvents(ctx, "owner", 0)
+		require.NoError(t, err)
+
+		const writers = 32
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := a.CreateEvent(ctx, newEvent("owner"))
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		for token := int64(1); token <= writers; token++ {
+			require.Equal(t, token, receive(t, changes).Token, "no change is skipped")
+		}
+	})
+
+	t.Run("batch publishes stored events", func(t *testing.T) {
+		a := app.New(memorystorage.New())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes, err := a.WatchEvents(ctx, "owner", 0)
+		require.NoError(t, err)
+
+		e := newEvent("owner")
+		e.Tags = []string{"Ops", "ops", "Review"}
+		results, err := a.BatchCreate(ctx, []storage.Event{e})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+
+		c := receive(t, changes)
+		stored, err := a.GetEvent(ctx, results[0].ID)
+		require.NoError(t, err)
+		require.Equal(t, stored, c.Event)
+		require.Equal(t, []string{"ops", "review"}, c.Event.Tags)
+		require.False(t, c.Event.UpdatedAt.IsZero())
+	})
+
+	t.Run("changes stamped by the clock", func(t *testing.T) {
+		now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+		c := clock.NewFake(now)
+		a := app.New(memorystorage.New(memorystorage.WithClock(c)), app.WithClock(c))
+		ctx := context.Background()
+		changes, err := a.WatchEvents(ctx, "owner", 0)
+		require.NoError(t, err)
+
+		e := storage.Event{Title: "test", StartTime: now.Add(time.Minute), EndTime: now.Add(time.Hour), OwnerID: "owner"}
+		e, err = a.CreateEvent(ctx, e)
+		require.NoError(t, err)
+		require.Equal(t, now, receive(t, changes).Time)
+		history, err := a.GetEventHistory(ctx, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, now, history[0].Time)
+	})
+}
+
+func receive(t *testing.T, changes <-chan storage.Change) storage.Change {
+	t.Helper()
+	select {
+	case c, ok := <-changes:
+		require.True(t, ok, "changes channel is closed")
+		return c
+	case <-time.After(time.Second):
+		require.Fail(t, "no change received")
+	}
+	return storage.Change{}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/webhook"
+)
+
+// WithWebhookGuard sets the guard of the webhook URLs, only the public addresses are allowed by default.
+func WithWebhookGuard(g *webhook.Guard) Option {
+	return func(a *App) {
+		a.webhookGuard = g
+	}
+}
+
+// CreateWebhook subscribes the https URL to the changes of events, a random secret is generated when
+// the webhook has none. The returned webhook is the only place the secret is shown.
+func (a *App) CreateWebhook(ctx context.Context, w storage.Webhook) (storage.Webhook, error) {
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return storage.Webhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	if err := w.Validate(); err != nil {
+		return storage.Webhook{}, err
+	}
+	if err := a.webhookGuard.CheckURL(w.URL); err != nil {
+		return storage.Webhook{}, err
+	}
+	w.Failures, w.DisabledAt, w.CreatedAt = 0, nil, a.clock.Now().UTC()
+	if err := a.Storage.AddWebhook(ctx, &w); err != nil {
+		return storage.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (a *App) GetWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	return a.Storage.GetWebhooks(ctx)
+}
+
+// RemoveWebhook unsubscribes the webhook, its pending deliveries are dropped.
+func (a *App) RemoveWebhook(ctx context.Context, id string) error {
+	return a.Storage.RemoveWebhook(ctx, id)
+}
+
+// EnableWebhook enables the webhook disabled after repeated failures, its pending deliveries are resumed.
+func (a *App) EnableWebhook(ctx context.Context, id string) (storage.Webhook, error) {
+	return a.Storage.EnableWebhook(ctx, id)
+}
+
+// GetWebhookDeliveries returns up to limit deliveries of the webhook, the latest go first.
+func (a *App) GetWebhookDeliveries(ctx context.Context, id string, limit int) ([]storage.WebhookDelivery, error) {
+	if _, err := a.Storage.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return a.Storage.GetWebhookDeliveries(ctx, id, limit)
+}
+
+// enqueueWebhooks queues the change for the webhooks subscribed to it, the payload is the change itself.
+func (a *App) enqueueWebhooks(ctx context.Context, c storage.Change) {
+	webhooks, err := a.Storage.GetWebhooks(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to get webhooks for change %d: %v", c.Token, err)
+		return
+	}
+	var deliveries []storage.WebhookDelivery
+	var payload []byte
+	for _, w := range webhooks {
+		if !w.Matches(c) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(c); err != nil {
+				logger.FromContext(ctx).Errorf("failed to marshal change %d: %v", c.Token, err)
+				return
+			}
+		}
+		deliveries = append(deliveries, storage.WebhookDelivery{
+			WebhookID:     w.ID,
+			Token:         c.Token,
+			Type:          c.Type,
+			Payload:       payload,
+			Status:        storage.DeliveryPending,
+			NextAttemptAt: c.Time,
+			CreatedAt:     c.Time,
+			UpdatedAt:     c.Time,
+		})
+	}
+	if err := a.Storage.AddWebhookDeliveries(ctx, deliveries); err != nil {
+		logger.FromContext(ctx).Errorf("failed to queue change %d for webhooks: %v", c.Token, err)
+	}
+}
@@ -0,0 +1,88 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	initDate := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := app.New(memorystorage.New())
+	ctx := context.Background()
+
+	_, err := a.CreateWebhook(ctx, storage.Webhook{URL: "ftp://example.com"})
+	require.ErrorIs(t, err, storage.ErrInvalidWebhook)
+	_, err = a.CreateWebhook(ctx, storage.Webhook{URL: "https://example.com", EventTypes: []storage.ChangeType{"moved"}})
+	require.ErrorIs(t, err, storage.ErrInvalidWebhook)
+	internal := []string{"http://example.com/hook", "https://127.0.0.1:8005/webhooks/add", "https://10.0.0.1/hook"}
+	for _, url := range internal {
+		_, err = a.CreateWebhook(ctx, storage.Webhook{URL: url})
+		require.ErrorIs(t, err, storage.ErrInvalidWebhook, "only https URLs of public addresses are accepted")
+	}
+
+	all, err := a.CreateWebhook(ctx, storage.Webhook{URL: "https://hr.example.com/hook"})
+	require.NoError(t, err)
+	require.Len(t, all.Secret, 64, "a secret is generated")
+	created, err := a.CreateWebhook(ctx, storage.Webhook{
+		URL:        "https://tickets.example.com/hook",
+		EventTypes: []storage.ChangeType{storage.ChangeCreated},
+		OwnerID:    "alice",
+		Secret:     "s3cret",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", created.Secret)
+
+	e, err := a.CreateEvent(ctx, storage.Event{
+		Title: "review", OwnerID: "alice", StartTime: initDate, EndTime: initDate.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	_, err = a.UpdateEvent(ctx, e.ID, e, 0)
+	require.NoError(t, err)
+	_, err = a.CreateEvent(ctx, storage.Event{
+		Title: "other", OwnerID: "bob", StartTime: initDate, EndTime: initDate.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	deliveries, err := a.GetWebhookDeliveries(ctx, all.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	require.Equal(t, storage.ChangeUpdated, deliveries[1].Type, "the latest deliveries go first")
+	require.Equal(t, storage.DeliveryPending, deliveries[1].Status)
+	var change storage.Change
+	require.NoError(t, json.Unmarshal(deliveries[1].Payload, &change))
+	require.Equal(t, e.ID, change.EventID)
+	require.Equal(t, deliveries[1].Token, change.Token)
+
+	deliveries, err = a.GetWebhookDeliveries(ctx, created.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1, "only created events of the owner are delivered")
+	require.Equal(t, storage.ChangeCreated, deliveries[0].Type)
+
+	require.NoError(t, a.RemoveWebhook(ctx, created.ID))
+	_, err = a.GetWebhookDeliveries(ctx, created.ID, 10)
+	require.ErrorIs(t, err, storage.ErrNotFoundWebhook)
+	webhooks, err := a.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Equal(t, all.ID, webhooks[0].ID)
+}
+
+func TestWebhookGuard(t *testing.T) {
+	guard, err := webhook.NewGuard([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	a := app.New(memorystorage.New(), app.WithWebhookGuard(guard))
+	ctx := context.Background()
+
+	_, err = a.CreateWebhook(ctx, storage.Webhook{URL: "https://10.0.0.1/hook"})
+	require.NoError(t, err, "the allowed networks are reached")
+	_, err = a.CreateWebhook(ctx, storage.Webhook{URL: "https://192.168.0.1/hook"})
+	require.ErrorIs(t, err, storage.ErrInvalidWebhook)
+}
@@ -0,0 +1,35 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// keyPattern limits keys to names which are safe as file names, names starting with a dot
+// are left for temporary files of the stores.
+var keyPattern = regexp.MustCompile(`^[0-9A-Za-z_-][0-9A-Za-z._-]*$`)
+
+// Store keeps binary content by key.
+type Store interface {
+	// Put stores the content read from r under the key and returns its size. When reading fails
+	// nothing is stored and the error of the reader is returned wrapped.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the content of the key, the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// CheckKey returns ErrInvalidKey for a key which is not a plain name.
+func CheckKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package localblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+)
+
+// Store keeps every blob in a file of the directory named after the key.
+type Store struct {
+	dir string
+}
+
+// New creates the directory if it doesn't exist.
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put writes the content to a temporary file first, so a blob is either complete or absent.
+func (s *Store) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	if err := blob.CheckKey(key); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create blob %q: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write blob %q: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write blob %q: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return 0, fmt.Errorf("failed to store blob %q: %w", key, err)
+	}
+	return size, nil
+}
+
+func (s *Store) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	if err := blob.CheckKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = blob.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %q: %w", key, err)
+	}
+	return f, nil
+}
+
+func (s *Store) Delete(_ context.Context, key string) error {
+	if err := blob.CheckKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = blob.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete blob %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key)
+}
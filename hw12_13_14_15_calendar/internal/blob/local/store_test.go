@@ -0,0 +1,57 @@
+package localblob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	localblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/local"
+	"github.com/stretchr/testify/require"
+)
+
+var errBroken = errors.New("broken reader")
+
+type brokenReader struct{}
+
+func (brokenReader) Read([]byte) (int, error) {
+	return 0, errBroken
+}
+
+func TestStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "blobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := localblob.New(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	size, err := s.Put(ctx, "agenda", strings.NewReader("agenda of the meeting"))
+	require.NoError(t, err)
+	require.Equal(t, int64(21), size)
+	r, err := s.Get(ctx, "agenda")
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "agenda of the meeting", string(content))
+
+	_, err = s.Put(ctx, "slides", io.MultiReader(strings.NewReader("partial"), brokenReader{}))
+	require.ErrorIs(t, err, errBroken)
+	_, err = s.Get(ctx, "slides")
+	require.ErrorIs(t, err, blob.ErrNotFound)
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	for _, key := range []string{"", "../agenda", ".upload-1", "a/b"} {
+		_, err = s.Put(ctx, key, strings.NewReader("content"))
+		require.ErrorIs(t, err, blob.ErrInvalidKey)
+	}
+
+	require.NoError(t, s.Delete(ctx, "agenda"))
+	require.ErrorIs(t, s.Delete(ctx, "agenda"), blob.ErrNotFound)
+}
@@ -0,0 +1,55 @@
+package memoryblob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+)
+
+// Store keeps the content in memory, it is meant for tests and the memory storage.
+type Store struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func New() *Store {
+	return &Store{blobs: make(map[string][]byte)}
+}
+
+func (s *Store) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	if err := blob.CheckKey(key); err != nil {
+		return 0, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob %q: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = content
+	return int64(len(content)), nil
+}
+
+func (s *Store) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	content, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("failed to get blob %q: %w", key, blob.ErrNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *Store) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[key]; !ok {
+		return fmt.Errorf("failed to delete blob %q: %w", key, blob.ErrNotFound)
+	}
+	delete(s.blobs, key)
+	return nil
+}
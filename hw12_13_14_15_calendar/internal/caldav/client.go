@@ -0,0 +1,239 @@
+// Package caldav syncs the events of an owner with a calendar collection of a CalDAV server (RFC 4791).
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ical"
+)
+
+var (
+	// ErrPreconditionFailed is returned when the resource was changed or created by someone else
+	// since its ETag was read.
+	ErrPreconditionFailed = errors.New("caldav resource precondition failed")
+	ErrNotFound           = errors.New("caldav resource not found")
+)
+
+// maxResponseSize bounds the responses read into memory.
+const maxResponseSize = 16 << 20
+
+const (
+	ctagPropfind = `<?xml version="1.0" encoding="utf-8"?>` +
+		`<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><cs:getctag/></d:prop></d:propfind>`
+	etagPropfind = `<?xml version="1.0" encoding="utf-8"?>` +
+		`<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getetag/></d:prop></d:propfind>`
+)
+
+// Resource is a calendar object of the collection.
+type Resource struct {
+	// Href is the path of the resource on the server.
+	Href string
+	ETag string
+}
+
+// Client works with a single calendar collection.
+type Client struct {
+	http       *http.Client
+	collection *url.URL
+	username   string
+	password   string
+}
+
+// NewClient returns a client of the collection at the URL, an empty username disables basic authentication.
+func NewClient(httpClient *http.Client, collectionURL, username, password string) (*Client, error) {
+	u, err := url.Parse(collectionURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("collection URL %q is not an http(s) URL", collectionURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Client{http: httpClient, collection: u, username: username, password: password}, nil
+}
+
+// Href returns the path of a new resource of the collection named after the UID.
+func (c *Client) Href(uid string) string {
+	return path.Join(c.collection.EscapedPath(), url.PathEscape(uid)+".ics")
+}
+
+// CTag returns the tag of the collection which changes whenever any of its resources change.
+func (c *Client) CTag(ctx context.Context) (string, error) {
+	responses, err := c.propfind(ctx, c.collection.EscapedPath(), "0", ctagPropfind)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range responses {
+		if ctag := r.prop().CTag; ctag != "" {
+			return ctag, nil
+		}
+	}
+	return "", fmt.Errorf("collection %q has no ctag", c.collection)
+}
+
+// List returns the calendar objects of the collection with their ETags.
+func (c *Client) List(ctx context.Context) ([]Resource, error) {
+	responses, err := c.propfind(ctx, c.collection.EscapedPath(), "1", etagPropfind)
+	if err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	for _, r := range responses {
+		prop := r.prop()
+		if prop.ResourceType.Collection != nil {
+			continue
+		}
+		href, err := c.path(r.Href)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, Resource{Href: href, ETag: prop.ETag})
+	}
+	return resources, nil
+}
+
+// Get returns the object of the resource and its ETag.
+func (c *Client) Get(ctx context.Context, href string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, href, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %q: %w", href, err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Put stores the object. A non-empty ETag must match the stored resource, an empty one
+// only creates a new resource. The new ETag is empty when the server doesn't return it.
+func (c *Client) Put(ctx context.Context, href string, data []byte, etag string) (string, error) {
+	header := http.Header{"Content-Type": {ical.ContentType}}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := c.do(ctx, http.MethodPut, href, header, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete removes the resource if its ETag matches, a missing resource is not an error.
+func (c *Client) Delete(ctx context.Context, href, etag string) error {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	resp, err := c.do(ctx, http.MethodDelete, href, header, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ETag string `xml:"DAV: getetag"`
+	CTag string `xml:"http://calendarserver.org/ns/ getctag"`
+}
+
+// prop returns the properties found, the ones missing on the server are reported in other propstats.
+func (r response) prop() prop {
+	for _, ps := range r.Propstats {
+		if strings.Contains(ps.Status, " 200 ") {
+			return ps.Prop
+		}
+	}
+	return prop{}
+}
+
+func (c *Client) propfind(ctx context.Context, href, depth, body string) ([]response, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := c.do(ctx, "PROPFIND", href, header, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to decode properties of %q: %w", href, err)
+	}
+	return ms.Responses, nil
+}
+
+// path returns the path of a href of a multistatus response, which may be a full URL.
+func (c *Client) path(href string) (string, error) {
+	u, err := c.collection.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid href %q: %w", href, err)
+	}
+	return u.EscapedPath(), nil
+}
+
+// do sends the request to the href of the collection server and returns a successful response,
+// the caller closes its body.
+func (c *Client) do(ctx context.Context, method, href string, header http.Header, body []byte) (*http.Response, error) {
+	u, err := c.collection.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("invalid href %q: %w", href, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %q: %w", method, href, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPreconditionFailed:
+		return nil, fmt.Errorf("failed to %s %q: %w", method, href, ErrPreconditionFailed)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("failed to %s %q: %w", method, href, ErrNotFound)
+	default:
+		return nil, fmt.Errorf("failed to %s %q: unexpected status %s", method, href, resp.Status)
+	}
+}
@@ -0,0 +1,184 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn is an in-process CalDAV server with a single collection, it supports the requests
+// of the client only.
+type standIn struct {
+	*httptest.Server
+	collection string
+
+	mu      sync.Mutex
+	objects map[string]standInObject
+	ctag    int
+	etag    int
+	// requests counts the requests by method.
+	requests map[string]int
+	// failPuts makes the next puts fail with an internal server error.
+	failPuts int
+}
+
+type standInObject struct {
+	data []byte
+	etag string
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+	s := &standIn{collection: "/calendars/user/work/", objects: make(map[string]standInObject), requests: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *standIn) URL() string {
+	return s.Server.URL + s.collection
+}
+
+// put stores the object as if it was changed by another client.
+func (s *standIn) put(name string, data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store(s.collection+name, data)
+}
+
+func (s *standIn) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, s.collection+name)
+	s.ctag++
+}
+
+func (s *standIn) object(href string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[href]
+	return obj.data, ok
+}
+
+func (s *standIn) hrefs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hrefs := make([]string, 0, len(s.objects))
+	for href := range s.objects {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+	return hrefs
+}
+
+func (s *standIn) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+func (s *standIn) store(href string, data []byte) string {
+	s.etag++
+	s.ctag++
+	etag := fmt.Sprintf(`"%d"`, s.etag)
+	s.objects[href] = standInObject{data: data, etag: etag}
+	return etag
+}
+
+func (s *standIn) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.Method]++
+	if r.URL.Path == s.collection {
+		if r.Method != "PROPFIND" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.propfind(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, s.collection) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	obj, exists := s.objects[r.URL.Path]
+	if match := r.Header.Get("If-Match"); match != "" && (!exists || match != obj.etag) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", obj.etag)
+		_, _ = w.Write(obj.data)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if s.failPuts > 0 {
+			s.failPuts--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		w.Header().Set("ETag", s.store(r.URL.Path, data))
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		s.ctag++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *standIn) propfind(w http.ResponseWriter, r *http.Request) {
+	type prop struct {
+		ResourceType *struct {
+			Collection *struct{} `xml:"D:collection"`
+		} `xml:"D:resourcetype,omitempty"`
+		ETag string `xml:"D:getetag,omitempty"`
+		CTag string `xml:"CS:getctag,omitempty"`
+	}
+	type response struct {
+		Href   string `xml:"D:href"`
+		Prop   prop   `xml:"D:propstat>D:prop"`
+		Status string `xml:"D:propstat>D:status"`
+	}
+	type multistatus struct {
+		XMLName   xml.Name   `xml:"D:multistatus"`
+		DAV       string     `xml:"xmlns:D,attr"`
+		CS        string     `xml:"xmlns:CS,attr"`
+		Responses []response `xml:"D:response"`
+	}
+	ms := multistatus{DAV: "DAV:", CS: "http://calendarserver.org/ns/"}
+	collection := prop{ResourceType: &struct {
+		Collection *struct{} `xml:"D:collection"`
+	}{Collection: &struct{}{}}, CTag: fmt.Sprint(s.ctag)}
+	ms.Responses = append(ms.Responses, response{Href: s.collection, Prop: collection, Status: "HTTP/1.1 200 OK"})
+	if r.Header.Get("Depth") == "1" {
+		for href, obj := range s.objects {
+			// Servers may return full URLs.
+			ms.Responses = append(ms.Responses, response{
+				Href: "http://" + r.Host + href, Prop: prop{ETag: obj.etag}, Status: "HTTP/1.1 200 OK",
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_ = xml.NewEncoder(w).Encode(ms)
+}
@@ -0,0 +1,512 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ical"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AuditActor is recorded in the audit trail for the changes pulled from the server.
+const AuditActor = "caldav-sync"
+
+// changesBatch limits a single query of the change feed.
+const changesBatch = 100
+
+type SyncConfig struct {
+	// URL of the calendar collection, empty disables the sync.
+	URL      string
+	Username string
+	Password string
+	// OwnerID owns the synced events, the events pulled from the server are created for them.
+	OwnerID string
+	// Interval is how often the changes are pulled and pushed.
+	Interval time.Duration
+	// Timeout bounds a single request to the server.
+	Timeout time.Duration
+	// StateDir keeps the state of the sync between restarts. Empty StateDir keeps it in memory,
+	// then the events created on the server are pulled once more after a restart.
+	StateDir string
+}
+
+func (c SyncConfig) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	var v internalconfig.Validation
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Addf("url", "%q is not an http(s) URL", c.URL)
+	}
+	v.Required("ownerId", c.OwnerID)
+	v.Duration("interval", c.Interval)
+	v.Duration("timeout", c.Timeout)
+	return v.Err()
+}
+
+// syncState is what the last sync saw on both sides.
+type syncState struct {
+	// CTag of the collection, the resources are not listed while it is the same.
+	CTag string `json:"ctag"`
+	// Token of the last change of the owner's events pushed to the server.
+	Token int64 `json:"token"`
+	// Items are the synced resources by href.
+	Items map[string]syncItem `json:"items"`
+}
+
+type syncItem struct {
+	// EventID is empty for a resource which can't be stored as an event,
+	// it is pulled again when its ETag changes.
+	EventID string `json:"eventId,omitempty"`
+	UID     string `json:"uid"`
+	ETag    string `json:"etag"`
+	// Version of the event when it was synced, changes up to it are not pushed back.
+	Version int64 `json:"version"`
+}
+
+// Syncer keeps the events of an owner and a collection in sync. Every sync pushes the changes of the
+// change feed made since the last one and pulls the resources whose ETags changed, the resources are
+// listed only when the ctag of the collection changes. When an event is changed on both sides the
+// newest change by its LAST-MODIFIED wins, an edit wins over a removal. A Syncer is not safe for
+// concurrent use.
+type Syncer struct {
+	calendar *app.App
+	client   *Client
+	states   blob.Store
+	stateKey string
+	ownerID  string
+	interval time.Duration
+	clock    clock.Clock
+	state    *syncState
+}
+
+type Option func(*Syncer)
+
+// WithClock sets the clock of the sync loop, the system one by default.
+func WithClock(c clock.Clock) Option {
+	return func(s *Syncer) {
+		s.clock = c
+	}
+}
+
+// NewSyncer syncs the events of the owner with the collection of the client,
+// the state of the sync is kept in the states store.
+func NewSyncer(calendar *app.App, client *Client, states blob.Store, config SyncConfig, opts ...Option) *Syncer {
+	key := sha256.Sum256([]byte(config.OwnerID + "\n" + config.URL))
+	s := &Syncer{
+		calendar: calendar,
+		client:   client,
+		states:   states,
+		stateKey: fmt.Sprintf("caldav-%x", key[:16]),
+		ownerID:  config.OwnerID,
+		interval: config.Interval,
+		clock:    clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run syncs at once and then every interval until ctx is done, failed syncs are logged and retried.
+func (s *Syncer) Run(ctx context.Context) error {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		runCtx := logger.WithRequestID(ctx, logger.NewRequestID())
+		if err := s.Sync(runCtx); err != nil && ctx.Err() == nil {
+			logger.FromContext(runCtx).Errorf("caldav sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Sync pushes the local changes and pulls the remote ones once. The changes which fail are logged
+// and retried by the next sync, an error is returned when either side can't be read.
+func (s *Syncer) Sync(ctx context.Context) error {
+	ctx = storage.WithActor(ctx, AuditActor)
+	if s.state == nil {
+		state, err := s.load(ctx)
+		if err != nil {
+			return err
+		}
+		s.state = state
+	}
+	r := &round{Syncer: s, items: make(map[string]syncItem, len(s.state.Items))}
+	for href, item := range s.state.Items {
+		r.items[href] = item
+	}
+	token, local, err := r.localChanges(ctx)
+	if err != nil {
+		return err
+	}
+	ctag, remote, removed, err := r.remoteChanges(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.applyRemoved(ctx, removed, local)
+	r.push(ctx, local, remote)
+	r.pull(ctx, remote)
+
+	state := &syncState{CTag: ctag, Token: token, Items: r.items}
+	if r.retry {
+		// The changes are read again, the ones synced already are skipped by their versions and ETags.
+		state.CTag, state.Token = "", s.state.Token
+	}
+	s.state = state
+	return s.save(ctx)
+}
+
+func (s *Syncer) load(ctx context.Context) (*syncState, error) {
+	state := &syncState{Items: make(map[string]syncItem)}
+	rc, err := s.states.Get(ctx, s.stateKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load caldav sync state: %w", err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(state); err != nil {
+		return nil, fmt.Errorf("failed to decode caldav sync state: %w", err)
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]syncItem)
+	}
+	return state, nil
+}
+
+func (s *Syncer) save(ctx context.Context) error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	if _, err := s.states.Put(ctx, s.stateKey, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to save caldav sync state: %w", err)
+	}
+	return nil
+}
+
+// round is a single sync.
+type round struct {
+	*Syncer
+	items map[string]syncItem
+	// fetched are the objects got from the server by href.
+	fetched map[string]remoteObject
+	// retry is set when a change failed and has to be synced again.
+	retry bool
+}
+
+type remoteObject struct {
+	event storage.Event
+	uid   string
+	etag  string
+	err   error
+}
+
+// localChanges returns the last change of every event changed since the last sync, the changes
+// made by the sync itself are skipped.
+func (r *round) localChanges(ctx context.Context) (int64, []storage.Change, error) {
+	token, last, err := r.feedChanges(ctx)
+	if errors.Is(err, storage.ErrTokenExpired) {
+		token, last, err = r.currentEvents(ctx)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	synced := r.byEvent()
+	var local []storage.Change
+	for id, c := range last {
+		href, ok := synced[id]
+		if c.Type == storage.ChangeDeleted && !ok {
+			continue
+		}
+		if c.Type != storage.ChangeDeleted && ok && c.Event.Version <= r.items[href].Version {
+			continue
+		}
+		local = append(local, c)
+	}
+	sort.Slice(local, func(i, j int) bool { return local[i].Token < local[j].Token })
+	return token, local, nil
+}
+
+// feedChanges returns the token of the latest change and the last change of every event by ID
+// read from the feed since the last sync.
+func (r *round) feedChanges(ctx context.Context) (int64, map[string]storage.Change, error) {
+	token := r.state.Token
+	last := make(map[string]storage.Change)
+	for {
+		changes, err := r.calendar.Storage.GetChanges(ctx, r.ownerID, token, changesBatch)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to get changes: %w", err)
+		}
+		for _, c := range changes {
+			last[c.EventID] = c
+			token = c.Token
+		}
+		if len(changes) < changesBatch {
+			return token, last, nil
+		}
+	}
+}
+
+// currentEvents replaces the changes purged from the feed since the last sync, every event of the owner
+// is changed and every synced event gone is deleted. The token is read first, so the changes made
+// meanwhile are read again by the next sync.
+func (r *round) currentEvents(ctx context.Context) (int64, map[string]storage.Change, error) {
+	token, err := r.calendar.Storage.LastChangeToken(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get last change: %w", err)
+	}
+	events, err := r.calendar.Storage.GetOwnerEvents(ctx, r.ownerID, time.Time{}, time.Time{})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	last := make(map[string]storage.Change, len(events))
+	for _, e := range events {
+		last[e.ID] = storage.Change{Token: token, Type: storage.ChangeUpdated, EventID: e.ID, OwnerID: e.OwnerID, Event: e}
+	}
+	for _, item := range r.items {
+		if _, ok := last[item.EventID]; !ok && item.EventID != "" {
+			last[item.EventID] = storage.Change{Token: token, Type: storage.ChangeDeleted, EventID: item.EventID}
+		}
+	}
+	return token, last, nil
+}
+
+// remoteChanges returns the ctag of the collection, the new ETags of the changed resources by href
+// and the hrefs of the removed ones.
+func (r *round) remoteChanges(ctx context.Context) (string, map[string]string, []string, error) {
+	ctag, err := r.client.CTag(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	changed := make(map[string]string)
+	if ctag == r.state.CTag {
+		return ctag, changed, nil, nil
+	}
+	resources, err := r.client.List(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	listed := make(map[string]bool, len(resources))
+	for _, res := range resources {
+		listed[res.Href] = true
+		if item, ok := r.items[res.Href]; !ok || item.ETag != res.ETag || res.ETag == "" {
+			changed[res.Href] = res.ETag
+		}
+	}
+	var removed []string
+	for href, item := range r.items {
+		// A resource being created by a failed push isn't listed yet.
+		if !listed[href] && item.ETag != "" {
+			removed = append(removed, href)
+		}
+	}
+	sort.Strings(removed)
+	return ctag, changed, removed, nil
+}
+
+// byEvent returns the hrefs of the synced events.
+func (r *round) byEvent() map[string]string {
+	hrefs := make(map[string]string, len(r.items))
+	for href, item := range r.items {
+		if item.EventID != "" {
+			hrefs[item.EventID] = href
+		}
+	}
+	return hrefs
+}
+
+// applyRemoved removes the events of the resources removed on the server, an event changed
+// locally since the last sync is pushed again instead.
+func (r *round) applyRemoved(ctx context.Context, removed []string, local []storage.Change) {
+	changed := make(map[string]storage.ChangeType, len(local))
+	for _, c := range local {
+		changed[c.EventID] = c.Type
+	}
+	for _, href := range removed {
+		item := r.items[href]
+		switch t, ok := changed[item.EventID]; {
+		case ok && t != storage.ChangeDeleted:
+			item.ETag = ""
+			r.items[href] = item
+			continue
+		case item.EventID != "" && !ok:
+			err := r.calendar.RemoveEvent(ctx, item.EventID, item.Version)
+			if err != nil && !errors.Is(err, storage.ErrNotFoundEvent) {
+				logger.FromContext(ctx).Errorf("failed to remove event %q removed from %q: %v", item.EventID, href, err)
+				r.retry = true
+				continue
+			}
+		}
+		delete(r.items, href)
+	}
+}
+
+// push sends the local changes to the server. A resource changed on both sides is pushed when the local
+// change is newer, otherwise it is left to pull.
+func (r *round) push(ctx context.Context, local []storage.Change, remote map[string]string) {
+	hrefs := r.byEvent()
+	for _, c := range local {
+		href, synced := hrefs[c.EventID]
+		if c.Type == storage.ChangeDeleted {
+			r.pushRemoval(ctx, href, remote)
+			continue
+		}
+		item := r.items[href]
+		if !synced {
+			item = syncItem{UID: c.EventID}
+			href = r.client.Href(item.UID)
+		}
+		if etag, ok := remote[href]; ok {
+			obj := r.fetch(ctx, href, etag)
+			if obj.err == nil && obj.event.UpdatedAt.After(c.Event.UpdatedAt) {
+				// The pull replaces the local change.
+				item.EventID, item.Version = c.EventID, c.Event.Version
+				r.items[href] = item
+				continue
+			}
+			item.ETag = obj.etag
+			delete(remote, href)
+		}
+		r.pushEvent(ctx, href, item, c.Event)
+	}
+}
+
+func (r *round) pushRemoval(ctx context.Context, href string, remote map[string]string) {
+	item := r.items[href]
+	delete(r.items, href)
+	if _, ok := remote[href]; ok {
+		// The remote change wins, it is pulled as a new event.
+		return
+	}
+	if item.ETag == "" {
+		return
+	}
+	if err := r.client.Delete(ctx, href, item.ETag); err != nil {
+		logger.FromContext(ctx).Errorf("failed to delete %q of event %q: %v", href, item.EventID, err)
+		r.items[href] = item
+		r.retry = true
+	}
+}
+
+func (r *round) pushEvent(ctx context.Context, href string, item syncItem, e storage.Event) {
+	etag, err := r.client.Put(ctx, href, ical.Encode(e, item.UID), item.ETag)
+	if err == nil && etag == "" {
+		_, etag, err = r.client.Get(ctx, href)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to put event %q to %q: %v", e.ID, href, err)
+		r.retry = true
+		return
+	}
+	item.EventID, item.Version, item.ETag = e.ID, e.Version, etag
+	r.items[href] = item
+}
+
+// pull applies the changed resources to the events, the ones which can't be stored are skipped
+// until they change again.
+func (r *round) pull(ctx context.Context, remote map[string]string) {
+	hrefs := make([]string, 0, len(remote))
+	for href := range remote {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+	for _, href := range hrefs {
+		obj := r.fetch(ctx, href, remote[href])
+		item, ok := r.items[href]
+		if obj.err != nil {
+			logger.FromContext(ctx).Errorf("failed to pull %q: %v", href, obj.err)
+			if !errors.Is(obj.err, ical.ErrInvalidObject) {
+				r.retry = true
+				continue
+			}
+			item.ETag = obj.etag
+			r.items[href] = item
+			continue
+		}
+		if !ok {
+			item = r.match(ctx, obj.uid)
+		}
+		item.UID, item.ETag = obj.uid, obj.etag
+		if err := r.apply(ctx, &item, obj.event); err != nil {
+			logger.FromContext(ctx).Errorf("failed to apply %q to event %q: %v", href, item.EventID, err)
+			if errors.Is(err, storage.ErrVersionConflict) {
+				r.retry = true
+				continue
+			}
+		}
+		r.items[href] = item
+	}
+}
+
+// match links a resource pulled for the first time to the owner's event with the ID of its UID,
+// which is the case when the event was pushed by a sync whose state is lost.
+func (r *round) match(ctx context.Context, uid string) syncItem {
+	e, err := r.calendar.GetEvent(ctx, uid)
+	if err != nil || e.OwnerID != r.ownerID {
+		return syncItem{}
+	}
+	return syncItem{EventID: e.ID, Version: e.Version}
+}
+
+// apply updates the event of the item or creates a new one and records its version.
+func (r *round) apply(ctx context.Context, item *syncItem, e storage.Event) error {
+	e.OwnerID = r.ownerID
+	if item.EventID != "" {
+		version, err := r.calendar.UpdateEvent(ctx, item.EventID, e, item.Version)
+		if err == nil {
+			item.Version = version
+			return nil
+		}
+		if !errors.Is(err, storage.ErrNotFoundEvent) {
+			return err
+		}
+	}
+	created, err := r.calendar.CreateEvent(ctx, e)
+	if err != nil {
+		item.EventID, item.Version = "", 0
+		return err
+	}
+	item.EventID, item.Version = created.ID, created.Version
+	return nil
+}
+
+// fetch gets and decodes the resource once per round, the ETag of the listing is used
+// when the server doesn't return one.
+func (r *round) fetch(ctx context.Context, href, etag string) remoteObject {
+	if obj, ok := r.fetched[href]; ok {
+		return obj
+	}
+	data, got, err := r.client.Get(ctx, href)
+	obj := remoteObject{etag: etag, err: err}
+	if got != "" {
+		obj.etag = got
+	}
+	if err == nil {
+		obj.event, obj.uid, obj.err = ical.Decode(data)
+	}
+	if r.fetched == nil {
+		r.fetched = make(map[string]remoteObject)
+	}
+	r.fetched[href] = obj
+	return obj
+}
@@ -0,0 +1,319 @@
+package caldav
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	memoryblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/memory"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ical"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+const testOwner = "alice"
+
+var testNow = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+type syncTest struct {
+	t        *testing.T
+	clock    *clock.Fake
+	calendar *app.App
+	server   *standIn
+	states   *memoryblob.Store
+	syncer   *Syncer
+}
+
+func newSyncTest(t *testing.T) *syncTest {
+	t.Helper()
+	c := clock.NewFake(testNow)
+	st := &syncTest{
+		t:        t,
+		clock:    c,
+		calendar: app.New(memorystorage.New(memorystorage.WithClock(c)), app.WithClock(c)),
+		server:   newStandIn(t),
+		states:   memoryblob.New(),
+	}
+	st.syncer = st.newSyncer()
+	return st
+}
+
+func (st *syncTest) newSyncer() *Syncer {
+	st.t.Helper()
+	config := SyncConfig{URL: st.server.URL(), OwnerID: testOwner, Interval: time.Minute}
+	client, err := NewClient(http.DefaultClient, config.URL, "", "")
+	require.NoError(st.t, err)
+	return NewSyncer(st.calendar, client, st.states, config, WithClock(st.clock))
+}
+
+func (st *syncTest) sync() {
+	st.t.Helper()
+	require.NoError(st.t, st.syncer.Sync(context.Background()))
+}
+
+func (st *syncTest) create(title string) storage.Event {
+	st.t.Helper()
+	e, err := st.calendar.CreateEvent(context.Background(), newEvent(title))
+	require.NoError(st.t, err)
+	return e
+}
+
+// remote decodes the object of the event pushed to the server.
+func (st *syncTest) remote(id string) (storage.Event, bool) {
+	st.t.Helper()
+	data, ok := st.server.object(st.syncer.client.Href(id))
+	if !ok {
+		return storage.Event{}, false
+	}
+	e, uid, err := ical.Decode(data)
+	require.NoError(st.t, err)
+	require.Equal(st.t, id, uid)
+	return e, true
+}
+
+// events returns the active events of the owner.
+func (st *syncTest) events() []storage.Event {
+	st.t.Helper()
+	all, err := st.calendar.Storage.GetEventsForMonth(context.Background(), time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(st.t, err)
+	var events []storage.Event
+	for _, e := range all {
+		if e.OwnerID == testOwner {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func newEvent(title string) storage.Event {
+	return storage.Event{
+		Title:     title,
+		OwnerID:   testOwner,
+		StartTime: testNow.Add(48 * time.Hour),
+		EndTime:   testNow.Add(49 * time.Hour),
+	}
+}
+
+// remoteEvent returns an event changed on the server at the time.
+func remoteEvent(title string, modified time.Time) storage.Event {
+	e := newEvent(title)
+	e.UpdatedAt = modified
+	return e
+}
+
+func TestSyncPush(t *testing.T) {
+	ctx := context.Background()
+	st := newSyncTest(t)
+	e := st.create("review")
+	other := newEvent("not synced")
+	other.OwnerID = "bob"
+	_, err := st.calendar.CreateEvent(ctx, other)
+	require.NoError(t, err)
+
+	st.sync()
+	pushed, ok := st.remote(e.ID)
+	require.True(t, ok)
+	require.Equal(t, "review", pushed.Title)
+	require.Len(t, st.server.hrefs(), 1, "events of other owners are not pushed")
+
+	e.Title = "review v2"
+	_, err = st.calendar.UpdateEvent(ctx, e.ID, e, 0)
+	require.NoError(t, err)
+	st.sync()
+	pushed, _ = st.remote(e.ID)
+	require.Equal(t, "review v2", pushed.Title)
+
+	require.NoError(t, st.calendar.RemoveEvent(ctx, e.ID, 0))
+	st.sync()
+	require.Empty(t, st.server.hrefs())
+	require.Equal(t, 3, st.server.count(http.MethodPut)+st.server.count(http.MethodDelete))
+
+	st.sync()
+	require.Equal(t, 1, st.server.count(http.MethodDelete), "nothing is pushed without changes")
+	require.Equal(t, 2, st.server.count(http.MethodPut))
+}
+
+func TestSyncPull(t *testing.T) {
+	ctx := context.Background()
+	st := newSyncTest(t)
+	st.server.put("remote.ics", ical.Encode(remoteEvent("standup", testNow), "remote-1"))
+
+	st.sync()
+	events := st.events()
+	require.Len(t, events, 1)
+	require.Equal(t, "standup", events[0].Title)
+	history, err := st.calendar.GetEventHistory(ctx, events[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, AuditActor, history[0].Actor)
+
+	st.server.put("remote.ics", ical.Encode(remoteEvent("standup moved", testNow), "remote-1"))
+	lists := st.server.count("PROPFIND")
+	st.sync()
+	events = st.events()
+	require.Len(t, events, 1)
+	require.Equal(t, "standup moved", events[0].Title)
+
+	st.sync()
+	require.Equal(t, lists+3, st.server.count("PROPFIND"), "unchanged collection is not listed")
+
+	st.server.remove("remote.ics")
+	st.sync()
+	require.Empty(t, st.events())
+	require.Zero(t, st.server.count(http.MethodPut), "pulled changes are not pushed back")
+	require.Zero(t, st.server.count(http.MethodDelete))
+}
+
+func TestSyncConflicts(t *testing.T) {
+	ctx := context.Background()
+	for _, remoteNewer := range []bool{true, false} {
+		st := newSyncTest(t)
+		e := st.create("review")
+		st.sync()
+
+		st.clock.Advance(time.Minute)
+		e.Title = "local edit"
+		_, err := st.calendar.UpdateEvent(ctx, e.ID, e, 0)
+		require.NoError(t, err)
+		modified := testNow
+		if remoteNewer {
+			modified = testNow.Add(time.Hour)
+		}
+		st.server.put(e.ID+".ics", ical.Encode(remoteEvent("remote edit", modified), e.ID))
+
+		st.sync()
+		expected := "local edit"
+		if remoteNewer {
+			expected = "remote edit"
+		}
+		stored, err := st.calendar.GetEvent(ctx, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, expected, stored.Title, "remote newer %v", remoteNewer)
+		pushed, _ := st.remote(e.ID)
+		require.Equal(t, expected, pushed.Title, "remote newer %v", remoteNewer)
+	}
+}
+
+func TestSyncEditWinsOverRemoval(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("removed on the server", func(t *testing.T) {
+		st := newSyncTest(t)
+		e := st.create("review")
+		st.sync()
+		st.server.remove(e.ID + ".ics")
+		e.Title = "local edit"
+		_, err := st.calendar.UpdateEvent(ctx, e.ID, e, 0)
+		require.NoError(t, err)
+
+		st.sync()
+		pushed, ok := st.remote(e.ID)
+		require.True(t, ok, "the event is pushed again")
+		require.Equal(t, "local edit", pushed.Title)
+	})
+
+	t.Run("removed locally", func(t *testing.T) {
+		st := newSyncTest(t)
+		e := st.create("review")
+		st.sync()
+		require.NoError(t, st.calendar.RemoveEvent(ctx, e.ID, 0))
+		st.server.put(e.ID+".ics", ical.Encode(remoteEvent("remote edit", testNow), e.ID))
+
+		st.sync()
+		events := st.events()
+		require.Len(t, events, 1, "the event is pulled again")
+		require.Equal(t, "remote edit", events[0].Title)
+		_, ok := st.remote(e.ID)
+		require.True(t, ok)
+	})
+}
+
+func TestSyncRetry(t *testing.T) {
+	st := newSyncTest(t)
+	first := st.create("first")
+	second := st.create("second")
+	st.server.failPuts = 1
+
+	st.sync()
+	require.Len(t, st.server.hrefs(), 1)
+
+	st.sync()
+	for _, id := range []string{first.ID, second.ID} {
+		_, ok := st.remote(id)
+		require.True(t, ok)
+	}
+	require.Equal(t, 3, st.server.count(http.MethodPut), "the pushed event isn't pushed again")
+}
+
+func TestSyncExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	st := newSyncTest(t)
+	st.create("kept")
+	changed := st.create("changed")
+	removed := st.create("removed")
+	st.sync()
+
+	changed.Title = "changed v2"
+	_, err := st.calendar.UpdateEvent(ctx, changed.ID, changed, 0)
+	require.NoError(t, err)
+	require.NoError(t, st.calendar.RemoveEvent(ctx, removed.ID, 0))
+	added := st.create("added")
+	st.clock.Advance(time.Hour)
+	_, err = st.calendar.Storage.PurgeChanges(ctx, st.clock.Now())
+	require.NoError(t, err)
+
+	st.sync()
+	pushed, _ := st.remote(changed.ID)
+	require.Equal(t, "changed v2", pushed.Title)
+	_, ok := st.remote(removed.ID)
+	require.False(t, ok)
+	_, ok = st.remote(added.ID)
+	require.True(t, ok)
+	require.Equal(t, 5, st.server.count(http.MethodPut), "the events not changed aren't pushed again")
+
+	st.sync()
+	require.Equal(t, 5, st.server.count(http.MethodPut), "the sync resumes from the last change")
+	require.Equal(t, 1, st.server.count(http.MethodDelete))
+}
+
+func TestSyncState(t *testing.T) {
+	st := newSyncTest(t)
+	st.create("local")
+	st.server.put("remote.ics", ical.Encode(remoteEvent("remote", testNow), "remote-1"))
+	st.sync()
+	require.Len(t, st.events(), 2)
+
+	st.syncer = st.newSyncer()
+	st.sync()
+	require.Len(t, st.events(), 2, "the state is kept between syncers")
+	require.Equal(t, 1, st.server.count(http.MethodPut))
+}
+
+func TestSyncSkipsInvalidObjects(t *testing.T) {
+	st := newSyncTest(t)
+	st.server.put("broken.ics", []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	past := remoteEvent("past", testNow)
+	past.StartTime, past.EndTime = testNow.Add(-2*time.Hour), testNow.Add(-time.Hour)
+	st.server.put("past.ics", ical.Encode(past, "past"))
+
+	st.sync()
+	require.Empty(t, st.events())
+	gets := st.server.count(http.MethodGet)
+
+	st.server.put("new.ics", ical.Encode(remoteEvent("new", testNow), "new"))
+	st.sync()
+	require.Len(t, st.events(), 1)
+	require.Equal(t, gets+1, st.server.count(http.MethodGet), "the skipped objects are not pulled until changed")
+}
+
+func TestSyncConfigValidate(t *testing.T) {
+	require.NoError(t, SyncConfig{}.Validate(), "empty URL disables the sync")
+	err := SyncConfig{URL: "ftp://example.com"}.Validate()
+	require.Error(t, err)
+	for _, field := range []string{"url", "ownerId", "interval", "timeout"} {
+		require.Contains(t, err.Error(), field)
+	}
+}
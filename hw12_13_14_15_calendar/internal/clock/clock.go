@@ -0,0 +1,40 @@
+// Package clock abstracts the time, so the logic depending on it can be tested with a fake clock.
+package clock
+
+import "time"
+
+// Clock tells the current time and makes tickers.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker sending the time every period, see time.NewTicker.
+	NewTicker(period time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a clock, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	// Reset stops the ticker and starts counting the new period from now.
+	Reset(period time.Duration)
+	Stop()
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(period time.Duration) Ticker {
+	return realTicker{time.NewTicker(period)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
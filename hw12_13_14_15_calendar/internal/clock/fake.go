@@ -0,0 +1,109 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock standing still until it is moved by Advance or Set. Its tickers fire when the time
+// passes their next tick, a tick is dropped when the previous one isn't received yet, as time.Ticker does.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	tickers map[*fakeTicker]struct{}
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now, tickers: make(map[*fakeTicker]struct{})}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward and fires the tickers due.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to the time, a time before the current one only changes Now.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(now)
+}
+
+func (f *Fake) set(now time.Time) {
+	f.now = now
+	for t := range f.tickers {
+		if t.next.After(now) {
+			continue
+		}
+		select {
+		case t.c <- now:
+		default:
+		}
+		// The ticks missed in between are dropped.
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+func (f *Fake) NewTicker(period time.Duration) Ticker {
+	if period <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{clock: f, c: make(chan time.Time, 1), period: period, next: f.now.Add(period)}
+	f.tickers[t] = struct{}{}
+	f.changed.Broadcast()
+	return t
+}
+
+// WaitTickers blocks until the clock has n running tickers, so a test moves the clock
+// once the loop under test has started waiting for ticks.
+func (f *Fake) WaitTickers(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.tickers) != n {
+		f.changed.Wait()
+	}
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Reset(period time.Duration) {
+	if period <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.period, t.next = period, t.clock.now.Add(period)
+	t.clock.tickers[t] = struct{}{}
+	t.clock.changed.Broadcast()
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	delete(t.clock.tickers, t)
+	t.clock.changed.Broadcast()
+}
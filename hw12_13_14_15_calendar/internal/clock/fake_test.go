@@ -0,0 +1,47 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	require.Equal(t, start, c.Now())
+
+	ticker := c.NewTicker(time.Minute)
+	c.WaitTickers(1)
+	c.Advance(30 * time.Second)
+	require.Empty(t, ticker.C(), "the period hasn't passed")
+
+	c.Advance(30 * time.Second)
+	require.Equal(t, start.Add(time.Minute), <-ticker.C())
+
+	c.Advance(5 * time.Minute)
+	require.Equal(t, start.Add(6*time.Minute), <-ticker.C())
+	c.Advance(30 * time.Second)
+	require.Empty(t, ticker.C(), "the missed ticks are dropped")
+	c.Advance(30 * time.Second)
+	require.Len(t, ticker.C(), 1)
+	c.Advance(time.Minute)
+	require.Len(t, ticker.C(), 1, "a tick is dropped until the previous one is received")
+	<-ticker.C()
+
+	ticker.Reset(time.Hour)
+	c.Advance(time.Minute)
+	require.Empty(t, ticker.C(), "reset counts the new period from now")
+	c.Advance(time.Hour)
+	require.Len(t, ticker.C(), 1)
+	<-ticker.C()
+
+	ticker.Stop()
+	c.WaitTickers(0)
+	c.Advance(time.Hour)
+	require.Empty(t, ticker.C(), "stopped ticker doesn't fire")
+
+	c.Set(start)
+	require.Equal(t, start, c.Now())
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix marks values which are taken from the environment variable named after the prefix.
+const EnvPrefix = "$env:"
+
+var ErrInvalid = errors.New("invalid config")
+
+// ValidationError lists all the problems found in a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalid, strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// Validator is implemented by configs which check their values after loading.
+type Validator interface {
+	Validate() error
+}
+
+// Load reads the config file into config, which must be a pointer to a struct. Defaults are
+// applied to missing keys and "$env:NAME" values are taken from the environment. Unknown keys
+// are rejected, and the config is validated if it implements Validator.
+func Load(configFile string, defaults map[string]interface{}, config interface{}) error {
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config %q: %w", configFile, err)
+	}
+
+	var validation Validation
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := v.GetString(key)
+		if !strings.HasPrefix(value, EnvPrefix) {
+			continue
+		}
+		name := value[len(EnvPrefix):]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			validation.Addf(key, "environment variable %s is not set", name)
+			continue
+		}
+		v.Set(key, env)
+	}
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
+	// Decoding goes on after a bad key, so problems of the decoded values are reported too.
+	if err := v.UnmarshalExact(config); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return fmt.Errorf("unable to decode into config struct: %w", err)
+		}
+		for _, problem := range decodeErr.Errors {
+			validation.Addf("", "%s", problem)
+		}
+	}
+	if validator, ok := config.(Validator); ok {
+		validation.Check("", validator.Validate())
+	}
+	return validation.Err()
+}
+
+// Validation collects problems of a config, so all of them are reported at once.
+type Validation struct {
+	problems []string
+}
+
+// Addf adds a problem of the field, an empty field means the problem of the whole config.
+func (v *Validation) Addf(field, format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	if field != "" {
+		problem = field + ": " + problem
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// Check adds the error of the nested config, problems of a ValidationError are added one by one.
+func (v *Validation) Check(field string, err error) {
+	if err == nil {
+		return
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		v.Addf(field, "%s", err)
+		return
+	}
+	for _, problem := range validationErr.Problems {
+		if field != "" {
+			problem = field + "." + problem
+		}
+		v.problems = append(v.problems, problem)
+	}
+}
+
+func (v *Validation) Required(field, value string) {
+	if value == "" {
+		v.Addf(field, "is required")
+	}
+}
+
+func (v *Validation) Port(field string, port int) {
+	if port < 1 || port > 65535 {
+		v.Addf(field, "port %d is out of range 1-65535", port)
+	}
+}
+
+func (v *Validation) Positive(field string, value int) {
+	if value <= 0 {
+		v.Addf(field, "must be positive, got %d", value)
+	}
+}
+
+func (v *Validation) Duration(field string, value time.Duration) {
+	if value <= 0 {
+		v.Addf(field, "must be a positive duration, got %s", value)
+	}
+}
+
+func (v *Validation) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Addf(field, "unknown value %q, expected one of %s", value, strings.Join(allowed, ", "))
+}
+
+// Err returns a ValidationError of the collected problems or nil if there are none.
+func (v *Validation) Err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
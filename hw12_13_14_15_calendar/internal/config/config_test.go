@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	Host string
+	Port int
+}
+
+type testConfig struct {
+	HTTPServer testServer
+	Password   string
+	Timeout    time.Duration
+}
+
+func (c testConfig) Validate() error {
+	var v Validation
+	v.Required("httpServer.host", c.HTTPServer.Host)
+	v.Port("httpServer.port", c.HTTPServer.Port)
+	v.Duration("timeout", c.Timeout)
+	return v.Err()
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(data), 0o600))
+	return configFile
+}
+
+func TestLoad(t *testing.T) {
+	defaults := map[string]interface{}{"httpServer.host": "127.0.0.1", "timeout": "5s"}
+
+	t.Run("defaults and env", func(t *testing.T) {
+		require.NoError(t, os.Setenv("CONFIG_TEST_PASSWORD", "secret"))
+		defer os.Unsetenv("CONFIG_TEST_PASSWORD")
+		configFile := writeConfig(t, "httpServer:\n  port: 8005\npassword: $env:CONFIG_TEST_PASSWORD\n")
+
+		config := testConfig{}
+		require.NoError(t, Load(configFile, defaults, &config))
+		require.Equal(t, testConfig{
+			HTTPServer: testServer{Host: "127.0.0.1", Port: 8005},
+			Password:   "secret",
+			Timeout:    5 * time.Second,
+		}, config)
+	})
+
+	t.Run("all problems", func(t *testing.T) {
+		configFile := writeConfig(t, "httpServer:\n  port: 0\n  hots: localhost\n"+
+			"timeout: -1s\npassword: $env:CONFIG_TEST_UNSET\n")
+
+		err := Load(configFile, defaults, &testConfig{})
+		require.True(t, errors.Is(err, ErrInvalid))
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Equal(t, []string{"password: environment variable CONFIG_TEST_UNSET is not set"}, validationErr.Problems)
+
+		require.NoError(t, os.Setenv("CONFIG_TEST_UNSET", "secret"))
+		defer os.Unsetenv("CONFIG_TEST_UNSET")
+		err = Load(configFile, defaults, &testConfig{})
+		require.True(t, errors.As(err, &validationErr))
+		require.Len(t, validationErr.Problems, 3)
+		require.Contains(t, validationErr.Problems[0], "invalid keys: hots")
+		require.Equal(t, "httpServer.port: port 0 is out of range 1-65535", validationErr.Problems[1])
+		require.Equal(t, "timeout: must be a positive duration, got -1s", validationErr.Problems[2])
+	})
+}
+
+func TestValidationCheck(t *testing.T) {
+	var nested Validation
+	nested.OneOf("storageType", "sqll", "memory", "sql")
+
+	var v Validation
+	v.Check("storage", nested.Err())
+	v.Check("logger", errors.New("unknown level"))
+	v.Check("lifecycle", nil)
+	v.Positive("eventLimit", 0)
+	require.Equal(t, &ValidationError{Problems: []string{
+		`storage.storageType: unknown value "sqll", expected one of memory, sql`,
+		"logger: unknown level",
+		"eventLimit: must be positive, got 0",
+	}}, v.Err())
+}
+
+func TestPrint(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, Print(&b, testConfig{
+		HTTPServer: testServer{Host: "127.0.0.1", Port: 8005},
+		Password:   "secret",
+		Timeout:    time.Minute,
+	}))
+	require.Equal(t, `httpServer:
+  host: "127.0.0.1"
+  port: 8005
+password: "******"
+timeout: 1m0s
+`, b.String())
+
+	type user struct {
+		User   string
+		Bcrypt string
+	}
+	type listConfig struct {
+		OwnerID   string
+		Token     string
+		Users     []user
+		Passwords []user
+		Networks  []string
+	}
+	b.Reset()
+	require.NoError(t, Print(&b, listConfig{
+		OwnerID: "alice",
+		Users:   []user{{User: "alice", Bcrypt: "$2a$10$hash"}, {User: "bob"}},
+	}))
+	require.Equal(t, `ownerId: "alice"
+token: ""
+users:
+  - user: "alice"
+    bcrypt: "******"
+  - user: "bob"
+    bcrypt: ""
+passwords: []
+networks: []
+`, b.String(), "the secrets of the entries are masked, empty secrets are shown")
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// masked replaces values of secret fields in the printed config.
+const masked = "******"
+
+// secretFields are parts of field names whose values are not printed.
+var secretFields = []string{"password", "secret", "token", "bcrypt"}
+
+// Print writes the config struct as YAML with the keys used in config files, secrets are masked
+// unless they are empty.
+func Print(w io.Writer, config interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(config))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a struct", ErrInvalid, config)
+	}
+	var b strings.Builder
+	printStruct(&b, value, 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printStruct(b *strings.Builder, value reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := configKey(field.Name)
+		fieldValue := value.Field(i)
+		switch {
+		case isStruct(fieldValue):
+			fmt.Fprintf(b, "%s%s:\n", indent, key)
+			printStruct(b, fieldValue, depth+1)
+		case fieldValue.Kind() == reflect.Slice && fieldValue.Len() == 0:
+			fmt.Fprintf(b, "%s%s: []\n", indent, key)
+		case fieldValue.Kind() == reflect.Slice:
+			fmt.Fprintf(b, "%s%s:\n", indent, key)
+			printSlice(b, fieldValue, isSecret(field.Name), depth+1)
+		default:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, key, printedValue(fieldValue, isSecret(field.Name)))
+		}
+	}
+}
+
+// printSlice writes the items of the slice as a YAML list, the fields of a struct item
+// follow its dash.
+func printSlice(b *strings.Builder, value reflect.Value, secret bool, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+		if !isStruct(item) {
+			fmt.Fprintf(b, "%s- %s\n", indent, printedValue(item, secret))
+			continue
+		}
+		var fields strings.Builder
+		printStruct(&fields, item, depth+1)
+		b.WriteString(indent + "- " + strings.TrimPrefix(fields.String(), indent+"  "))
+	}
+}
+
+// printedValue formats the value, a secret one is masked unless it is empty.
+func printedValue(value reflect.Value, secret bool) string {
+	if secret && !value.IsZero() {
+		return strconv.Quote(masked)
+	}
+	return formatValue(value)
+}
+
+func isStruct(value reflect.Value) bool {
+	return value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{})
+}
+
+func formatValue(value reflect.Value) string {
+	switch v := value.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// configKey converts a field name to the key of config files, e.g. HTTPServer to httpServer.
+// The trailing ID is written as Id there, e.g. OwnerID is ownerId.
+func configKey(name string) string {
+	if strings.HasSuffix(name, "ID") && len(name) > len("ID") {
+		name = strings.TrimSuffix(name, "ID") + "Id"
+	}
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		// The last upper case letter of an acronym starts the next word.
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Watch calls reload when the process receives SIGHUP or the config file is changed
+// until ctx is done. Reloads are called one at a time.
+func Watch(ctx context.Context, configFile string, reload func()) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := make(chan struct{}, 1)
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	v.OnConfigChange(func(fsnotify.Event) {
+		// Editors often write a file several times, pending reload covers all of them.
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	v.WatchConfig()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload()
+		case <-changed:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("logger:\n  level: INFO\n"), 0o600))
+
+	// SIGHUP terminates the process until it is handled, so it is handled from the start.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGHUP)
+
+	reloads := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- Watch(ctx, configFile, func() { reloads <- struct{}{} })
+	}()
+
+	// The watcher and the signal handler are set up asynchronously.
+	require.Eventually(t, func() bool {
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+		select {
+		case <-reloads:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("logger:\n  level: DEBUG\n"), 0o600))
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		require.Fail(t, "config change is not detected")
+	}
+
+	cancel()
+	require.NoError(t, <-stopped)
+}
@@ -0,0 +1,389 @@
+// Package ical converts events to iCalendar objects (RFC 5545) and back. An object holds a single
+// VEVENT, recurrence rules are not supported and only the first occurrence of a recurring event is read.
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// ContentType is the media type of iCalendar objects.
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	prodID        = "-//hw-otus//calendar//EN"
+	dateLayout    = "20060102"
+	utcLayout     = "20060102T150405Z"
+	localLayout   = "20060102T150405"
+	maxLineOctets = 75
+	day           = 24 * time.Hour
+	// colorProperty keeps the color in the #rrggbb notation, the COLOR of RFC 7986 takes CSS color names.
+	colorProperty = "X-CALENDAR-COLOR"
+)
+
+var ErrInvalidObject = errors.New("invalid iCalendar object")
+
+// Encode returns the object of the event identified by the UID. The reminder becomes a display alarm.
+func Encode(e storage.Event, uid string) []byte {
+	var w writer
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", prodID)
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", escape(uid))
+	w.line("DTSTAMP", e.UpdatedAt.UTC().Format(utcLayout))
+	if !e.UpdatedAt.IsZero() {
+		w.line("LAST-MODIFIED", e.UpdatedAt.UTC().Format(utcLayout))
+	}
+	if e.AllDay {
+		w.line("DTSTART;VALUE=DATE", e.StartTime.Format(dateLayout))
+		w.line("DTEND;VALUE=DATE", e.EndTime.Format(dateLayout))
+	} else {
+		w.line("DTSTART", e.StartTime.UTC().Format(utcLayout))
+		w.line("DTEND", e.EndTime.UTC().Format(utcLayout))
+	}
+	w.line("SUMMARY", escape(e.Title))
+	if e.Description != "" {
+		w.line("DESCRIPTION", escape(e.Description))
+	}
+	if e.Location.Name != "" {
+		w.line("LOCATION", escape(e.Location.Name))
+	}
+	if geo := e.Location.Geo; geo != nil {
+		w.line("GEO", strconv.FormatFloat(geo.Latitude, 'f', -1, 64)+";"+strconv.FormatFloat(geo.Longitude, 'f', -1, 64))
+	}
+	if e.ConferenceURL != "" {
+		w.line("URL", e.ConferenceURL)
+	}
+	if len(e.Tags) > 0 {
+		tags := make([]string, 0, len(e.Tags))
+		for _, tag := range e.Tags {
+			tags = append(tags, escape(tag))
+		}
+		w.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	if e.Color != "" {
+		w.line(colorProperty, e.Color)
+	}
+	if e.NotifyBefore > 0 {
+		w.line("BEGIN", "VALARM")
+		w.line("ACTION", "DISPLAY")
+		w.line("DESCRIPTION", escape(e.Title))
+		w.line("TRIGGER", fmt.Sprintf("-P%dD", e.NotifyBefore))
+		w.line("END", "VALARM")
+	}
+	w.line("END", "VEVENT")
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// writer folds the content lines longer than 75 octets without splitting UTF-8 sequences.
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) line(name, value string) {
+	s := name + ":" + value
+	n := 0
+	for i := range s {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		if n+size > maxLineOctets {
+			w.buf.WriteString("\r\n ")
+			// The leading space of the continuation counts.
+			n = 1
+		}
+		w.buf.WriteString(s[i : i+size])
+		n += size
+	}
+	w.buf.WriteString("\r\n")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// property is a content line, parameter names are upper-cased.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode reads the first VEVENT of the object and returns the event with its UID. Times with a TZID
+// are taken in that zone and floating times in UTC, an event without an end lasts its DURATION,
+// a day if it is all-day or an hour otherwise. The reminder is the earliest alarm before the start
+// rounded up to days.
+func Decode(data []byte) (storage.Event, string, error) {
+	props, err := parse(data)
+	if err != nil {
+		return storage.Event{}, "", err
+	}
+	var (
+		e        storage.Event
+		uid      string
+		duration time.Duration
+		hasEnd   bool
+		depth    []string
+		found    bool
+	)
+	for _, p := range props {
+		switch p.name {
+		case "BEGIN":
+			depth = append(depth, strings.ToUpper(p.value))
+			continue
+		case "END":
+			if len(depth) == 0 || depth[len(depth)-1] != strings.ToUpper(p.value) {
+				return storage.Event{}, "", fmt.Errorf("%w: unexpected END:%s", ErrInvalidObject, p.value)
+			}
+			depth = depth[:len(depth)-1]
+			if strings.EqualFold(p.value, "VEVENT") {
+				found = true
+			}
+			continue
+		}
+		if found {
+			break
+		}
+		switch path := strings.Join(depth, "/"); path {
+		case "VCALENDAR/VEVENT/VALARM":
+			if p.name == "TRIGGER" {
+				e.NotifyBefore = maxInt32(e.NotifyBefore, alarmDays(p))
+			}
+			continue
+		case "VCALENDAR/VEVENT":
+		default:
+			continue
+		}
+		switch p.name {
+		case "UID":
+			uid = unescape(p.value)
+		case "DTSTART":
+			e.StartTime, e.AllDay, err = parseTime(p)
+		case "DTEND":
+			e.EndTime, _, err = parseTime(p)
+			hasEnd = true
+		case "DURATION":
+			duration, err = parseDuration(p.value)
+		case "LAST-MODIFIED":
+			e.UpdatedAt, _, err = parseTime(p)
+		case "SUMMARY":
+			e.Title = unescape(p.value)
+		case "DESCRIPTION":
+			e.Description = unescape(p.value)
+		case "LOCATION":
+			e.Location.Name = unescape(p.value)
+		case "GEO":
+			e.Location.Geo, err = parseGeo(p.value)
+		case "URL":
+			e.ConferenceURL = p.value
+		case "CATEGORIES":
+			e.Tags = append(e.Tags, splitList(p.value)...)
+		case colorProperty:
+			e.Color = p.value
+		}
+		if err != nil {
+			return storage.Event{}, "", fmt.Errorf("%w: %s: %v", ErrInvalidObject, p.name, err)
+		}
+	}
+	if !found {
+		return storage.Event{}, "", fmt.Errorf("%w: no VEVENT", ErrInvalidObject)
+	}
+	if uid == "" || e.StartTime.IsZero() {
+		return storage.Event{}, "", fmt.Errorf("%w: UID and DTSTART are required", ErrInvalidObject)
+	}
+	if !hasEnd {
+		switch {
+		case duration > 0:
+			e.EndTime = e.StartTime.Add(duration)
+		case e.AllDay:
+			e.EndTime = e.StartTime.AddDate(0, 0, 1)
+		default:
+			e.EndTime = e.StartTime.Add(time.Hour)
+		}
+	}
+	return e, uid, nil
+}
+
+func parse(data []byte) ([]property, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+	var props []property
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, p)
+	}
+	return props, nil
+}
+
+// parseLine splits "NAME;PARAM=VALUE:value", the colons and semicolons of quoted parameters are kept.
+func parseLine(line string) (property, error) {
+	p := property{params: make(map[string]string)}
+	quoted := false
+	start := 0
+	var fields []string
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == ';':
+			fields = append(fields, line[start:i])
+			start = i + 1
+		case r == ':':
+			fields = append(fields, line[start:i])
+			p.value = line[i+1:]
+			p.name = strings.ToUpper(fields[0])
+			for _, param := range fields[1:] {
+				name, value, _ := cut(param, "=")
+				p.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+			}
+			return p, nil
+		}
+	}
+	return property{}, fmt.Errorf("%w: line %q has no value", ErrInvalidObject, line)
+}
+
+// cut is strings.Cut, which is not available in Go 1.16.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// splitList splits a comma separated list of text values, escaped commas are kept in the values.
+func splitList(value string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescape(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescape(value[start:]))
+}
+
+// parseTime returns the time of a DATE or DATE-TIME value and whether it is a date.
+// Dates are returned as UTC midnights, the way all-day events are stored.
+func parseTime(p property) (time.Time, bool, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, p.value)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse(utcLayout, p.value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(localLayout, p.value, loc)
+	return t, false, err
+}
+
+// parseDuration parses the durations of RFC 5545 like "P1D", "-PT15M" or "P1W".
+func parseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+	units := map[byte]time.Duration{'W': 7 * day, 'D': day, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var d time.Duration
+	inTime := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		unit, ok := units[s[i]]
+		// M means months in the date part, which durations of RFC 5545 don't have.
+		if !ok || (s[i] == 'M' && !inTime) || (inTime && (s[i] == 'W' || s[i] == 'D')) {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * d, nil
+}
+
+// alarmDays returns the days an alarm goes before the start of the event, zero for the alarms
+// relative to the end or at an absolute time.
+func alarmDays(p property) int32 {
+	if p.params["VALUE"] == "DATE-TIME" || p.params["RELATED"] == "END" {
+		return 0
+	}
+	d, err := parseDuration(p.value)
+	if err != nil || d >= 0 {
+		return 0
+	}
+	return int32(math.Ceil(float64(-d) / float64(day)))
+}
+
+func parseGeo(value string) (*storage.GeoPoint, error) {
+	lat, lon, ok := cut(value, ";")
+	if !ok {
+		return nil, fmt.Errorf("invalid coordinates %q", value)
+	}
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", lat)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", lon)
+	}
+	return &storage.GeoPoint{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func maxInt32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,125 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := map[string]storage.Event{
+		"timed": {
+			Title:        "review; part 1, draft",
+			StartTime:    start,
+			EndTime:      start.Add(90 * time.Minute),
+			Description:  "line one\nline two with a \\ backslash " + strings.Repeat("долгое описание ", 10),
+			NotifyBefore: 2,
+			UpdatedAt:    start.Add(-time.Hour),
+			Tags:         []string{"work", "a,b"},
+			Color:        "#ff8800",
+			Location: storage.Location{
+				Name: "Room 1",
+				Geo:  &storage.GeoPoint{Latitude: 55.75, Longitude: -37.62},
+			},
+			ConferenceURL: "https://meet.example.com/abc",
+		},
+		"all day": {
+			Title:     "holiday",
+			StartTime: time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC),
+			AllDay:    true,
+			UpdatedAt: start,
+		},
+	}
+	for name, e := range events {
+		e := e
+		t.Run(name, func(t *testing.T) {
+			data := Encode(e, "uid-1@example.com")
+			for _, line := range strings.Split(string(data), "\r\n") {
+				require.LessOrEqual(t, len(line), maxLineOctets)
+			}
+
+			decoded, uid, err := Decode(data)
+			require.NoError(t, err)
+			require.Equal(t, "uid-1@example.com", uid)
+			require.Equal(t, e, decoded)
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Moscow",
+		"BEGIN:STANDARD",
+		"DTSTART:19700101T000000",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:abc",
+		"DTSTART;TZID=\"Europe/Moscow\":20221010T100000",
+		"DURATION:PT1H30M",
+		"SUMMARY:Long ",
+		" folded\\, title",
+		"CATEGORIES:one,two",
+		"CATEGORIES:three",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"TRIGGER;RELATED=END:-P3D",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:second",
+		"DTSTART:20221011T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	e, uid, err := Decode([]byte(data))
+	require.NoError(t, err)
+	require.Equal(t, "abc", uid)
+	require.Equal(t, "Long folded, title", e.Title)
+	require.Equal(t, time.Date(2022, 10, 10, 7, 0, 0, 0, time.UTC), e.StartTime.UTC())
+	require.Equal(t, 90*time.Minute, e.EndTime.Sub(e.StartTime))
+	require.Equal(t, []string{"one", "two", "three"}, e.Tags)
+	require.Equal(t, int32(1), e.NotifyBefore, "the alarm is rounded up to a day, the one relative to the end is ignored")
+
+	e, _, err = Decode(calendar("BEGIN:VEVENT\nUID:x\nDTSTART;VALUE=DATE:20221010\nEND:VEVENT\n"))
+	require.NoError(t, err)
+	require.True(t, e.AllDay)
+	require.Equal(t, time.Date(2022, 10, 11, 0, 0, 0, 0, time.UTC), e.EndTime, "an all-day event takes a day")
+}
+
+// calendar wraps the lines into a VCALENDAR.
+func calendar(lines string) []byte {
+	return []byte("BEGIN:VCALENDAR\n" + lines + "END:VCALENDAR\n")
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	// The tests are the lines of the calendar.
+	tests := map[string]string{
+		"no event":     "",
+		"no start":     "BEGIN:VEVENT\nUID:x\nEND:VEVENT\n",
+		"no uid":       "BEGIN:VEVENT\nDTSTART:20221010T100000Z\nEND:VEVENT\n",
+		"no value":     "BEGIN:VEVENT\nUID\nEND:VEVENT\n",
+		"bad nesting":  "BEGIN:VEVENT\n",
+		"bad time":     "BEGIN:VEVENT\nUID:x\nDTSTART:2022-10-10\nEND:VEVENT\n",
+		"unknown zone": "BEGIN:VEVENT\nUID:x\nDTSTART;TZID=Mars:20221010T100000\nEND:VEVENT\n",
+		"bad duration": "BEGIN:VEVENT\nUID:x\nDTSTART:20221010T100000Z\nDURATION:P1M\nEND:VEVENT\n",
+	}
+	for name, data := range tests {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Decode(calendar(data))
+			require.ErrorIs(t, err, ErrInvalidObject)
+		})
+	}
+}
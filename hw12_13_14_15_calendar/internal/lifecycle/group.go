@@ -0,0 +1,113 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrShutdownTimeout = errors.New("shutdown deadline exceeded")
+
+// DefaultShutdownTimeout is used when the config has no timeout.
+const DefaultShutdownTimeout = 10 * time.Second
+
+type Config struct {
+	// ShutdownTimeout bounds draining of in-flight work and closing of the components.
+	ShutdownTimeout time.Duration
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	if c.ShutdownTimeout < 0 {
+		v.Addf("shutdownTimeout", "must not be negative, got %s", c.ShutdownTimeout)
+	}
+	return v.Err()
+}
+
+// RunFunc runs the component until ctx is done or the component fails.
+type RunFunc func(ctx context.Context) error
+
+// StopFunc stops the component, it should return once in-flight work is drained or ctx is done.
+type StopFunc func(ctx context.Context) error
+
+type component struct {
+	name string
+	run  RunFunc
+	stop StopFunc
+}
+
+// Group runs components together. The first failure stops all of them. Components are
+// stopped one by one in the reverse order of adding, the next one is stopped only when
+// the run of the previous one has returned, so dependencies should be added first.
+type Group struct {
+	timeout    time.Duration
+	components []component
+}
+
+func New(config Config) *Group {
+	timeout := config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	return &Group{timeout: timeout}
+}
+
+// Add registers a component, either of run and stop may be nil.
+func (g *Group) Add(name string, run RunFunc, stop StopFunc) {
+	g.components = append(g.components, component{name: name, run: run, stop: stop})
+}
+
+// Run starts the components and blocks until ctx is done or any of them fails.
+// Then it stops the components within the shutdown timeout and returns the first failure.
+func (g *Group) Run(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() { firstErr = err })
+		cancel()
+	}
+	done := make([]chan struct{}, len(g.components))
+	for i, c := range g.components {
+		done[i] = make(chan struct{})
+		if c.run == nil {
+			close(done[i])
+			continue
+		}
+		go func(c component, done chan struct{}) {
+			defer close(done)
+			if err := c.run(runCtx); err != nil {
+				log.Errorf("%s failed: %v", c.name, err)
+				fail(fmt.Errorf("%s: %w", c.name, err))
+			}
+		}(c, done[i])
+	}
+	<-runCtx.Done()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), g.timeout)
+	defer stopCancel()
+	for i := len(g.components) - 1; i >= 0; i-- {
+		c := g.components[i]
+		if c.stop != nil {
+			if err := c.stop(stopCtx); err != nil {
+				log.Errorf("failed to stop %s: %v", c.name, err)
+			}
+		}
+		select {
+		case <-done[i]:
+		case <-stopCtx.Done():
+			log.Errorf("%s is not stopped in %s", c.name, g.timeout)
+			fail(ErrShutdownTimeout)
+		}
+	}
+	return firstErr
+}
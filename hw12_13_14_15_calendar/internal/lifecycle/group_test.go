@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	t.Run("stop in reverse order", func(t *testing.T) {
+		var mu sync.Mutex
+		var stopped []string
+		stop := func(name string) StopFunc {
+			return func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				stopped = append(stopped, name)
+				return nil
+			}
+		}
+		g := New(Config{})
+		g.Add("storage", nil, stop("storage"))
+		g.Add("server", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, stop("server"))
+		g.Add("consumer", func(ctx context.Context) error {
+			<-ctx.Done()
+			// In-flight work is finished before the dependencies are stopped.
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, "consumer")
+			return nil
+		}, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(t, g.Run(ctx))
+		require.Equal(t, []string{"consumer", "server", "storage"}, stopped)
+	})
+
+	t.Run("first failure stops others", func(t *testing.T) {
+		errFailed := errors.New("failed")
+		g := New(Config{})
+		g.Add("failing", func(ctx context.Context) error {
+			return errFailed
+		}, nil)
+		g.Add("second failing", func(ctx context.Context) error {
+			<-ctx.Done()
+			return errors.New("stopped")
+		}, nil)
+
+		err := g.Run(context.Background())
+		require.ErrorIs(t, err, errFailed)
+	})
+
+	t.Run("shutdown timeout", func(t *testing.T) {
+		g := New(Config{ShutdownTimeout: 10 * time.Millisecond})
+		release := make(chan struct{})
+		defer close(release)
+		g.Add("stuck", func(ctx context.Context) error {
+			<-release
+			return nil
+		}, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.ErrorIs(t, g.Run(ctx), ErrShutdownTimeout)
+	})
+}
@@ -1,21 +1,139 @@
 package logger
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 )
 
+var ErrUnknownFormat = errors.New("unknown log format")
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	// RequestIDField is the log field holding the request ID.
+	RequestIDField = "requestId"
+)
+
 type Config struct {
 	Level string
+	// Format is either text or json.
+	Format string
+	// Output is stdout, stderr or a path of the file to append logs to.
+	Output   string
+	Sampling SamplingConfig
 }
 
+// output is the log file opened by PrepareLogger, it is closed when the output is replaced.
+var (
+	outputMu sync.Mutex
+	output   io.Closer
+)
+
+// Validate checks the config without applying it.
+func (c Config) Validate() error {
+	if _, err := log.ParseLevel(c.Level); err != nil {
+		return fmt.Errorf("fialed to parse logger levev: %w", err)
+	}
+	if _, err := newFormatter(c.Format); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PrepareLogger configures the standard logger, it may be called again to apply a new config.
 func PrepareLogger(config Config) error {
-	level, err := log.ParseLevel(config.Level)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	level, _ := log.ParseLevel(config.Level)
+	formatter, _ := newFormatter(config.Format)
+	out, err := openOutput(config.Output)
 	if err != nil {
-		return fmt.Errorf("fialed to parse logger levev: %w", err)
+		return err
+	}
+	if config.Sampling.enabled() {
+		formatter = newSamplingFormatter(formatter, config.Sampling)
 	}
 	log.SetLevel(level)
+	log.SetFormatter(formatter)
+	log.SetOutput(out)
 
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if output != nil {
+		output.Close()
+	}
+	output = nil
+	if f, ok := out.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		output = f
+	}
 	return nil
 }
+
+func newFormatter(format string) (log.Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return &log.TextFormatter{}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// openOutput opens the log output, the file stays open until the output is replaced.
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		return f, nil
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request being processed.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID of the context or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// FromContext returns a logger annotated with the request ID of the context.
+func FromContext(ctx context.Context) *log.Entry {
+	entry := log.NewEntry(log.StandardLogger())
+	if id := RequestIDFromContext(ctx); id != "" {
+		entry = entry.WithField(RequestIDField, id)
+	}
+	return entry
+}
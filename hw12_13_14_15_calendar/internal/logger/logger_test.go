@@ -1,7 +1,75 @@
 package logger
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
 
 func TestLogger(t *testing.T) {
-	// TODO
+	t.Run("invalid config", func(t *testing.T) {
+		require.Error(t, PrepareLogger(Config{Level: "LOUD"}))
+		require.ErrorIs(t, PrepareLogger(Config{Level: "INFO", Format: "xml"}), ErrUnknownFormat)
+	})
+
+	t.Run("json to file", func(t *testing.T) {
+		defer resetLogger()
+		output := filepath.Join(t.TempDir(), "calendar.log")
+		require.NoError(t, PrepareLogger(Config{Level: "INFO", Format: FormatJSON, Output: output}))
+		_, ok := log.StandardLogger().Formatter.(*log.JSONFormatter)
+		require.True(t, ok)
+	})
+
+	t.Run("request id", func(t *testing.T) {
+		defer resetLogger()
+		buf := &bytes.Buffer{}
+		log.SetFormatter(&log.JSONFormatter{})
+		log.SetOutput(buf)
+
+		ctx := WithRequestID(context.Background(), "42")
+		require.Equal(t, "42", RequestIDFromContext(ctx))
+		FromContext(ctx).Warn("message")
+
+		var entry map[string]string
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		require.Equal(t, "42", entry[RequestIDField])
+		require.Equal(t, "message", entry["msg"])
+		require.NotEqual(t, NewRequestID(), NewRequestID())
+	})
+}
+
+func TestSampling(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newSamplingFormatter(&log.TextFormatter{}, SamplingConfig{Initial: 2, Thereafter: 3})
+	f.now = func() time.Time { return now }
+
+	written := func(level log.Level, message string) bool {
+		data, err := f.Format(&log.Entry{Logger: log.New(), Level: level, Message: message})
+		require.NoError(t, err)
+		return len(data) > 0
+	}
+
+	var sampled []bool
+	for i := 0; i < 6; i++ {
+		sampled = append(sampled, written(log.InfoLevel, "repeated"))
+	}
+	require.Equal(t, []bool{true, true, false, false, true, false}, sampled)
+	require.True(t, written(log.InfoLevel, "another"))
+	require.True(t, written(log.ErrorLevel, "repeated"))
+
+	now = now.Add(time.Second)
+	require.True(t, written(log.InfoLevel, "repeated"))
+}
+
+func resetLogger() {
+	log.SetFormatter(&log.TextFormatter{})
+	log.SetOutput(os.Stdout)
+	log.SetLevel(log.WarnLevel)
 }
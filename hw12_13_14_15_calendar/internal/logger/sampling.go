@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// samplingTick is the period the sampling counters are reset after.
+const samplingTick = time.Second
+
+// SamplingConfig limits repeated info and debug messages. Every tick the first Initial entries
+// with the same level and message are logged and then only every Thereafter-th of them.
+// Warnings and errors are never dropped.
+type SamplingConfig struct {
+	Initial    int
+	Thereafter int
+}
+
+func (c SamplingConfig) enabled() bool {
+	return c.Initial > 0
+}
+
+type samplingKey struct {
+	level   log.Level
+	message string
+}
+
+type samplingFormatter struct {
+	next       log.Formatter
+	initial    int
+	thereafter int
+	now        func() time.Time
+
+	mu     sync.Mutex
+	tick   time.Time
+	counts map[samplingKey]int
+}
+
+func newSamplingFormatter(next log.Formatter, config SamplingConfig) *samplingFormatter {
+	return &samplingFormatter{
+		next:       next,
+		initial:    config.Initial,
+		thereafter: config.Thereafter,
+		now:        time.Now,
+		counts:     make(map[samplingKey]int),
+	}
+}
+
+// Format returns no bytes for dropped entries, so nothing is written for them.
+func (f *samplingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if entry.Level <= log.WarnLevel || f.sample(samplingKey{level: entry.Level, message: entry.Message}) {
+		return f.next.Format(entry)
+	}
+	return nil, nil
+}
+
+func (f *samplingFormatter) sample(key samplingKey) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if now.Sub(f.tick) >= samplingTick {
+		f.tick = now
+		f.counts = make(map[samplingKey]int)
+	}
+	f.counts[key]++
+	n := f.counts[key]
+	if n <= f.initial {
+		return true
+	}
+	return f.thereafter > 0 && (n-f.initial)%f.thereafter == 0
+}
@@ -0,0 +1,465 @@
+// Package quickadd turns a short English or Russian text like "Lunch with Anna tomorrow 13:00-14:00
+// remind 1d" into an event.
+package quickadd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrInvalidText = errors.New("invalid quick-add text")
+
+// DefaultDuration is the duration of an event with a start time only.
+const DefaultDuration = time.Hour
+
+var (
+	clockPattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	rangePattern    = regexp.MustCompile(`^(\d{1,2}(?::\d{2})?(?:am|pm)?)[-–](\d{1,2}(?::\d{2})?(?:am|pm)?)$`)
+	isoDatePattern  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	dotDatePattern  = regexp.MustCompile(`^(\d{1,2})[./](\d{1,2})(?:[./](\d{4}))?$`)
+	dayPattern      = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+	yearPattern     = regexp.MustCompile(`^\d{4}$`)
+	numberPattern   = regexp.MustCompile(`^\d+$`)
+	compactPattern  = regexp.MustCompile(`^(?:\d+[^\d]+)+$`)
+	compactUnitPart = regexp.MustCompile(`(\d+)([^\d]+)`)
+)
+
+// clock is a time of day.
+type clock struct {
+	minutes int
+	// meridiem is "am" or "pm" when the time is given in the 12-hour notation.
+	meridiem string
+}
+
+// parser collects the parts of the event recognized in the words of the text,
+// the words that are not recognized make the title.
+type parser struct {
+	now   time.Time
+	today time.Time
+	// words are the normalized words of the text, original ones go to the title.
+	words    []string
+	original []string
+	title    []string
+
+	date    *time.Time
+	start   *clock
+	end     *clock
+	at      *time.Time
+	length  *time.Duration
+	remind  *time.Duration
+	weekday bool
+}
+
+// Parse returns the event described by the text. Relative dates and times are resolved against now
+// and the times are taken in its location. A text with a date only makes an all-day event, the time
+// without a date is today's or tomorrow's one when it has passed, a weekday is the nearest one.
+//
+// The reminder is stored in NotifyBefore, it must be whole days, the unit the storages notify in.
+func Parse(text string, now time.Time) (storage.Event, error) {
+	p := &parser{now: now, today: midnight(now)}
+	for _, word := range strings.Fields(text) {
+		p.original = append(p.original, word)
+		p.words = append(p.words, strings.TrimRight(strings.ToLower(word), ",;!?."))
+	}
+	for i := 0; i < len(p.words); {
+		n, err := p.match(i)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		if n == 0 {
+			p.title = append(p.title, p.original[i])
+			n = 1
+		}
+		i += n
+	}
+	return p.event()
+}
+
+// match recognizes a part of the event at the word i and returns the number of words it takes.
+func (p *parser) match(i int) (int, error) {
+	for _, m := range [...]func(int) (int, error){p.reminder, p.duration, p.relative, p.timeRange, p.onDate} {
+		if n, err := m(i); err != nil || n > 0 {
+			return n, err
+		}
+	}
+	return 0, nil
+}
+
+func (p *parser) word(i int) string {
+	if i < len(p.words) {
+		return p.words[i]
+	}
+	return ""
+}
+
+// reminder matches "remind [me] DURATION [before]".
+func (p *parser) reminder(i int) (int, error) {
+	if !remindWords[p.word(i)] {
+		return 0, nil
+	}
+	j := i + 1
+	for remindFillers[p.word(j)] {
+		j++
+	}
+	d, n := p.durationAt(j)
+	if n == 0 {
+		return 0, nil
+	}
+	j += n
+	if remindTails[p.word(j)] {
+		j++
+	}
+	if p.remind != nil {
+		return 0, duplicate("reminder")
+	}
+	p.remind = &d
+	return j - i, nil
+}
+
+// duration matches "for DURATION".
+func (p *parser) duration(i int) (int, error) {
+	if !durationWords[p.word(i)] {
+		return 0, nil
+	}
+	d, n := p.durationAt(i + 1)
+	if n == 0 {
+		return 0, nil
+	}
+	if p.length != nil {
+		return 0, duplicate("duration")
+	}
+	p.length = &d
+	return n + 1, nil
+}
+
+// relative matches "in DURATION", whole days make a date and shorter durations the start time.
+func (p *parser) relative(i int) (int, error) {
+	if !relativeWords[p.word(i)] {
+		return 0, nil
+	}
+	d, n := p.durationAt(i + 1)
+	if n == 0 {
+		return 0, nil
+	}
+	if d%day == 0 {
+		if p.date != nil {
+			return 0, duplicate("date")
+		}
+		date := p.today.AddDate(0, 0, int(d/day))
+		p.date = &date
+		return n + 1, nil
+	}
+	if p.at != nil {
+		return 0, duplicate("time")
+	}
+	start := p.now.Add(d).Truncate(time.Minute)
+	p.at = &start
+	return n + 1, nil
+}
+
+// timeRange matches "[at] TIME [- TIME]" and "TIME-TIME".
+func (p *parser) timeRange(i int) (int, error) {
+	j := i
+	bare := timePrepositions[p.word(j)]
+	if bare {
+		j++
+	}
+	var start, end clock
+	hasEnd := false
+	if m := rangePattern.FindStringSubmatch(p.word(j)); m != nil {
+		// Both sides of "13-14" are bare hours, they make a range after a preposition only.
+		var ok bool
+		if start, ok = parseClock(m[1], "", bare || !numberPattern.MatchString(m[1]+m[2])); !ok {
+			return 0, nil
+		}
+		if end, ok = parseClock(m[2], "", true); !ok {
+			return 0, nil
+		}
+		hasEnd = true
+		j++
+	} else {
+		n := 0
+		if start, n = p.clockAt(j, bare); n == 0 {
+			return 0, nil
+		}
+		j += n
+		if rangeSeparators[p.word(j)] {
+			if end, n = p.clockAt(j+1, true); n > 0 {
+				hasEnd = true
+				j += n + 1
+			}
+		}
+	}
+	// A start without the meridiem takes the one of the end, like "1-2pm".
+	if hasEnd && start.meridiem == "" && end.meridiem == "pm" && start.minutes+12*60 <= end.minutes {
+		start.minutes += 12 * 60
+	}
+	if p.start != nil {
+		return 0, duplicate("time")
+	}
+	p.start = &start
+	if hasEnd {
+		p.end = &end
+	}
+	return j - i, nil
+}
+
+// clockAt parses the time at the word i, a bare hour without minutes or meridiem is a time only when allowed.
+func (p *parser) clockAt(i int, bare bool) (clock, int) {
+	if noonWords[p.word(i)] {
+		return clock{minutes: 12 * 60}, 1
+	}
+	if next := p.word(i + 1); next == "am" || next == "pm" {
+		if c, ok := parseClock(p.word(i), next, true); ok {
+			return c, 2
+		}
+	}
+	if c, ok := parseClock(p.word(i), "", bare); ok {
+		return c, 1
+	}
+	return clock{}, 0
+}
+
+func parseClock(s, meridiem string, bare bool) (clock, bool) {
+	m := clockPattern.FindStringSubmatch(s)
+	if m == nil {
+		return clock{}, false
+	}
+	if m[3] != "" {
+		if meridiem != "" {
+			return clock{}, false
+		}
+		meridiem = m[3]
+	}
+	if m[2] == "" && meridiem == "" && !bare {
+		return clock{}, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	if minute > 59 {
+		return clock{}, false
+	}
+	switch {
+	case meridiem == "":
+		if hour > 23 {
+			return clock{}, false
+		}
+	case hour < 1 || hour > 12:
+		return clock{}, false
+	case meridiem == "am":
+		hour %= 12
+	default:
+		hour = hour%12 + 12
+	}
+	return clock{minutes: hour*60 + minute, meridiem: meridiem}, true
+}
+
+// onDate matches "[on] DATE".
+func (p *parser) onDate(i int) (int, error) {
+	j := i
+	if datePrepositions[p.word(j)] {
+		j++
+	}
+	date, weekday, n := p.dateAt(j)
+	if n == 0 {
+		return 0, nil
+	}
+	if p.date != nil {
+		return 0, duplicate("date")
+	}
+	p.date, p.weekday = &date, weekday
+	return j + n - i, nil
+}
+
+// dateAt parses the date at the word i and reports whether it is a weekday.
+func (p *parser) dateAt(i int) (time.Time, bool, int) {
+	w := p.word(i)
+	if days, ok := relativeDays[w]; ok {
+		return p.today.AddDate(0, 0, days), false, 1
+	}
+	if w == "day" && p.word(i+1) == "after" && p.word(i+2) == "tomorrow" {
+		return p.today.AddDate(0, 0, 2), false, 3
+	}
+	j := i
+	if nextWords[w] {
+		j++
+	}
+	if weekday, ok := weekdays[p.word(j)]; ok {
+		days := (int(weekday) - int(p.today.Weekday()) + 7) % 7
+		return p.today.AddDate(0, 0, days), true, j + 1 - i
+	}
+	if m := isoDatePattern.FindStringSubmatch(w); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		mday, _ := strconv.Atoi(m[3])
+		if date, ok := p.makeDate(year, time.Month(month), mday); ok {
+			return date, false, 1
+		}
+		return time.Time{}, false, 0
+	}
+	if m := dotDatePattern.FindStringSubmatch(w); m != nil {
+		mday, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		if date, ok := p.makeDate(year, time.Month(month), mday); ok {
+			return date, false, 1
+		}
+		return time.Time{}, false, 0
+	}
+	// "25 october [2026]" and "october 25 [2026]".
+	mday, month, n := 0, time.Month(0), 0
+	if m := dayPattern.FindStringSubmatch(w); m != nil {
+		if month = months[p.word(i+1)]; month != 0 {
+			mday, _ = strconv.Atoi(m[1])
+			n = 2
+		}
+	} else if month = months[w]; month != 0 {
+		if m := dayPattern.FindStringSubmatch(p.word(i + 1)); m != nil {
+			mday, _ = strconv.Atoi(m[1])
+			n = 2
+		}
+	}
+	if n == 0 {
+		return time.Time{}, false, 0
+	}
+	year := 0
+	if y := p.word(i + n); yearPattern.MatchString(y) {
+		year, _ = strconv.Atoi(y)
+		n++
+	}
+	if date, ok := p.makeDate(year, month, mday); ok {
+		return date, false, n
+	}
+	return time.Time{}, false, 0
+}
+
+// makeDate returns the date in the location of now, a zero year takes the nearest date that has not passed.
+func (p *parser) makeDate(year int, month time.Month, mday int) (time.Time, bool) {
+	y := year
+	if y == 0 {
+		y = p.today.Year()
+	}
+	date := time.Date(y, month, mday, 0, 0, 0, 0, p.today.Location())
+	if date.Month() != month || date.Day() != mday {
+		return time.Time{}, false
+	}
+	if year == 0 && date.Before(p.today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+// durationAt parses the duration at the word i: "1h30m", "30 minutes", "an hour", "час".
+func (p *parser) durationAt(i int) (time.Duration, int) {
+	w := p.word(i)
+	if d, ok := singleUnits[w]; ok {
+		return d, 1
+	}
+	if unit, ok := units[p.word(i+1)]; ok {
+		if articles[w] {
+			return unit, 2
+		}
+		if numberPattern.MatchString(w) {
+			if count, err := strconv.Atoi(w); err == nil {
+				return time.Duration(count) * unit, 2
+			}
+		}
+	}
+	if !compactPattern.MatchString(w) {
+		return 0, 0
+	}
+	var total time.Duration
+	for _, part := range compactUnitPart.FindAllStringSubmatch(w, -1) {
+		unit, ok := units[part[2]]
+		count, err := strconv.Atoi(part[1])
+		if !ok || err != nil {
+			return 0, 0
+		}
+		total += time.Duration(count) * unit
+	}
+	return total, 1
+}
+
+// event builds the event from the recognized parts.
+func (p *parser) event() (storage.Event, error) {
+	e := storage.Event{Title: strings.Join(p.title, " ")}
+	if e.Title == "" {
+		return storage.Event{}, fmt.Errorf("%w: no title", ErrInvalidText)
+	}
+	if p.end != nil && p.length != nil {
+		return storage.Event{}, fmt.Errorf("%w: both an end time and a duration", ErrInvalidText)
+	}
+	length := DefaultDuration
+	if p.length != nil {
+		if *p.length <= 0 {
+			return storage.Event{}, fmt.Errorf("%w: duration must be positive", ErrInvalidText)
+		}
+		length = *p.length
+	}
+	switch {
+	case p.at != nil:
+		if p.date != nil || p.start != nil {
+			return storage.Event{}, fmt.Errorf("%w: relative time together with a date or time", ErrInvalidText)
+		}
+		e.StartTime, e.EndTime = *p.at, p.at.Add(length)
+	case p.start != nil:
+		date, roll := p.today, 1
+		if p.date != nil {
+			date, roll = *p.date, 0
+			if p.weekday {
+				roll = 7
+			}
+		}
+		e.StartTime = at(date, *p.start)
+		if roll > 0 && e.StartTime.Before(p.now) {
+			date = date.AddDate(0, 0, roll)
+			e.StartTime = at(date, *p.start)
+		}
+		e.EndTime = e.StartTime.Add(length)
+		if p.end != nil {
+			e.EndTime = at(date, *p.end)
+			// An end before the start is on the next day, like "22:00-01:00".
+			if !e.EndTime.After(e.StartTime) {
+				e.EndTime = at(date.AddDate(0, 0, 1), *p.end)
+			}
+		}
+	case p.date != nil:
+		days := 1
+		if p.length != nil {
+			days = int((*p.length + day - 1) / day)
+		}
+		e.AllDay = true
+		e.StartTime, e.EndTime = *p.date, p.date.AddDate(0, 0, days)
+	default:
+		return storage.Event{}, fmt.Errorf("%w: no date or time", ErrInvalidText)
+	}
+	if e.StartsBefore(p.now) {
+		return storage.Event{}, fmt.Errorf("%w: the event starts in the past", ErrInvalidText)
+	}
+	if p.remind != nil {
+		if *p.remind <= 0 || *p.remind%day != 0 {
+			return storage.Event{}, fmt.Errorf("%w: reminder must be whole days, got %s", ErrInvalidText, *p.remind)
+		}
+		e.NotifyBefore = int32(*p.remind / day)
+	}
+	return e, nil
+}
+
+// duplicate reports a part of the event given more than once.
+func duplicate(name string) error {
+	return fmt.Errorf("%w: more than one %s", ErrInvalidText, name)
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func at(date time.Time, c clock) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), c.minutes/60, c.minutes%60, 0, 0, date.Location())
+}
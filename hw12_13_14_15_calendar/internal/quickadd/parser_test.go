@@ -0,0 +1,230 @@
+package quickadd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// msk is a fixed zone, so the tests do not depend on the time zone database.
+var msk = time.FixedZone("MSK", 3*60*60)
+
+// now is Wednesday, 21 October 2026, 10:30.
+var now = time.Date(2026, 10, 21, 10, 30, 0, 0, msk)
+
+func date(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, msk)
+}
+
+type parseTest struct {
+	text     string
+	expected storage.Event
+}
+
+func TestParseEnglish(t *testing.T) {
+	testParse(t, []parseTest{
+		{
+			text: "Lunch with Anna tomorrow 13:00-14:00 remind 1d",
+			expected: storage.Event{
+				Title: "Lunch with Anna", StartTime: date(10, 22, 13, 0), EndTime: date(10, 22, 14, 0), NotifyBefore: 1,
+			},
+		},
+		{
+			text:     "Standup at 9:15",
+			expected: storage.Event{Title: "Standup", StartTime: date(10, 22, 9, 15), EndTime: date(10, 22, 10, 15)},
+		},
+		{
+			text:     "Standup at 11:15",
+			expected: storage.Event{Title: "Standup", StartTime: date(10, 21, 11, 15), EndTime: date(10, 21, 12, 15)},
+		},
+		{
+			text:     "Call Bob today at 3pm for 30 minutes",
+			expected: storage.Event{Title: "Call Bob", StartTime: date(10, 21, 15, 0), EndTime: date(10, 21, 15, 30)},
+		},
+		{
+			text:     "Dentist 1-2pm on friday",
+			expected: storage.Event{Title: "Dentist", StartTime: date(10, 23, 13, 0), EndTime: date(10, 23, 14, 0)},
+		},
+		{
+			text:     "Review next monday from 10:00 to 11:30",
+			expected: storage.Event{Title: "Review", StartTime: date(10, 26, 10, 0), EndTime: date(10, 26, 11, 30)},
+		},
+		{
+			text:     "Sync wednesday 9:00",
+			expected: storage.Event{Title: "Sync", StartTime: date(10, 28, 9, 0), EndTime: date(10, 28, 10, 0)},
+		},
+		{
+			text:     "Sync wednesday 12:00",
+			expected: storage.Event{Title: "Sync", StartTime: date(10, 21, 12, 0), EndTime: date(10, 21, 13, 0)},
+		},
+		{
+			text:     "Party saturday 22:00-01:00",
+			expected: storage.Event{Title: "Party", StartTime: date(10, 24, 22, 0), EndTime: date(10, 25, 1, 0)},
+		},
+		{
+			text:     "Coffee in 2 hours",
+			expected: storage.Event{Title: "Coffee", StartTime: date(10, 21, 12, 30), EndTime: date(10, 21, 13, 30)},
+		},
+		{
+			text:     "Break in an hour for 15m",
+			expected: storage.Event{Title: "Break", StartTime: date(10, 21, 11, 30), EndTime: date(10, 21, 11, 45)},
+		},
+		{
+			text:     "Retro in 1h30m",
+			expected: storage.Event{Title: "Retro", StartTime: date(10, 21, 12, 0), EndTime: date(10, 21, 13, 0)},
+		},
+		{
+			text:     "Workshop day after tomorrow at noon for 3 hours",
+			expected: storage.Event{Title: "Workshop", StartTime: date(10, 23, 12, 0), EndTime: date(10, 23, 15, 0)},
+		},
+		{
+			text:     "Release 2026-11-03 18:00",
+			expected: storage.Event{Title: "Release", StartTime: date(11, 3, 18, 0), EndTime: date(11, 3, 19, 0)},
+		},
+		{
+			text:     "Conference October 25th 9am-6pm",
+			expected: storage.Event{Title: "Conference", StartTime: date(10, 25, 9, 0), EndTime: date(10, 25, 18, 0)},
+		},
+		{
+			text: "Holiday 5 January",
+			expected: storage.Event{
+				Title: "Holiday", AllDay: true,
+				StartTime: time.Date(2027, 1, 5, 0, 0, 0, 0, msk), EndTime: time.Date(2027, 1, 6, 0, 0, 0, 0, msk),
+			},
+		},
+		{
+			text: "Vacation on dec 28 2026 for 3 days",
+			expected: storage.Event{
+				Title: "Vacation", AllDay: true, StartTime: date(12, 28, 0, 0), EndTime: date(12, 31, 0, 0),
+			},
+		},
+		{
+			text: "Trip in 2 weeks remind 1 day before",
+			expected: storage.Event{
+				Title: "Trip", AllDay: true, StartTime: date(11, 4, 0, 0), EndTime: date(11, 5, 0, 0), NotifyBefore: 1,
+			},
+		},
+		{
+			text: "Birthday party on 14.03 at 19:00, remind me 3d",
+			expected: storage.Event{
+				Title:     "Birthday party",
+				StartTime: time.Date(2027, 3, 14, 19, 0, 0, 0, msk), EndTime: time.Date(2027, 3, 14, 20, 0, 0, 0, msk),
+				NotifyBefore: 3,
+			},
+		},
+	})
+}
+
+func TestParseRussian(t *testing.T) {
+	testParse(t, []parseTest{
+		{
+			text:     "Обед с Анной завтра в 13:00",
+			expected: storage.Event{Title: "Обед с Анной", StartTime: date(10, 22, 13, 0), EndTime: date(10, 22, 14, 0)},
+		},
+		{
+			text: "Встреча в офисе послезавтра с 10 до 12 напомнить за день",
+			expected: storage.Event{
+				Title: "Встреча в офисе", StartTime: date(10, 23, 10, 0), EndTime: date(10, 23, 12, 0), NotifyBefore: 1,
+			},
+		},
+		{
+			text:     "Созвон в пятницу в 16:30 на 45 минут",
+			expected: storage.Event{Title: "Созвон", StartTime: date(10, 23, 16, 30), EndTime: date(10, 23, 17, 15)},
+		},
+		{
+			text:     "Тренировка через 30 минут на полчаса",
+			expected: storage.Event{Title: "Тренировка", StartTime: date(10, 21, 11, 0), EndTime: date(10, 21, 11, 30)},
+		},
+		{
+			text: "Отпуск 2 ноября на неделю",
+			expected: storage.Event{
+				Title: "Отпуск", AllDay: true, StartTime: date(11, 2, 0, 0), EndTime: date(11, 9, 0, 0),
+			},
+		},
+		{
+			text: "Экзамен 01.12.2026 в 9 напомни за 2 дня",
+			expected: storage.Event{
+				Title: "Экзамен", StartTime: date(12, 1, 9, 0), EndTime: date(12, 1, 10, 0), NotifyBefore: 2,
+			},
+		},
+		{
+			text:     "Ужин в следующий вторник в полдень",
+			expected: storage.Event{Title: "Ужин", StartTime: date(10, 27, 12, 0), EndTime: date(10, 27, 13, 0)},
+		},
+	})
+}
+
+func TestParseAmbiguousWords(t *testing.T) {
+	testParse(t, []parseTest{
+		{
+			text: "Meet Sun Li at 14:00 about the may release",
+			expected: storage.Event{
+				Title: "Meet Sun Li about the may release", StartTime: date(10, 21, 14, 0), EndTime: date(10, 21, 15, 0),
+			},
+		},
+		{
+			text:     "Room 13-14 at 17:00",
+			expected: storage.Event{Title: "Room 13-14", StartTime: date(10, 21, 17, 0), EndTime: date(10, 21, 18, 0)},
+		},
+	})
+}
+
+func testParse(t *testing.T, tests []parseTest) {
+	t.Helper()
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.text, func(t *testing.T) {
+			e, err := Parse(tc.text, now)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected.Title, e.Title)
+			require.Equal(t, tc.expected.StartTime, e.StartTime)
+			require.Equal(t, tc.expected.EndTime, e.EndTime)
+			require.Equal(t, tc.expected.AllDay, e.AllDay)
+			require.Equal(t, tc.expected.NotifyBefore, e.NotifyBefore)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "empty", text: "  "},
+		{name: "no date or time", text: "Lunch with Anna"},
+		{name: "no title", text: "tomorrow at 13:00"},
+		{name: "two dates", text: "Lunch today tomorrow"},
+		{name: "two times", text: "Lunch at 12:00 at 13:00"},
+		{name: "two reminders", text: "Lunch at 12:00 remind 1d remind 2d"},
+		{name: "sub-day reminder", text: "Lunch at 12:00 remind 30m"},
+		{name: "partial day reminder", text: "Lunch at 12:00 remind 36h"},
+		{name: "end time and duration", text: "Lunch 12:00-13:00 for 2h"},
+		{name: "relative time and date", text: "Lunch in 2 hours tomorrow"},
+		{name: "zero duration", text: "Lunch at 12:00 for 0m"},
+		{name: "past time", text: "Lunch today at 9:00"},
+		{name: "past date", text: "Lunch 2026-10-20"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.text, now)
+			require.ErrorIs(t, err, ErrInvalidText)
+		})
+	}
+}
+
+func TestParseUnknownWords(t *testing.T) {
+	// Words that only look like dates, times or durations stay in the title.
+	e, err := Parse("Read chapter 5 of War and Peace for fun tomorrow", now)
+	require.NoError(t, err)
+	require.Equal(t, "Read chapter 5 of War and Peace for fun", e.Title)
+	require.True(t, e.AllDay)
+	require.Equal(t, date(10, 22, 0, 0), e.StartTime)
+
+	e, err = Parse("Pay bills 31.02 at 12:00", now)
+	require.NoError(t, err)
+	require.Equal(t, "Pay bills 31.02", e.Title)
+	require.Equal(t, date(10, 21, 12, 0), e.StartTime)
+}
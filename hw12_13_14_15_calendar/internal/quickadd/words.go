@@ -0,0 +1,96 @@
+package quickadd
+
+import "time"
+
+const day = 24 * time.Hour
+
+// units are the duration units in English and Russian, full and short forms.
+var units = map[string]time.Duration{
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"м": time.Minute, "мин": time.Minute, "минута": time.Minute, "минуту": time.Minute, "минуты": time.Minute,
+	"минут": time.Minute,
+	"h":     time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"ч": time.Hour, "час": time.Hour, "часа": time.Hour, "часов": time.Hour,
+	"d": day, "day": day, "days": day,
+	"д": day, "день": day, "дня": day, "дней": day, "сутки": day, "суток": day,
+	"w": 7 * day, "wk": 7 * day, "week": 7 * day, "weeks": 7 * day,
+	"н": 7 * day, "нед": 7 * day, "неделя": 7 * day, "неделю": 7 * day, "недели": 7 * day, "недель": 7 * day,
+}
+
+// singleUnits are the units meaning one of them without a number, like "на час".
+var singleUnits = map[string]time.Duration{
+	"час": time.Hour, "минуту": time.Minute, "день": day, "сутки": day, "неделю": 7 * day,
+	"полчаса": 30 * time.Minute,
+}
+
+// articles stand for one unit in English, like "in an hour".
+var articles = map[string]bool{"a": true, "an": true}
+
+// weekdays leave out the short forms that are English words, like "sun".
+var weekdays = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday":    time.Saturday,
+	"sunday":      time.Sunday,
+	"понедельник": time.Monday, "пн": time.Monday,
+	"вторник": time.Tuesday, "вт": time.Tuesday,
+	"среда": time.Wednesday, "среду": time.Wednesday, "ср": time.Wednesday,
+	"четверг": time.Thursday, "чт": time.Thursday,
+	"пятница": time.Friday, "пятницу": time.Friday, "пт": time.Friday,
+	"суббота": time.Saturday, "субботу": time.Saturday, "сб": time.Saturday,
+	"воскресенье": time.Sunday, "вс": time.Sunday,
+}
+
+// nextWords may precede a weekday, they mean the same as the weekday alone.
+var nextWords = map[string]bool{
+	"next": true, "this": true, "следующий": true, "следующую": true, "следующее": true,
+	"ближайший": true, "ближайшую": true, "ближайшее": true,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January, "января": time.January,
+	"february": time.February, "feb": time.February, "февраля": time.February,
+	"march": time.March, "mar": time.March, "марта": time.March,
+	"april": time.April, "apr": time.April, "апреля": time.April,
+	"may": time.May, "мая": time.May,
+	"june": time.June, "jun": time.June, "июня": time.June,
+	"july": time.July, "jul": time.July, "июля": time.July,
+	"august": time.August, "aug": time.August, "августа": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September, "сентября": time.September,
+	"october": time.October, "oct": time.October, "октября": time.October,
+	"november": time.November, "nov": time.November, "ноября": time.November,
+	"december": time.December, "dec": time.December, "декабря": time.December,
+}
+
+// relativeDays are the dates named relative to today.
+var relativeDays = map[string]int{
+	"today": 0, "tomorrow": 1, "сегодня": 0, "завтра": 1, "послезавтра": 2,
+}
+
+var (
+	// remindWords start a reminder, like "remind 1d" or "напомнить за день".
+	remindWords = map[string]bool{
+		"remind": true, "reminder": true, "напомнить": true, "напомни": true, "напоминание": true,
+	}
+	// remindFillers may follow a remind word before the duration.
+	remindFillers = map[string]bool{"me": true, "за": true}
+	// remindTails may follow the duration of a reminder.
+	remindTails = map[string]bool{"before": true, "earlier": true, "ahead": true, "заранее": true, "до": true}
+	// durationWords start the duration of the event, like "for 2h" or "на час".
+	durationWords = map[string]bool{"for": true, "на": true}
+	// relativeWords start a time relative to now, like "in 2 hours" or "через неделю".
+	relativeWords = map[string]bool{"in": true, "через": true}
+	// timePrepositions may precede a time, a bare hour like "at 9" is only a time after them.
+	timePrepositions = map[string]bool{"at": true, "from": true, "@": true, "в": true, "во": true, "с": true, "со": true}
+	// rangeSeparators join the start and the end time.
+	rangeSeparators = map[string]bool{
+		"-": true, "–": true, "to": true, "till": true, "until": true, "до": true, "по": true,
+	}
+	// datePrepositions may precede a date.
+	datePrepositions = map[string]bool{"on": true, "в": true, "во": true, "на": true}
+	// noonWords name twelve o'clock.
+	noonWords = map[string]bool{"noon": true, "midday": true, "полдень": true}
+)
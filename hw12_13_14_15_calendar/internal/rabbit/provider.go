@@ -2,18 +2,46 @@ package rabbit
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"time"
 
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/tlsconfig"
 	"github.com/streadway/amqp"
 )
 
+var ErrDeliveryClosed = errors.New("delivery channel is closed")
+
+const (
+	// requestIDHeader carries the request ID from the publisher to the consumer.
+	requestIDHeader = "x-request-id"
+	// minRetryDelay is how long a message which failed to be processed is held before it is returned
+	// to the queue, the delay doubles with every failure in a row up to maxRetryDelay.
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
 type Config struct {
 	Host     string
 	Port     int
 	User     string
 	Password string
 	Queue    string
+	// TLS connects with the amqps scheme.
+	TLS tlsconfig.ClientConfig
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Required("host", c.Host)
+	v.Port("port", c.Port)
+	v.Required("user", c.User)
+	v.Required("queue", c.Queue)
+	v.Check("tls", c.TLS.Validate())
+	return v.Err()
 }
 
 type Message struct {
@@ -29,24 +57,40 @@ type Provider struct {
 	channel    *amqp.Channel
 	connString string
 	queueName  string
+	tls        tlsconfig.ClientConfig
 }
 
 func New(config Config) *Provider {
+	scheme := "amqp"
+	if config.TLS.Enabled {
+		scheme = "amqps"
+	}
 	return &Provider{
 		connString: fmt.Sprintf(
-			"amqp://%s:%s@%s:%d/",
+			"%s://%s:%s@%s:%d/",
+			scheme,
 			config.User,
 			config.Password,
 			config.Host,
 			config.Port,
 		),
 		queueName: config.Queue,
+		tls:       config.TLS,
 	}
 }
 
 func (r *Provider) Connect() error {
 	var err error
-	r.conn, err = amqp.Dial(r.connString)
+	if r.tls.Enabled {
+		var tlsConfig *tls.Config
+		tlsConfig, err = r.tls.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load tls config: %w", err)
+		}
+		r.conn, err = amqp.DialTLS(r.connString, tlsConfig)
+	} else {
+		r.conn, err = amqp.Dial(r.connString)
+	}
 	if err != nil {
 		return err
 	}
@@ -70,7 +114,12 @@ func (r *Provider) Close() {
 	r.conn.Close()
 }
 
-func (r *Provider) Publish(body []byte) error {
+// Publish sends the message to the queue along with the request ID of the context.
+func (r *Provider) Publish(ctx context.Context, body []byte) error {
+	var headers amqp.Table
+	if id := logger.RequestIDFromContext(ctx); id != "" {
+		headers = amqp.Table{requestIDHeader: id}
+	}
 	return r.channel.Publish(
 		"",           // exchange
 		r.queue.Name, // routing key
@@ -78,17 +127,34 @@ func (r *Provider) Publish(body []byte) error {
 		false,        // immediate
 		amqp.Publishing{
 			ContentType: "text/plain",
+			Headers:     headers,
 			Body:        body,
 		})
 }
 
-type MessageProcess = func(msg amqp.Delivery)
+// MessageContext returns a context carrying the request ID the message was published with.
+func MessageContext(ctx context.Context, msg amqp.Delivery) context.Context {
+	if id, ok := msg.Headers[requestIDHeader].(string); ok && id != "" {
+		return logger.WithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// MessageProcess handles the message. The message is acknowledged when it returns nil,
+// otherwise the message is returned to the queue to be retried.
+type MessageProcess = func(ctx context.Context, msg amqp.Delivery) error
 
-func (r Provider) Consume(ctx context.Context, process MessageProcess) error {
+// Consume processes messages one by one until ctx is done or the channel fails. A message
+// being processed when ctx is done is finished, its context carries the request ID of
+// the message and is not cancelled. A message which fails to be processed is logged and
+// returned to the queue after a delay growing with the failures in a row, so a short outage
+// of a dependency doesn't stop the consumer. Messages delivered but not processed yet are
+// returned to the queue once the connection is closed.
+func (r *Provider) Consume(ctx context.Context, process MessageProcess) error {
 	msgs, err := r.channel.Consume(
 		r.queue.Name, // queue
 		"",           // consumer
-		true,         // auto-ack
+		false,        // auto-ack
 		false,        // exclusive
 		false,        // no-local
 		false,        // no-wait
@@ -98,14 +164,47 @@ func (r Provider) Consume(ctx context.Context, process MessageProcess) error {
 		return err
 	}
 
+	failures := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case m, ok := <-msgs:
-			if ok {
-				process(m)
+			if !ok {
+				return ErrDeliveryClosed
+			}
+			msgCtx := MessageContext(context.Background(), m)
+			if err := process(msgCtx, m); err != nil {
+				failures++
+				delay := retryDelay(failures)
+				logger.FromContext(msgCtx).Errorf("failed to process message, it is returned to the queue in %s: %v",
+					delay, err)
+				// The message is held meanwhile, so it is not redelivered right away.
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+				if err := m.Nack(false, true); err != nil {
+					return fmt.Errorf("failed to nack message: %w", err)
+				}
+				continue
+			}
+			failures = 0
+			if err := m.Ack(false); err != nil {
+				return fmt.Errorf("failed to ack message: %w", err)
 			}
 		}
 	}
 }
+
+// retryDelay returns the delay after the failures in a row.
+func retryDelay(failures int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
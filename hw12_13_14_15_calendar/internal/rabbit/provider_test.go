@@ -0,0 +1,34 @@
+package rabbit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/tlsconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectTLSDialFails(t *testing.T) {
+	// The listener is closed right away, so the port refuses connections.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	r := New(Config{
+		Host:  "127.0.0.1",
+		Port:  port,
+		User:  "user",
+		Queue: "queue",
+		TLS:   tlsconfig.ClientConfig{Enabled: true},
+	})
+	require.Error(t, r.Connect())
+}
+
+func TestRetryDelay(t *testing.T) {
+	require.Equal(t, minRetryDelay, retryDelay(1))
+	require.Equal(t, 4*minRetryDelay, retryDelay(3))
+	require.Equal(t, maxRetryDelay, retryDelay(100))
+	require.Equal(t, 32*time.Second, retryDelay(6))
+}
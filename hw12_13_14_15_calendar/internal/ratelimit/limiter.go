@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets of idle clients are dropped.
+const sweepInterval = time.Minute
+
+var ErrInvalidConfig = errors.New("invalid rate limit config")
+
+type Config struct {
+	Enabled bool
+	// Rate is the number of requests per second a single client address may make.
+	Rate float64
+	// Burst is the number of requests a client may make at once.
+	Burst int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Validate checks that an enabled limiter has positive rate and burst.
+func (c Config) Validate() error {
+	if c.Enabled && (c.Rate <= 0 || c.Burst <= 0) {
+		return fmt.Errorf("%w: rate and burst must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Limiter is a token bucket rate limiter with a bucket per client key.
+type Limiter struct {
+	mu        sync.Mutex
+	enabled   bool
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns a limiter for the config, a disabled limiter allows every request.
+func New(config Config) *Limiter {
+	return newLimiter(config, time.Now)
+}
+
+func newLimiter(config Config, now func() time.Time) *Limiter {
+	l := &Limiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: now(),
+		now:       now,
+	}
+	l.Update(config)
+	return l
+}
+
+// Update applies new limits, the buckets of the clients are kept.
+func (l *Limiter) Update(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enabled = config.Enabled && config.Rate > 0 && config.Burst > 0
+	l.rate = config.Rate
+	l.burst = float64(config.Burst)
+}
+
+// Allow takes a token from the bucket of the key. If the bucket is empty it returns false
+// and the time after which the next request will be allowed.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.enabled {
+		return true, 0
+	}
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep drops buckets that are refilled completely, they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfter formats the wait time as a number of seconds for the Retry-After header.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(Config{Enabled: true, Rate: 2, Burst: 3}, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		require.True(t, ok)
+	}
+	ok, wait := l.Allow("client")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+	require.Equal(t, "1", RetryAfter(wait))
+
+	ok, _ = l.Allow("other")
+	require.True(t, ok, "clients have separate buckets")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+	ok, _ = l.Allow("client")
+	require.False(t, ok)
+
+	now = now.Add(time.Hour)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+	require.Equal(t, 1, len(l.buckets), "idle buckets are dropped")
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(Config{Rate: 1, Burst: 1}, func() time.Time { return now })
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		require.True(t, ok, "disabled limiter allows every request")
+	}
+
+	l.Update(Config{Enabled: true, Rate: 1, Burst: 1})
+	ok, _ := l.Allow("client")
+	require.True(t, ok)
+	ok, _ = l.Allow("client")
+	require.False(t, ok)
+
+	l.Update(Config{Enabled: true, Rate: 1, Burst: 2})
+	now = now.Add(2 * time.Second)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+	ok, _ = l.Allow("client")
+	require.True(t, ok)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, Config{}.Validate())
+	require.NoError(t, Config{Enabled: true, Rate: 1, Burst: 1}.Validate())
+	require.ErrorIs(t, Config{Enabled: true, Rate: 1}.Validate(), ErrInvalidConfig)
+}
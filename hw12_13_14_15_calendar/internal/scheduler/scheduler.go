@@ -0,0 +1,241 @@
+// Package scheduler publishes notifications of upcoming events and removes old events.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AuditActor is recorded in the audit trail for changes made by the scheduler.
+const AuditActor = "scheduler"
+
+type Config struct {
+	// PollInterval is how often events to notify about are looked for.
+	PollInterval time.Duration
+	// CleanupInterval is how often old events are removed and the trash and the change feed are purged.
+	CleanupInterval time.Duration
+	// BatchSize is the maximum number of events read at once, a larger backlog is read in several batches.
+	BatchSize int
+	// Lookahead sends the notifications this much before they are due, so they arrive in time
+	// despite the poll interval.
+	Lookahead time.Duration
+	// EventRetention is how long events are kept after they started.
+	EventRetention time.Duration
+	// TrashRetention is how long removed events are kept before they are purged.
+	TrashRetention time.Duration
+	// ChangeRetention is how long the changes are kept in the feed, the clients resuming
+	// from older tokens have to read the events again.
+	ChangeRetention time.Duration
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Duration("pollInterval", c.PollInterval)
+	v.Duration("cleanupInterval", c.CleanupInterval)
+	v.Positive("batchSize", c.BatchSize)
+	if c.Lookahead < 0 {
+		v.Addf("lookahead", "must not be negative, got %s", c.Lookahead)
+	}
+	v.Duration("eventRetention", c.EventRetention)
+	v.Duration("trashRetention", c.TrashRetention)
+	v.Duration("changeRetention", c.ChangeRetention)
+	return v.Err()
+}
+
+// Storage is the part of storage.Storage used by the scheduler.
+type Storage interface {
+	GetEventsByNotifier(ctx context.Context, limit int, endTime time.Time) ([]storage.Event, error)
+	MarkSentEvents(ctx context.Context, events []storage.Event) error
+	RemoveAfter(ctx context.Context, time time.Time) ([]storage.Event, error)
+	PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error)
+	PurgeChanges(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Publisher sends the notifications, it is implemented by rabbit.Provider.
+type Publisher interface {
+	Publish(ctx context.Context, body []byte) error
+}
+
+type Scheduler struct {
+	stor  Storage
+	queue Publisher
+	// blobs keep the content of attachments, nil when it isn't deleted with the events.
+	blobs blob.Store
+	clock clock.Clock
+
+	mu     sync.Mutex
+	config Config
+}
+
+type Option func(*Scheduler)
+
+// WithBlobs deletes the content of the attachments of the removed events from the store.
+func WithBlobs(blobs blob.Store) Option {
+	return func(s *Scheduler) {
+		s.blobs = blobs
+	}
+}
+
+// WithClock sets the clock of the loops and the due times, the system one by default.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+func New(stor Storage, queue Publisher, config Config, opts ...Option) *Scheduler {
+	s := &Scheduler{stor: stor, queue: queue, clock: clock.Real, config: config}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Update applies new settings, the loops pick them up after the current run.
+func (s *Scheduler) Update(config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+func (s *Scheduler) settings() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config
+}
+
+// runContext returns a context of a single run. It is not cancelled on shutdown,
+// so the run started before is finished.
+func runContext() context.Context {
+	return logger.WithRequestID(context.Background(), logger.NewRequestID())
+}
+
+// withActor makes the storage record the changes of the run as made by the scheduler.
+func withActor(ctx context.Context) context.Context {
+	return storage.WithActor(ctx, AuditActor)
+}
+
+// Cleanup removes old events and purges the trash and the change feed every cleanup interval until ctx is done.
+func (s *Scheduler) Cleanup(ctx context.Context) error {
+	ticker := s.clock.NewTicker(s.settings().CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			s.RemoveOld(runContext())
+			ticker.Reset(s.settings().CleanupInterval)
+		}
+	}
+}
+
+// RemoveOld removes the events older than the retention and purges the trash and the change feed,
+// errors are logged and retried on the next run.
+func (s *Scheduler) RemoveOld(ctx context.Context) {
+	ctx = withActor(ctx)
+	config := s.settings()
+	now := s.clock.Now()
+	removed, err := s.stor.RemoveAfter(ctx, now.Add(-config.EventRetention))
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to remove old events: %s", err)
+	}
+	purged, err := s.stor.PurgeTrash(ctx, now.Add(-config.TrashRetention))
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to purge trash: %s", err)
+	}
+	if s.blobs != nil {
+		app.DeleteAttachments(ctx, s.blobs, append(removed, purged...))
+	}
+	changes, err := s.stor.PurgeChanges(ctx, now.Add(-config.ChangeRetention))
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to purge changes: %s", err)
+		return
+	}
+	logger.FromContext(ctx).Debugf("purged %d changes", changes)
+}
+
+// Notify publishes notifications of upcoming events every poll interval until ctx is done.
+func (s *Scheduler) Notify(ctx context.Context) error {
+	ticker := s.clock.NewTicker(s.settings().PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.SendNotifications(runContext()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			ticker.Reset(s.settings().PollInterval)
+		}
+	}
+}
+
+// SendNotifications publishes the notifications due within the lookahead batch by batch until
+// the backlog is drained. Only marshaling failures are returned, other errors are retried on the next run.
+func (s *Scheduler) SendNotifications(ctx context.Context) error {
+	ctx = withActor(ctx)
+	config := s.settings()
+	endTime := s.clock.Now().Add(config.Lookahead)
+	for {
+		n, err := s.sendBatch(ctx, config.BatchSize, endTime)
+		if err != nil || n < config.BatchSize || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// sendBatch publishes up to limit notifications due by the end time and returns their number. Only the
+// published events are marked sent, the others are left to the next run. Zero is returned when nothing
+// is published or marked sent, so the next batch would be the same.
+func (s *Scheduler) sendBatch(ctx context.Context, limit int, endTime time.Time) (int, error) {
+	entry := logger.FromContext(ctx)
+	entry.Debugf("get events %s", endTime)
+	events, err := s.stor.GetEventsByNotifier(ctx, limit, endTime)
+	if err != nil {
+		entry.Errorf("failed to get events: %s", err)
+		return 0, nil
+	}
+	published := make([]storage.Event, 0, len(events))
+	for _, event := range events {
+		entry.Debugf("send event: %v", event)
+		data, err := json.Marshal(newMessage(event))
+		if err != nil {
+			return 0, err
+		}
+		// The request ID of the run follows the message to the sender.
+		if err := s.queue.Publish(ctx, data); err != nil {
+			entry.Errorf("failed to publish event %q: %s", event.ID, err)
+			continue
+		}
+		published = append(published, event)
+	}
+	if len(published) == 0 {
+		return 0, nil
+	}
+	if err := s.stor.MarkSentEvents(ctx, published); err != nil {
+		entry.Errorf("failed to mark sent events: %s", err)
+		return 0, nil
+	}
+	return len(published), nil
+}
+
+func newMessage(event storage.Event) rabbit.Message {
+	return rabbit.Message{
+		ID:      event.ID,
+		Name:    event.Title,
+		Time:    event.StartTime,
+		OwnerID: event.OwnerID,
+	}
+}
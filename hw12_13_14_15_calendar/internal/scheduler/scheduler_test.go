@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var errFake = errors.New("fake error")
+
+// fakeStorage keeps the events in a slice, an event is due to be notified at its start time.
+// The marked and removed events are recorded in the audit trail as the storages do.
+type fakeStorage struct {
+	mu      sync.Mutex
+	events  []storage.Event
+	batches []int
+	audit   []storage.AuditRecord
+	// removedBefore, purgedBefore and changesBefore are the cutoffs of the last cleanup.
+	removedBefore, purgedBefore, changesBefore time.Time
+	markErr                                    error
+}
+
+func newFakeStorage(start time.Time, n int) *fakeStorage {
+	s := &fakeStorage{}
+	for i := 0; i < n; i++ {
+		s.events = append(s.events, storage.Event{
+			ID:        fmt.Sprintf("event-%02d", i),
+			Title:     "review",
+			StartTime: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return s
+}
+
+func (s *fakeStorage) GetEventsByNotifier(_ context.Context, limit int, endTime time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []storage.Event
+	for _, e := range s.events {
+		if !e.IsSent && !e.StartTime.After(endTime) && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	s.batches = append(s.batches, len(res))
+	return res, nil
+}
+
+func (s *fakeStorage) MarkSentEvents(ctx context.Context, events []storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.markErr != nil {
+		return s.markErr
+	}
+	for _, sent := range events {
+		for i := range s.events {
+			if s.events[i].ID == sent.ID {
+				before := s.events[i]
+				s.events[i].IsSent = true
+				after := s.events[i]
+				s.audit = append(s.audit, storage.NewAuditRecord(ctx, storage.AuditNotified, time.Time{}, &before, &after))
+			}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) RemoveAfter(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removedBefore = before
+	var removed, kept []storage.Event
+	for _, e := range s.events {
+		if e.StartTime.Before(before) {
+			removed = append(removed, e)
+			purged := e
+			s.audit = append(s.audit, storage.NewAuditRecord(ctx, storage.AuditPurged, time.Time{}, &purged, nil))
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	s.events = kept
+	return removed, nil
+}
+
+func (s *fakeStorage) PurgeTrash(_ context.Context, before time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgedBefore = before
+	return nil, errFake
+}
+
+func (s *fakeStorage) PurgeChanges(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changesBefore = before
+	return 0, nil
+}
+
+func (s *fakeStorage) stats() (batches []int, audit []storage.AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.batches...), append([]storage.AuditRecord(nil), s.audit...)
+}
+
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []rabbit.Message
+	// failing are the IDs of the events whose notifications fail to be published, all fail with "*".
+	failing map[string]bool
+}
+
+func (p *fakePublisher) Publish(_ context.Context, body []byte) error {
+	var m rabbit.Message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing[m.ID] || p.failing["*"] {
+		return errFake
+	}
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+func (p *fakePublisher) sent() []rabbit.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]rabbit.Message(nil), p.messages...)
+}
+
+var testConfig = Config{
+	PollInterval:    time.Minute,
+	CleanupInterval: time.Hour,
+	BatchSize:       10,
+	EventRetention:  24 * time.Hour,
+	TrashRetention:  time.Hour,
+	ChangeRetention: time.Hour,
+}
+
+var testStart = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// run starts the loop of the scheduler and waits until it waits for the ticks of the clock.
+func run(t *testing.T, c *clock.Fake, loop func(ctx context.Context) error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- loop(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+	c.WaitTickers(1)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, testConfig.Validate())
+
+	config := testConfig
+	config.BatchSize = 0
+	config.Lookahead = -time.Minute
+	err := config.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "batchSize")
+	require.Contains(t, err.Error(), "lookahead")
+}
+
+func TestSchedulerNotify(t *testing.T) {
+	c := clock.NewFake(testStart)
+	stor := newFakeStorage(testStart.Add(time.Hour), 1)
+	queue := &fakePublisher{}
+	s := New(stor, queue, testConfig, WithClock(c))
+
+	run(t, c, s.Notify)
+	require.Empty(t, queue.sent(), "the event is not due yet")
+
+	c.Advance(time.Hour)
+	require.Eventually(t, func() bool { return len(queue.sent()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, "event-00", queue.sent()[0].ID)
+	require.Eventually(t, func() bool {
+		_, audit := stor.stats()
+		return len(audit) == 1
+	}, time.Second, time.Millisecond)
+	_, audit := stor.stats()
+	require.Equal(t, storage.AuditNotified, audit[0].Action)
+	require.Equal(t, AuditActor, audit[0].Actor)
+
+	c.Advance(time.Minute)
+	c.Advance(time.Minute)
+	require.Len(t, queue.sent(), 1, "the event is notified once")
+}
+
+func TestSchedulerLookahead(t *testing.T) {
+	c := clock.NewFake(testStart)
+	stor := newFakeStorage(testStart.Add(time.Hour), 3)
+	queue := &fakePublisher{}
+	config := testConfig
+	config.Lookahead = time.Hour + time.Minute
+	s := New(stor, queue, config, WithClock(c))
+
+	require.NoError(t, s.SendNotifications(context.Background()))
+	require.Len(t, queue.sent(), 2, "the events due within the lookahead are notified")
+}
+
+func TestSchedulerDrainsBacklog(t *testing.T) {
+	tests := []struct {
+		events  int
+		batches []int
+	}{
+		{events: 0, batches: []int{0}},
+		{events: 7, batches: []int{7}},
+		{events: 20, batches: []int{10, 10, 0}},
+		{events: 25, batches: []int{10, 10, 5}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprint(tc.events), func(t *testing.T) {
+			c := clock.NewFake(testStart)
+			stor := newFakeStorage(testStart.Add(-time.Hour), tc.events)
+			queue := &fakePublisher{}
+			s := New(stor, queue, testConfig, WithClock(c))
+
+			require.NoError(t, s.SendNotifications(context.Background()))
+			require.Len(t, queue.sent(), tc.events)
+			batches, audit := stor.stats()
+			require.Equal(t, tc.batches, batches)
+			require.Len(t, audit, tc.events)
+		})
+	}
+
+	t.Run("mark failure", func(t *testing.T) {
+		stor := newFakeStorage(testStart.Add(-time.Hour), 25)
+		stor.markErr = errFake
+		queue := &fakePublisher{}
+		s := New(stor, queue, testConfig, WithClock(clock.NewFake(testStart)))
+
+		require.NoError(t, s.SendNotifications(context.Background()))
+		batches, audit := stor.stats()
+		require.Equal(t, []int{10}, batches, "the same batch isn't read again")
+		require.Empty(t, audit)
+	})
+
+	t.Run("publish failure", func(t *testing.T) {
+		stor := newFakeStorage(testStart.Add(-time.Hour), 25)
+		queue := &fakePublisher{failing: map[string]bool{"*": true}}
+		s := New(stor, queue, testConfig, WithClock(clock.NewFake(testStart)))
+
+		require.NoError(t, s.SendNotifications(context.Background()))
+		batches, audit := stor.stats()
+		require.Equal(t, []int{10}, batches, "the same batch isn't read again")
+		require.Empty(t, audit, "nothing is marked sent")
+
+		queue.failing = map[string]bool{"event-01": true}
+		require.NoError(t, s.SendNotifications(context.Background()))
+		_, audit = stor.stats()
+		require.Len(t, audit, 9, "the published events are marked sent")
+		for _, r := range audit {
+			require.NotEqual(t, "event-01", r.EventID)
+		}
+
+		queue.failing = nil
+		require.NoError(t, s.SendNotifications(context.Background()))
+		require.Len(t, queue.sent(), 25, "the failed notification is sent by a later run")
+		_, audit = stor.stats()
+		require.Len(t, audit, 25)
+	})
+}
+
+func TestSchedulerCleanup(t *testing.T) {
+	c := clock.NewFake(testStart)
+	stor := newFakeStorage(testStart.Add(-36*time.Hour), 2)
+	s := New(stor, &fakePublisher{}, testConfig, WithClock(c))
+
+	run(t, c, s.Cleanup)
+	c.Advance(30 * time.Minute)
+	_, audit := stor.stats()
+	require.Empty(t, audit, "the cleanup interval hasn't passed")
+
+	c.Advance(30 * time.Minute)
+	require.Eventually(t, func() bool {
+		stor.mu.Lock()
+		defer stor.mu.Unlock()
+		return len(stor.audit) == 2 && !stor.changesBefore.IsZero()
+	}, time.Second, time.Millisecond, "the old events are removed and the changes are purged despite the failed purge")
+	_, audit = stor.stats()
+	require.Equal(t, storage.AuditPurged, audit[0].Action)
+	require.Equal(t, AuditActor, audit[0].Actor)
+
+	stor.mu.Lock()
+	defer stor.mu.Unlock()
+	require.Equal(t, testStart.Add(time.Hour-24*time.Hour), stor.removedBefore)
+	require.Equal(t, testStart, stor.purgedBefore)
+	require.Equal(t, testStart, stor.changesBefore)
+}
+
+func TestSchedulerUpdate(t *testing.T) {
+	c := clock.NewFake(testStart)
+	stor := newFakeStorage(testStart.Add(-time.Hour), 5)
+	queue := &fakePublisher{}
+	s := New(stor, queue, testConfig, WithClock(c))
+
+	config := testConfig
+	config.BatchSize = 2
+	s.Update(config)
+	require.NoError(t, s.SendNotifications(context.Background()))
+	batches, _ := stor.stats()
+	require.Equal(t, []int{2, 2, 1}, batches)
+}
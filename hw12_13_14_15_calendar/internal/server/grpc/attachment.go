@@ -0,0 +1,99 @@
+package internalgrpc
+
+import (
+	"errors"
+	"io"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const errAttachmentInfoNotProvided = "attachment info is not provided"
+
+var errUnexpectedAttachmentInfo = errors.New("attachment info is sent after the content")
+
+func (s *Server) UploadAttachment(stream api.Events_UploadAttachmentServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return status.Errorf(codes.InvalidArgument, errAttachmentInfoNotProvided)
+	}
+	content := &chunkReader{stream: stream}
+	attachment, err := s.app.UploadAttachment(ctx, info.GetEventId(), info.GetName(), info.GetContentType(), content)
+	switch {
+	case err == nil:
+		return stream.SendAndClose(&api.AttachmentResponse{Attachment: toAPIAttachment(attachment)})
+	case content.err != nil:
+		// The stream is broken, its error is returned as is.
+		return content.err
+	case errors.Is(err, storage.ErrNotFoundEvent):
+		return status.Errorf(codes.NotFound, errEventNotFound)
+	case errors.Is(err, app.ErrInvalidAttachment), errors.Is(err, errUnexpectedAttachmentInfo):
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	case errors.Is(err, app.ErrAttachmentTooLarge):
+		return status.Errorf(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, app.ErrAttachmentsDisabled):
+		return status.Errorf(codes.Unimplemented, err.Error())
+	default:
+		logger.FromContext(ctx).Errorf("failed to upload attachment: %v", err)
+		return status.Errorf(codes.Internal, errInternalServerError)
+	}
+}
+
+// chunkReader reads the content of an attachment from the chunks of the upload stream.
+type chunkReader struct {
+	stream api.Events_UploadAttachmentServer
+	chunk  []byte
+	// err is the failure of the stream other than its end.
+	err error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		req, err := r.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		if req.GetInfo() != nil {
+			return 0, errUnexpectedAttachmentInfo
+		}
+		r.chunk = req.GetChunk()
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func toAPIAttachment(a storage.Attachment) *api.Attachment {
+	return &api.Attachment{
+		Id:          a.ID,
+		Name:        a.Name,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		CreatedAt:   timestamppb.New(a.CreatedAt),
+	}
+}
+
+func toAPIAttachments(attachments []storage.Attachment) []*api.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	result := make([]*api.Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		result = append(result, toAPIAttachment(a))
+	}
+	return result
+}
@@ -2,12 +2,17 @@ package internalgrpc
 
 import (
 	"context"
+	"net"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 func loggingHandler(
@@ -18,8 +23,9 @@ func loggingHandler(
 ) (interface{}, error) {
 	start := time.Now()
 	resp, err := handler(ctx, req)
+	entry := logger.FromContext(ctx)
 	if err != nil {
-		log.Printf("method %q failed: %s", info.FullMethod, err)
+		entry.Errorf("method %q failed: %s", info.FullMethod, err)
 	}
 	ip := ""
 	if peer, ok := peer.FromContext(ctx); ok {
@@ -29,10 +35,146 @@ func loggingHandler(
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
 		userAgent = md.Get("user-agent")
 	}
-	log.WithField("ip", ip).
+	entry.WithField("ip", ip).
 		WithField("method", info.FullMethod).
 		WithField("user-agent", userAgent).
 		WithField("latency", time.Since(start)).
 		Info("GRPC request processed")
 	return resp, err
 }
+
+func loggingStreamHandler(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	entry := logger.FromContext(ss.Context())
+	if err != nil {
+		entry.Errorf("stream %q failed: %s", info.FullMethod, err)
+	}
+	ip := ""
+	if peer, ok := peer.FromContext(ss.Context()); ok {
+		ip = peer.Addr.String()
+	}
+	entry.WithField("ip", ip).
+		WithField("method", info.FullMethod).
+		WithField("latency", time.Since(start)).
+		Info("GRPC stream processed")
+	return err
+}
+
+const (
+	// actorMetadata identifies the user on whose behalf the call is made.
+	actorMetadata = "x-user-id"
+	// requestIDMetadata correlates logs of the call across services.
+	requestIDMetadata = "x-request-id"
+	// idempotencyKeyMetadata makes a repeated creation call return the original result.
+	idempotencyKeyMetadata = "idempotency-key"
+)
+
+func actorHandler(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if actor := firstValue(md, actorMetadata); actor != "" {
+			ctx = storage.WithActor(ctx, actor)
+		}
+	}
+	return handler(ctx, req)
+}
+
+func actorStreamHandler(
+	srv interface{},
+	ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if md, ok := metadata.FromIncomingContext(ss.Context()); ok {
+		if actor := firstValue(md, actorMetadata); actor != "" {
+			ss = &contextStream{ServerStream: ss, ctx: storage.WithActor(ss.Context(), actor)}
+		}
+	}
+	return handler(srv, ss)
+}
+
+func rateLimitHandler(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		// The API key and user metadata are not verified, a client could get a new bucket
+		// with every value, so the bucket is taken by the peer address.
+		var ip string
+		if p, ok := peer.FromContext(ctx); ok {
+			ip = p.Addr.String()
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+		}
+		if ok, wait := limiter.Allow(ip); !ok {
+			retryAfter := ratelimit.RetryAfter(wait)
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// requestContext takes the request ID from the metadata or generates a new one,
+// returns it in the response header and passes it through the context.
+func requestContext(ctx context.Context, setHeader func(metadata.MD) error) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		id = firstValue(md, requestIDMetadata)
+	}
+	if id == "" {
+		id = logger.NewRequestID()
+	}
+	_ = setHeader(metadata.Pairs(requestIDMetadata, id))
+	return logger.WithRequestID(ctx, id)
+}
+
+func requestIDHandler(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx = requestContext(ctx, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+	return handler(ctx, req)
+}
+
+// contextStream overrides the context of the wrapped stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func requestIDStreamHandler(
+	srv interface{},
+	ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx := requestContext(ss.Context(), ss.SetHeader)
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
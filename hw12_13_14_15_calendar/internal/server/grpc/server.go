@@ -5,18 +5,29 @@ package internalgrpc
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/quickadd"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/tlsconfig"
 	"github.com/golang/protobuf/ptypes/empty"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -27,11 +38,23 @@ const (
 	errIncorrectEventTime  = "incorrect event time"
 	errIncorrectDate       = "incorrect date"
 	errDateIsNotProvided   = "date is not provided"
+	errVersionConflict     = "event version conflict"
+	errInvalidResumeToken  = "invalid resume token"
+	errResumeTokenExpired  = "resume token expired, read the events again"
 )
 
 type Config struct {
 	Host string
 	Port int
+	TLS  tlsconfig.ServerConfig
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Required("host", c.Host)
+	v.Port("port", c.Port)
+	v.Check("tls", c.TLS.Validate())
+	return v.Err()
 }
 
 type Server struct {
@@ -39,30 +62,73 @@ type Server struct {
 	grpcServer *grpc.Server
 	app        *app.App
 	addr       string
+	tls        tlsconfig.ServerConfig
+	closing    chan struct{}
+	closeOnce  sync.Once
 }
 
-func NewServer(config Config, app *app.App) *Server {
-	return &Server{app: app, addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port))}
+// NewServer creates the server, a nil limiter disables rate limiting.
+func NewServer(config Config, app *app.App, limiter *ratelimit.Limiter) *Server {
+	s := &Server{
+		app:     app,
+		addr:    net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		tls:     config.TLS,
+		closing: make(chan struct{}),
+	}
+	interceptors := []grpc.UnaryServerInterceptor{requestIDHandler, loggingHandler}
+	if limiter != nil {
+		interceptors = append(interceptors, rateLimitHandler(limiter))
+	}
+	s.grpcServer = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(append(interceptors, actorHandler)...),
+		grpc.ChainStreamInterceptor(requestIDStreamHandler, loggingStreamHandler, actorStreamHandler),
+	)
+	api.RegisterEventsServer(s.grpcServer, s)
+	return s
 }
 
 func (s *Server) Start(_ context.Context) error {
-	s.grpcServer = grpc.NewServer(grpc.UnaryInterceptor(loggingHandler))
-	api.RegisterEventsServer(s.grpcServer, s)
-
 	lsn, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		log.Errorf("failed to listen grpc endpoint: %v", err)
 		return err
 	}
+	if s.tls.Enabled {
+		tlsConfig, err := s.tls.Load()
+		if err != nil {
+			lsn.Close()
+			return fmt.Errorf("failed to load tls config: %w", err)
+		}
+		// gRPC clients negotiate HTTP/2 through ALPN.
+		tlsConfig.NextProtos = []string{"h2"}
+		lsn = tls.NewListener(lsn, tlsConfig)
+	}
 
 	log.Printf("starting grpc server on %s", s.addr)
-	err = s.grpcServer.Serve(lsn)
-	return err
+	return s.Serve(lsn)
 }
 
-func (s *Server) Stop(_ context.Context) error {
-	s.grpcServer.GracefulStop()
-	return nil
+// Serve serves the calls accepted by the listener until the server is stopped.
+func (s *Server) Serve(lsn net.Listener) error {
+	return s.grpcServer.Serve(lsn)
+}
+
+// Stop waits for in-flight calls to finish, watch streams are interrupted at once.
+// When ctx is done before the calls are finished the remaining ones are cancelled.
+func (s *Server) Stop(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return fmt.Errorf("failed to drain grpc server: %w", ctx.Err())
+	}
 }
 
 func (s *Server) AddEvent(ctx context.Context, r *api.AddEventRequest) (*api.AddEventResponse, error) {
@@ -74,57 +140,190 @@ func (s *Server) AddEvent(ctx context.Context, r *api.AddEventRequest) (*api.Add
 		if errors.Is(err, storage.ErrIncorrectEventTime) {
 			return nil, status.Errorf(codes.InvalidArgument, errIncorrectEventTime)
 		}
-		log.Errorf("failed to convert events: %v", err)
+		logger.FromContext(ctx).Errorf("failed to convert events: %v", err)
 		return nil, status.Errorf(codes.Internal, errInternalServerError)
 	}
 
-	event.ID, err = s.app.CreateEvent(ctx, event)
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		key = firstValue(md, idempotencyKeyMetadata)
+	}
+	event, err = s.app.CreateEventIdempotent(ctx, key, event)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, storage.ErrDuplicateEventID):
+			return nil, status.Errorf(codes.AlreadyExists, "%v", err)
+		case errors.Is(err, storage.ErrIncorrectEventTime):
+			return nil, status.Errorf(codes.InvalidArgument, errIncorrectEventTime)
+		case errors.Is(err, storage.ErrInvalidEvent):
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		case errors.Is(err, storage.ErrIdempotencyKeyReused):
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		case errors.Is(err, storage.ErrIdempotencyKeyInProgress):
+			// The call may be retried once the first one completes.
+			return nil, status.Errorf(codes.Unavailable, "%v", err)
+		}
+		logger.FromContext(ctx).Errorf("failed to add event: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
 	}
 	return &api.AddEventResponse{Event: toAPIEvent(event)}, nil
 }
 
-func (s *Server) UpdateEvent(ctx context.Context, r *api.UpdateEventRequest) (*empty.Empty, error) {
+func (s *Server) UpdateEvent(ctx context.Context, r *api.UpdateEventRequest) (*api.UpdateEventResponse, error) {
 	if r.GetEvent() == nil {
 		return nil, status.Errorf(codes.InvalidArgument, errEventNotProvided)
 	}
+	if len(r.GetUpdateMask().GetPaths()) > 0 {
+		return s.patchEvent(ctx, r)
+	}
 	event, err := toStorageEvent(r.GetEvent())
 	if err != nil {
 		if errors.Is(err, storage.ErrIncorrectEventTime) {
 			return nil, status.Errorf(codes.InvalidArgument, errIncorrectEventTime)
 		}
-		log.Errorf("failed to convert events: %v", err)
+		logger.FromContext(ctx).Errorf("failed to convert events: %v", err)
 		return nil, status.Errorf(codes.Internal, errInternalServerError)
 	}
 
-	err = s.app.UpdateEvent(ctx, r.GetId(), event)
+	version, err := s.app.UpdateEvent(ctx, r.GetId(), event, r.GetVersion())
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFoundEvent) {
 			return nil, status.Errorf(codes.NotFound, errEventNotFound)
 		}
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return nil, status.Errorf(codes.Aborted, errVersionConflict)
+		}
+		if errors.Is(err, storage.ErrInvalidEvent) {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
 		return nil, status.Errorf(codes.Internal, errInternalServerError)
 	}
-	return &empty.Empty{}, nil
+	return &api.UpdateEventResponse{Version: version}, nil
+}
+
+// patchEvent updates only the fields listed in the request mask.
+func (s *Server) patchEvent(ctx context.Context, r *api.UpdateEventRequest) (*api.UpdateEventResponse, error) {
+	patch, err := toEventPatch(r.GetEvent(), r.GetUpdateMask())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	event, err := s.app.PatchEvent(ctx, r.GetId(), patch, r.GetVersion())
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFoundEvent):
+			return nil, status.Errorf(codes.NotFound, errEventNotFound)
+		case errors.Is(err, storage.ErrVersionConflict):
+			return nil, status.Errorf(codes.Aborted, errVersionConflict)
+		case errors.Is(err, storage.ErrIncorrectEventTime):
+			return nil, status.Errorf(codes.InvalidArgument, errIncorrectEventTime)
+		case errors.Is(err, storage.ErrInvalidEvent):
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		logger.FromContext(ctx).Errorf("failed to patch event: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.UpdateEventResponse{Version: event.Version, Event: toAPIEvent(event)}, nil
 }
 
 func (s *Server) RemoveEvent(ctx context.Context, r *api.RemoveEventRequest) (*empty.Empty, error) {
-	err := s.app.RemoveEvent(ctx, r.GetId())
+	err := s.app.RemoveEvent(ctx, r.GetId(), r.GetVersion())
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFoundEvent) {
 			return nil, status.Errorf(codes.NotFound, errEventNotFound)
 		}
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return nil, status.Errorf(codes.Aborted, errVersionConflict)
+		}
 		return nil, err
 	}
 	return &empty.Empty{}, nil
 }
 
+func (s *Server) GetEvent(ctx context.Context, r *api.GetEventRequest) (*api.GetEventResponse, error) {
+	event, err := s.app.GetEvent(ctx, r.GetId())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFoundEvent) {
+			return nil, status.Errorf(codes.NotFound, errEventNotFound)
+		}
+		logger.FromContext(ctx).Errorf("failed to get event: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.GetEventResponse{Event: toAPIEvent(event)}, nil
+}
+
+func (s *Server) RestoreEvent(ctx context.Context, r *api.RestoreEventRequest) (*api.GetEventResponse, error) {
+	event, err := s.app.RestoreEvent(ctx, r.GetId())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFoundEvent) {
+			return nil, status.Errorf(codes.NotFound, errEventNotFound)
+		}
+		logger.FromContext(ctx).Errorf("failed to restore event: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.GetEventResponse{Event: toAPIEvent(event)}, nil
+}
+
+func (s *Server) ListTrash(ctx context.Context, r *api.ListTrashRequest) (*api.GetEventsResponse, error) {
+	events, err := s.app.ListTrash(ctx, r.GetOwnerId())
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to list trash: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.GetEventsResponse{Events: toAPIEvents(events)}, nil
+}
+
+func (s *Server) BatchCreate(ctx context.Context, r *api.BatchCreateRequest) (*api.BatchResponse, error) {
+	events := make([]storage.Event, 0, len(r.GetEvents()))
+	for _, e := range r.GetEvents() {
+		// An event with invalid timestamps keeps zero times and is rejected by the storage.
+		event, _ := toStorageEvent(e)
+		events = append(events, event)
+	}
+	results, err := s.app.BatchCreate(ctx, events)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to create events: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.BatchResponse{Results: toAPIBatchResults(results)}, nil
+}
+
+func (s *Server) BatchUpdate(ctx context.Context, r *api.BatchUpdateRequest) (*api.BatchResponse, error) {
+	items := make([]storage.BatchUpdateItem, 0, len(r.GetItems()))
+	for _, item := range r.GetItems() {
+		if item.GetEvent() == nil {
+			return nil, status.Errorf(codes.InvalidArgument, errEventNotProvided)
+		}
+		event, _ := toStorageEvent(item.GetEvent())
+		items = append(items, storage.BatchUpdateItem{ID: item.GetId(), Event: event, Version: item.GetVersion()})
+	}
+	results, err := s.app.BatchUpdate(ctx, items)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to update events: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.BatchResponse{Results: toAPIBatchResults(results)}, nil
+}
+
+func (s *Server) BatchDelete(ctx context.Context, r *api.BatchDeleteRequest) (*api.BatchResponse, error) {
+	items := make([]storage.BatchRemoveItem, 0, len(r.GetItems()))
+	for _, item := range r.GetItems() {
+		items = append(items, storage.BatchRemoveItem{ID: item.GetId(), Version: item.GetVersion()})
+	}
+	results, err := s.app.BatchDelete(ctx, items)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to remove events: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.BatchResponse{Results: toAPIBatchResults(results)}, nil
+}
+
 func (s *Server) GetEventsForDay(ctx context.Context, r *api.GetEventsRequest) (*api.GetEventsResponse, error) {
 	date := r.GetStartDate()
 	if err := validateDate(date); err != nil {
 		return nil, err
 	}
-	events, err := s.app.GetEventsForDay(ctx, date.AsTime())
+	events, err := s.app.GetEventsForDay(ctx, date.AsTime(), storage.EventFilter{Tags: r.GetTags()})
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, errInternalServerError)
 	}
@@ -137,7 +336,7 @@ func (s *Server) GetEventsForWeek(ctx context.Context, r *api.GetEventsRequest)
 	if err := validateDate(date); err != nil {
 		return nil, err
 	}
-	events, err := s.app.GetEventsForWeek(ctx, date.AsTime())
+	events, err := s.app.GetEventsForWeek(ctx, date.AsTime(), storage.EventFilter{Tags: r.GetTags()})
 	if err != nil {
 		if errors.Is(err, storage.ErrIncorrectStartDate) {
 			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
@@ -153,7 +352,7 @@ func (s *Server) GetEventsForMonth(ctx context.Context, r *api.GetEventsRequest)
 	if err := validateDate(date); err != nil {
 		return nil, err
 	}
-	events, err := s.app.GetEventsForMonth(ctx, date.AsTime())
+	events, err := s.app.GetEventsForMonth(ctx, date.AsTime(), storage.EventFilter{Tags: r.GetTags()})
 	if err != nil {
 		if errors.Is(err, storage.ErrIncorrectStartDate) {
 			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
@@ -164,31 +363,300 @@ func (s *Server) GetEventsForMonth(ctx context.Context, r *api.GetEventsRequest)
 	return &api.GetEventsResponse{Events: toAPIEvents(events)}, nil
 }
 
+func (s *Server) GetTagStats(ctx context.Context, r *api.GetTagStatsRequest) (*api.TagStatsResponse, error) {
+	stats, err := s.app.GetTagStats(ctx, r.GetOwnerId())
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to get tag stats: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	apiStats := make([]*api.TagCount, 0, len(stats))
+	for _, stat := range stats {
+		apiStats = append(apiStats, &api.TagCount{Tag: stat.Tag, Count: int32(stat.Count)})
+	}
+	return &api.TagStatsResponse{Stats: apiStats}, nil
+}
+
+// defaultSearchLimit is used when the search request has no limit.
+const defaultSearchLimit = 50
+
+func (s *Server) SearchEvents(ctx context.Context, r *api.SearchEventsRequest) (*api.SearchEventsResponse, error) {
+	limit := int(r.GetLimit())
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	results, err := s.app.SearchEvents(ctx, r.GetQuery(), r.GetOwnerId(), limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidSearchQuery) {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		logger.FromContext(ctx).Errorf("failed to search events: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	apiResults := make([]*api.SearchResult, 0, len(results))
+	for _, result := range results {
+		apiResults = append(apiResults, &api.SearchResult{Event: toAPIEvent(result.Event), Rank: result.Rank})
+	}
+	return &api.SearchEventsResponse{Results: apiResults}, nil
+}
+
+func (s *Server) QuickAddEvent(ctx context.Context, r *api.QuickAddEventRequest) (*api.GetEventResponse, error) {
+	event, err := s.app.QuickAddEvent(ctx, r.GetText(), r.GetOwnerId(), r.GetTimeZone())
+	if err != nil {
+		switch {
+		case errors.Is(err, quickadd.ErrInvalidText), errors.Is(err, storage.ErrInvalidEvent):
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		case errors.Is(err, storage.ErrIncorrectEventTime):
+			return nil, status.Errorf(codes.InvalidArgument, errIncorrectEventTime)
+		}
+		logger.FromContext(ctx).Errorf("failed to quick-add event: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.GetEventResponse{Event: toAPIEvent(event)}, nil
+}
+
+func (s *Server) WatchEvents(r *api.WatchEventsRequest, stream api.Events_WatchEventsServer) error {
+	var after int64
+	if r.GetResumeToken() != "" {
+		var err error
+		after, err = strconv.ParseInt(r.GetResumeToken(), 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, errInvalidResumeToken)
+		}
+	}
+	changes, err := s.app.WatchEvents(stream.Context(), r.GetOwnerId(), after)
+	if errors.Is(err, storage.ErrTokenExpired) {
+		return status.Errorf(codes.OutOfRange, errResumeTokenExpired)
+	}
+	if err != nil {
+		logger.FromContext(stream.Context()).Errorf("failed to watch events: %v", err)
+		return status.Errorf(codes.Internal, errInternalServerError)
+	}
+	for {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				return watchEnded(stream.Context())
+			}
+			if err := stream.Send(toAPIChange(c)); err != nil {
+				return err
+			}
+		case <-s.closing:
+			return status.Errorf(codes.Unavailable, "server is shutting down, resume from the last token")
+		}
+	}
+}
+
+func watchEnded(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	// The feed is closed while the client is still connected, it has to resume.
+	return status.Errorf(codes.Unavailable, "watch interrupted, resume from the last token")
+}
+
+// defaultActivityLimit is used when the activity request has no limit.
+const defaultActivityLimit = 100
+
+func (s *Server) GetEventHistory(ctx context.Context, r *api.GetEventHistoryRequest) (*api.AuditResponse, error) {
+	records, err := s.app.GetEventHistory(ctx, r.GetId())
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to get event history: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.AuditResponse{Records: toAPIAuditRecords(records)}, nil
+}
+
+func (s *Server) GetOwnerActivity(ctx context.Context, r *api.GetOwnerActivityRequest) (*api.AuditResponse, error) {
+	var from, to time.Time
+	if r.GetFrom() != nil {
+		from = r.GetFrom().AsTime()
+	}
+	if r.GetTo() != nil {
+		to = r.GetTo().AsTime()
+	}
+	limit := int(r.GetLimit())
+	if limit <= 0 {
+		limit = defaultActivityLimit
+	}
+	records, err := s.app.GetOwnerActivity(ctx, r.GetOwnerId(), from, to, limit)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to get owner activity: %v", err)
+		return nil, status.Errorf(codes.Internal, errInternalServerError)
+	}
+	return &api.AuditResponse{Records: toAPIAuditRecords(records)}, nil
+}
+
+func toAPIAuditRecords(records []storage.AuditRecord) []*api.AuditRecord {
+	result := make([]*api.AuditRecord, 0, len(records))
+	for _, r := range records {
+		record := &api.AuditRecord{
+			Id:      r.ID,
+			Action:  toAPIAuditAction(r.Action),
+			EventId: r.EventID,
+			OwnerId: r.OwnerID,
+			Actor:   r.Actor,
+			Time:    timestamppb.New(r.Time),
+		}
+		if r.Before != nil {
+			record.Before = toAPIEvent(*r.Before)
+		}
+		if r.After != nil {
+			record.After = toAPIEvent(*r.After)
+		}
+		result = append(result, record)
+	}
+	return result
+}
+
+func toAPIAuditAction(action storage.AuditAction) api.AuditAction {
+	switch action {
+	case storage.AuditCreated:
+		return api.AuditAction_AUDIT_ACTION_CREATED
+	case storage.AuditUpdated:
+		return api.AuditAction_AUDIT_ACTION_UPDATED
+	case storage.AuditDeleted:
+		return api.AuditAction_AUDIT_ACTION_DELETED
+	case storage.AuditPurged:
+		return api.AuditAction_AUDIT_ACTION_PURGED
+	case storage.AuditNotified:
+		return api.AuditAction_AUDIT_ACTION_NOTIFIED
+	case storage.AuditRestored:
+		return api.AuditAction_AUDIT_ACTION_RESTORED
+	default:
+		return api.AuditAction_AUDIT_ACTION_UNSPECIFIED
+	}
+}
+
+func toAPIChange(c storage.Change) *api.EventChange {
+	changeType := api.ChangeType_CHANGE_TYPE_UNSPECIFIED
+	switch c.Type {
+	case storage.ChangeCreated:
+		changeType = api.ChangeType_CHANGE_TYPE_CREATED
+	case storage.ChangeUpdated:
+		changeType = api.ChangeType_CHANGE_TYPE_UPDATED
+	case storage.ChangeDeleted:
+		changeType = api.ChangeType_CHANGE_TYPE_DELETED
+	}
+	return &api.EventChange{
+		Token: strconv.FormatInt(c.Token, 10),
+		Type:  changeType,
+		Event: toAPIEvent(c.Event),
+		Time:  timestamppb.New(c.Time),
+	}
+}
+
 func toStorageEvent(e *api.Event) (storage.Event, error) {
-	if !e.StartTime.IsValid() || !e.EndTime.IsValid() {
+	if !e.StartTime.IsValid() || (!e.EndTime.IsValid() && !e.AllDay) {
 		return storage.Event{}, storage.ErrIncorrectEventTime
 	}
 	return storage.Event{
-		ID:           e.Id,
-		Title:        e.Title,
-		StartTime:    e.StartTime.AsTime(),
-		EndTime:      e.EndTime.AsTime(),
-		Description:  e.Description,
-		OwnerID:      e.OwnerId,
-		NotifyBefore: e.NotifyBefore,
+		ID:            e.Id,
+		Title:         e.Title,
+		StartTime:     e.StartTime.AsTime(),
+		EndTime:       e.EndTime.AsTime(),
+		Description:   e.Description,
+		OwnerID:       e.OwnerId,
+		NotifyBefore:  e.NotifyBefore,
+		Version:       e.Version,
+		Tags:          e.Tags,
+		Color:         e.Color,
+		Location:      toStorageLocation(e.Location),
+		ConferenceURL: e.ConferenceUrl,
+		AllDay:        e.AllDay,
 	}, nil
 }
 
+func toStorageLocation(l *api.Location) storage.Location {
+	location := storage.Location{Name: l.GetName()}
+	if geo := l.GetGeo(); geo != nil {
+		location.Geo = &storage.GeoPoint{Latitude: geo.GetLatitude(), Longitude: geo.GetLongitude()}
+	}
+	return location
+}
+
+func toEventPatch(e *api.Event, mask *fieldmaskpb.FieldMask) (storage.EventPatch, error) {
+	patch := storage.EventPatch{}
+	for _, path := range mask.GetPaths() {
+		switch path {
+		case "title":
+			patch.Title = &e.Title
+		case "startTime":
+			startTime, err := toTime(e.StartTime)
+			if err != nil {
+				return patch, err
+			}
+			patch.StartTime = &startTime
+		case "endTime":
+			endTime, err := toTime(e.EndTime)
+			if err != nil {
+				return patch, err
+			}
+			patch.EndTime = &endTime
+		case "description":
+			patch.Description = &e.Description
+		case "ownerId":
+			patch.OwnerID = &e.OwnerId
+		case "notifyBefore":
+			patch.NotifyBefore = &e.NotifyBefore
+		case "tags":
+			patch.Tags = &e.Tags
+		case "color":
+			patch.Color = &e.Color
+		case "location":
+			location := toStorageLocation(e.Location)
+			patch.Location = &location
+		case "conferenceUrl":
+			patch.ConferenceURL = &e.ConferenceUrl
+		case "allDay":
+			patch.AllDay = &e.AllDay
+		default:
+			return patch, fmt.Errorf("%w: field %q cannot be patched", storage.ErrInvalidPatch, path)
+		}
+	}
+	return patch, nil
+}
+
+// toTime converts a masked timestamp, an unset one resets the field.
+func toTime(t *timestamppb.Timestamp) (time.Time, error) {
+	if t == nil {
+		return time.Time{}, nil
+	}
+	if !t.IsValid() {
+		return time.Time{}, storage.ErrIncorrectEventTime
+	}
+	return t.AsTime(), nil
+}
+
 func toAPIEvent(e storage.Event) *api.Event {
-	return &api.Event{
-		Id:           e.ID,
-		Title:        e.Title,
-		StartTime:    timestamppb.New(e.StartTime),
-		EndTime:      timestamppb.New(e.EndTime),
-		Description:  e.Description,
-		OwnerId:      e.OwnerID,
-		NotifyBefore: e.NotifyBefore,
+	event := &api.Event{
+		Id:            e.ID,
+		Title:         e.Title,
+		StartTime:     timestamppb.New(e.StartTime),
+		EndTime:       timestamppb.New(e.EndTime),
+		Description:   e.Description,
+		OwnerId:       e.OwnerID,
+		NotifyBefore:  e.NotifyBefore,
+		Version:       e.Version,
+		UpdatedAt:     timestamppb.New(e.UpdatedAt),
+		Tags:          e.Tags,
+		Color:         e.Color,
+		Location:      toAPILocation(e.Location),
+		ConferenceUrl: e.ConferenceURL,
+		AllDay:        e.AllDay,
+		Attachments:   toAPIAttachments(e.Attachments),
+	}
+	if e.DeletedAt != nil {
+		event.DeletedAt = timestamppb.New(*e.DeletedAt)
 	}
+	return event
+}
+
+func toAPILocation(l storage.Location) *api.Location {
+	location := &api.Location{Name: l.Name}
+	if l.Geo != nil {
+		location.Geo = &api.GeoPoint{Latitude: l.Geo.Latitude, Longitude: l.Geo.Longitude}
+	}
+	return location
 }
 
 func toAPIEvents(events []storage.Event) []*api.Event {
@@ -199,6 +667,36 @@ func toAPIEvents(events []storage.Event) []*api.Event {
 	return apiEvents
 }
 
+func toAPIBatchResults(results []storage.BatchResult) []*api.BatchResult {
+	apiResults := make([]*api.BatchResult, 0, len(results))
+	for _, res := range results {
+		apiResult := &api.BatchResult{Id: res.ID, Version: res.Version, Code: int32(codes.OK)}
+		if res.Err != nil {
+			apiResult.Code = int32(errorCode(res.Err))
+			apiResult.Error = res.Err.Error()
+		}
+		apiResults = append(apiResults, apiResult)
+	}
+	return apiResults
+}
+
+// errorCode maps storage errors to gRPC status codes.
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, storage.ErrNotFoundEvent):
+		return codes.NotFound
+	case errors.Is(err, storage.ErrDuplicateEventID):
+		return codes.AlreadyExists
+	case errors.Is(err, storage.ErrVersionConflict):
+		return codes.Aborted
+	case errors.Is(err, storage.ErrIncorrectEventTime), errors.Is(err, storage.ErrInvalidPatch),
+		errors.Is(err, storage.ErrInvalidEvent):
+		return codes.InvalidArgument
+	default:
+		return codes.Internal
+	}
+}
+
 func validateDate(date *timestamppb.Timestamp) error {
 	if date == nil {
 		return status.Errorf(codes.InvalidArgument, errDateIsNotProvided)
@@ -0,0 +1,69 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+)
+
+type AttachmentReq struct {
+	EventID string `json:"eventId"`
+	ID      string `json:"id"`
+}
+
+// UploadAttachment streams the body to a new attachment of the event. The event and the file name
+// are taken from the eventId and name query parameters, an absent Content-Type is detected.
+func (s *Server) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	attachment, err := s.app.UploadAttachment(
+		r.Context(), query.Get("eventId"), query.Get("name"), r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// DownloadAttachment streams the content of the attachment selected by the eventId and id query parameters.
+func (s *Server) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	attachment, content, err := s.app.OpenAttachment(r.Context(), query.Get("eventId"), query.Get("id"))
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	defer content.Close()
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	// The stored type is used as is, browsers must not guess another one.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to send attachment %q: %v", attachment.ID, err)
+	}
+}
+
+func (s *Server) RemoveAttachment(w http.ResponseWriter, r *http.Request) {
+	req := AttachmentReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	if err := s.app.RemoveAttachment(r.Context(), req.EventID, req.ID); err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
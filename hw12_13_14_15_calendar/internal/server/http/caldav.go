@@ -0,0 +1,734 @@
+package internalhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ical"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// caldavPrefix is the root of the CalDAV tree, the calendar of an owner is the collection
+	// caldavPrefix/{owner}/ and an event is its resource {id}.ics.
+	caldavPrefix = "/caldav/"
+	// maxCalendarObjectSize bounds the objects put by the clients.
+	maxCalendarObjectSize = 1 << 20
+
+	davNS            = "DAV:"
+	caldavNS         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNS = "http://calendarserver.org/ns/"
+	davTimeLayout    = "20060102T150405Z"
+
+	statusOK       = "HTTP/1.1 200 OK"
+	statusNotFound = "HTTP/1.1 404 Not Found"
+)
+
+var (
+	ErrInvalidDAVRequest = errors.New("invalid WebDAV request")
+	ErrUnsupportedReport = errors.New("unsupported report")
+)
+
+// CaldavConfig lists the users who may sign in to CalDAV with Basic authentication. When it lists any,
+// every CalDAV request has to sign in.
+type CaldavConfig struct {
+	Passwords []CaldavPassword
+}
+
+type CaldavPassword struct {
+	User string
+	// Bcrypt is the bcrypt hash of the password, so the config doesn't keep the password itself.
+	Bcrypt string
+}
+
+func (c CaldavConfig) Validate() error {
+	var v internalconfig.Validation
+	for i, p := range c.Passwords {
+		field := fmt.Sprintf("passwords[%d]", i)
+		v.Required(field+".user", p.User)
+		if _, err := bcrypt.Cost([]byte(p.Bcrypt)); err != nil {
+			v.Addf(field+".bcrypt", "must be a bcrypt hash: %v", err)
+		}
+	}
+	return v.Err()
+}
+
+func (c CaldavConfig) passwords() map[string][]byte {
+	passwords := make(map[string][]byte, len(c.Passwords))
+	for _, p := range c.Passwords {
+		passwords[p.User] = []byte(p.Bcrypt)
+	}
+	return passwords
+}
+
+// unknownUserHash is compared with the passwords of unknown users, so the time tells nothing about them.
+var unknownUserHash = []byte("$2a$10$4HSZGOJXV13u3U4RymCRGeyVGoqJ4wsNqi5UhuGamQjzksRmgm.BC")
+
+var (
+	calendarDataProp = xml.Name{Space: caldavNS, Local: "calendar-data"}
+	calendarQuery    = xml.Name{Space: caldavNS, Local: "calendar-query"}
+	calendarMultiget = xml.Name{Space: caldavNS, Local: "calendar-multiget"}
+)
+
+// caldavPath is a path of the CalDAV tree, the root has no owner and a collection has no resource name.
+type caldavPath struct {
+	owner string
+	name  string
+}
+
+func parseCaldavPath(p string) (caldavPath, bool) {
+	rest := strings.TrimPrefix(p, caldavPrefix)
+	if rest == "" {
+		return caldavPath{}, true
+	}
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "":
+		return caldavPath{owner: parts[0]}, true
+	case len(parts) == 2 && parts[0] != "" && strings.HasSuffix(parts[1], ".ics") && len(parts[1]) > len(".ics"):
+		return caldavPath{owner: parts[0], name: strings.TrimSuffix(parts[1], ".ics")}, true
+	default:
+		return caldavPath{}, false
+	}
+}
+
+func collectionHref(owner string) string {
+	return caldavPrefix + url.PathEscape(owner) + "/"
+}
+
+// caldavNames maps the names of the resources put by the clients to their events and back,
+// the other events are the resources named by their IDs.
+type caldavNames struct {
+	events map[string]string
+	names  map[string]string
+}
+
+func (s *Server) caldavNames(ctx context.Context, owner string) (caldavNames, error) {
+	events, err := s.app.GetCaldavNames(ctx, owner)
+	if err != nil {
+		return caldavNames{}, err
+	}
+	names := make(map[string]string, len(events))
+	for name, id := range events {
+		names[id] = name
+	}
+	return caldavNames{events: events, names: names}, nil
+}
+
+func (n caldavNames) eventID(name string) string {
+	if id, ok := n.events[name]; ok {
+		return id
+	}
+	return name
+}
+
+func (n caldavNames) href(e storage.Event) string {
+	name, ok := n.names[e.ID]
+	if !ok {
+		name = e.ID
+	}
+	return collectionHref(e.OwnerID) + url.PathEscape(name) + ".ics"
+}
+
+// CalDAV serves the events of every owner as a calendar collection with the versions of the events
+// as their ETags. It supports PROPFIND, the calendar-query and calendar-multiget reports and GET, PUT
+// and DELETE of the resources. The events are named by their IDs, the name of a resource put by a client
+// is linked to the event created for it.
+// The users sign in with the Basic authentication passwords of the config, without any passwords they
+// are identified by the X-User-ID header like in the rest of the API. A user may only access their own calendar.
+func (s *Server) CalDAV(w http.ResponseWriter, r *http.Request) {
+	p, ok := parseCaldavPath(r.URL.Path)
+	if !ok {
+		returnCaldavErr(w, r, fmt.Errorf("%w: %q", storage.ErrNotFoundEvent, r.URL.Path))
+		return
+	}
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r, ok = s.caldavAuthenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="calendar", charset="UTF-8"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if actor, _ := actorOf(r.Context()); p.owner != "" && p.owner != actor {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	resource := p.name != ""
+	switch {
+	case r.Method == "PROPFIND":
+		s.caldavPropfind(w, r, p)
+	case r.Method == "REPORT" && p.owner != "" && !resource:
+		s.caldavReport(w, r, p.owner)
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && resource:
+		s.caldavGet(w, r, p)
+	case r.Method == http.MethodPut && resource:
+		s.caldavPut(w, r, p)
+	case r.Method == http.MethodDelete && resource:
+		s.caldavDelete(w, r, p)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// caldavAuthenticate sets the user of the valid Basic credentials as the actor of the request. The actor
+// of the X-User-ID header is kept only when no passwords are configured. It returns false when
+// the credentials are missing or wrong, or the request has no actor.
+func (s *Server) caldavAuthenticate(r *http.Request) (*http.Request, bool) {
+	if len(s.caldavPasswords) == 0 {
+		_, known := actorOf(r.Context())
+		return r, known
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return r, false
+	}
+	hash, found := s.caldavPasswords[user]
+	if !found {
+		hash = unknownUserHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !found {
+		return r, false
+	}
+	return r.WithContext(storage.WithActor(r.Context(), user)), true
+}
+
+// WellKnownCalDAV points the clients discovering the service to the CalDAV root (RFC 6764).
+func (s *Server) WellKnownCalDAV(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, caldavPrefix, http.StatusMovedPermanently)
+}
+
+// ownedEvent returns the event of the path, events of other owners are not found. The ID of an event
+// named by it has to match the name exactly, so the resource keeps the href it is listed with.
+func (s *Server) ownedEvent(ctx context.Context, p caldavPath, names caldavNames) (storage.Event, error) {
+	id := names.eventID(p.name)
+	e, err := s.app.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if e.OwnerID != p.owner || e.ID != id {
+		return storage.Event{}, fmt.Errorf("resource %q of owner %q: %w", p.name, p.owner, storage.ErrNotFoundEvent)
+	}
+	return e, nil
+}
+
+// ownedResource returns the event of the path along with the names of the owner's resources.
+func (s *Server) ownedResource(ctx context.Context, p caldavPath) (storage.Event, caldavNames, error) {
+	names, err := s.caldavNames(ctx, p.owner)
+	if err != nil {
+		return storage.Event{}, caldavNames{}, err
+	}
+	e, err := s.ownedEvent(ctx, p, names)
+	return e, names, err
+}
+
+func (s *Server) caldavGet(w http.ResponseWriter, r *http.Request, p caldavPath) {
+	e, _, err := s.ownedResource(r.Context(), p)
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	data := ical.Encode(e, e.ID)
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", etag(e.Version))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// caldavPut creates or replaces the event, If-Match and "If-None-Match: *" are checked. A new event
+// gets an ID of the storage and the name of the resource is linked to it.
+func (s *Server) caldavPut(w http.ResponseWriter, r *http.Request, p caldavPath) {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCalendarObjectSize+1))
+	if err != nil {
+		returnCaldavErr(w, r, fmt.Errorf("failed to read calendar object: %w", err))
+		return
+	}
+	if len(data) > maxCalendarObjectSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	e, _, err := ical.Decode(data)
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	e.OwnerID = p.owner
+
+	current, _, err := s.ownedResource(r.Context(), p)
+	switch {
+	case err == nil:
+		if r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		e.ID = current.ID
+		version, err = s.app.UpdateEvent(r.Context(), current.ID, e, version)
+		if err != nil {
+			returnCaldavErr(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", etag(version))
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, storage.ErrNotFoundEvent):
+		if version != 0 {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		e, err = s.app.CreateCaldavEvent(r.Context(), p.name, e)
+		if err != nil {
+			returnCaldavErr(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", etag(e.Version))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		returnCaldavErr(w, r, err)
+	}
+}
+
+func (s *Server) caldavDelete(w http.ResponseWriter, r *http.Request, p caldavPath) {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	e, _, err := s.ownedResource(r.Context(), p)
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	if err := s.app.RemoveEvent(r.Context(), e.ID, version); err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davProp is a property with its value as raw XML.
+type davProp struct {
+	XMLName xml.Name
+	Value   string `xml:",innerxml"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+	// Status is set for resources which are not found.
+	Status string `xml:"DAV: status,omitempty"`
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"DAV: prop"`
+	Status string      `xml:"DAV: status"`
+}
+
+type davPropList struct {
+	Props []davProp
+}
+
+type davName struct {
+	XMLName xml.Name
+}
+
+type davPropNames struct {
+	Names []davName `xml:",any"`
+}
+
+// propRequest lists the properties asked for, allprop returns all of them but the calendar data
+// and propname returns their names.
+type propRequest struct {
+	XMLName  xml.Name
+	AllProp  *struct{}    `xml:"DAV: allprop"`
+	PropName *struct{}    `xml:"DAV: propname"`
+	Prop     davPropNames `xml:"DAV: prop"`
+}
+
+// withData reports whether the calendar data is asked for.
+func (req propRequest) withData() bool {
+	for _, name := range req.Prop.Names {
+		if name.XMLName == calendarDataProp {
+			return true
+		}
+	}
+	return false
+}
+
+// response returns the properties of the resource asked for, the missing ones are reported as not found.
+func (req propRequest) response(href string, props []davProp) davResponse {
+	var found, missing []davProp
+	switch {
+	case req.PropName != nil:
+		for _, p := range props {
+			found = append(found, davProp{XMLName: p.XMLName})
+		}
+	case len(req.Prop.Names) == 0:
+		for _, p := range props {
+			if p.XMLName != calendarDataProp {
+				found = append(found, p)
+			}
+		}
+	default:
+		for _, name := range req.Prop.Names {
+			p, ok := findProp(props, name.XMLName)
+			if ok {
+				found = append(found, p)
+			} else {
+				missing = append(missing, davProp{XMLName: name.XMLName})
+			}
+		}
+	}
+	resp := davResponse{Href: href}
+	if len(found) > 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{Prop: davPropList{Props: found}, Status: statusOK})
+	}
+	if len(missing) > 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{Prop: davPropList{Props: missing}, Status: statusNotFound})
+	}
+	return resp
+}
+
+func findProp(props []davProp, name xml.Name) (davProp, bool) {
+	for _, p := range props {
+		if p.XMLName == name {
+			return p, true
+		}
+	}
+	return davProp{}, false
+}
+
+// parseDAVBody decodes the XML body into v, an empty body leaves v as is.
+func parseDAVBody(r *http.Request, v interface{}) error {
+	err := xml.NewDecoder(io.LimitReader(r.Body, maxCalendarObjectSize)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %v", ErrInvalidDAVRequest, err)
+	}
+	return nil
+}
+
+// caldavPropfind returns the properties of the resource, Depth 1 adds the ones of its members.
+// The members of the root are the collection of the actor only, as the owners are not listed.
+func (s *Server) caldavPropfind(w http.ResponseWriter, r *http.Request, p caldavPath) {
+	var req propRequest
+	if err := parseDAVBody(r, &req); err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	members := r.Header.Get("Depth") != "0"
+	actor, known := actorOf(ctx)
+	var responses []davResponse
+	switch {
+	case p.owner == "":
+		responses = append(responses, req.response(caldavPrefix, rootProps(ctx)))
+		if !members || !known {
+			break
+		}
+		p.owner = actor
+		fallthrough
+	case p.name == "":
+		events, err := s.app.GetOwnerEvents(ctx, p.owner, time.Time{}, time.Time{})
+		if err != nil {
+			returnCaldavErr(w, r, err)
+			return
+		}
+		responses = append(responses, req.response(collectionHref(p.owner), collectionProps(ctx, p.owner, events)))
+		if members && r.URL.Path != caldavPrefix {
+			names, err := s.caldavNames(ctx, p.owner)
+			if err != nil {
+				returnCaldavErr(w, r, err)
+				return
+			}
+			for _, e := range events {
+				responses = append(responses, req.response(names.href(e), eventProps(e, req.withData())))
+			}
+		}
+	default:
+		e, names, err := s.ownedResource(ctx, p)
+		if err != nil {
+			returnCaldavErr(w, r, err)
+			return
+		}
+		responses = append(responses, req.response(names.href(e), eventProps(e, req.withData())))
+	}
+	writeMultistatus(w, r, responses)
+}
+
+// reportRequest is the body of the calendar-query and calendar-multiget reports.
+type reportRequest struct {
+	XMLName  xml.Name
+	AllProp  *struct{}    `xml:"DAV: allprop"`
+	PropName *struct{}    `xml:"DAV: propname"`
+	Prop     davPropNames `xml:"DAV: prop"`
+	Hrefs    []string     `xml:"DAV: href"`
+	Filter   *compFilter  `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+type compFilter struct {
+	Name      string `xml:"name,attr"`
+	TimeRange *struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	Comps []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// caldavReport runs the calendar-query report filtering the events by the time range of the
+// VEVENT filter, property filters are not applied, or the calendar-multiget report.
+func (s *Server) caldavReport(w http.ResponseWriter, r *http.Request, owner string) {
+	var req reportRequest
+	if err := parseDAVBody(r, &req); err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	var (
+		responses []davResponse
+		err       error
+	)
+	switch req.XMLName {
+	case calendarQuery:
+		responses, err = s.calendarQuery(r.Context(), owner, req)
+	case calendarMultiget:
+		responses, err = s.calendarMultiget(r.Context(), owner, req)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedReport, req.XMLName.Local)
+	}
+	if err != nil {
+		returnCaldavErr(w, r, err)
+		return
+	}
+	writeMultistatus(w, r, responses)
+}
+
+func (req reportRequest) props() propRequest {
+	return propRequest{AllProp: req.AllProp, PropName: req.PropName, Prop: req.Prop}
+}
+
+func (s *Server) calendarQuery(ctx context.Context, owner string, report reportRequest) ([]davResponse, error) {
+	req := report.props()
+	from, to, ok, err := queryRange(report.Filter)
+	if err != nil || !ok {
+		return nil, err
+	}
+	events, err := s.app.GetOwnerEvents(ctx, owner, from, to)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.caldavNames(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]davResponse, 0, len(events))
+	for _, e := range events {
+		responses = append(responses, req.response(names.href(e), eventProps(e, req.withData())))
+	}
+	return responses, nil
+}
+
+// queryRange returns the range of the events matched by the filter, ok is false when the filter
+// matches components other than events only.
+func queryRange(f *compFilter) (from, to time.Time, ok bool, err error) {
+	if f == nil || len(f.Comps) == 0 {
+		return from, to, true, nil
+	}
+	if f.Name != "VCALENDAR" {
+		return from, to, false, nil
+	}
+	for _, c := range f.Comps {
+		if c.Name != "VEVENT" {
+			continue
+		}
+		if c.TimeRange == nil {
+			return from, to, true, nil
+		}
+		if c.TimeRange.Start != "" {
+			if from, err = time.Parse(davTimeLayout, c.TimeRange.Start); err != nil {
+				return from, to, false, fmt.Errorf("%w: time range start %q", ErrInvalidDAVRequest, c.TimeRange.Start)
+			}
+		}
+		if c.TimeRange.End != "" {
+			if to, err = time.Parse(davTimeLayout, c.TimeRange.End); err != nil {
+				return from, to, false, fmt.Errorf("%w: time range end %q", ErrInvalidDAVRequest, c.TimeRange.End)
+			}
+		}
+		return from, to, true, nil
+	}
+	return from, to, false, nil
+}
+
+func (s *Server) calendarMultiget(ctx context.Context, owner string, report reportRequest) ([]davResponse, error) {
+	req := report.props()
+	names, err := s.caldavNames(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]davResponse, 0, len(report.Hrefs))
+	for _, href := range report.Hrefs {
+		var p caldavPath
+		u, err := url.Parse(strings.TrimSpace(href))
+		ok := err == nil
+		if ok {
+			p, ok = parseCaldavPath(u.Path)
+		}
+		if !ok || p.owner != owner || p.name == "" {
+			responses = append(responses, davResponse{Href: href, Status: statusNotFound})
+			continue
+		}
+		e, err := s.ownedEvent(ctx, p, names)
+		if errors.Is(err, storage.ErrNotFoundEvent) {
+			responses = append(responses, davResponse{Href: href, Status: statusNotFound})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, req.response(href, eventProps(e, req.withData())))
+	}
+	return responses, nil
+}
+
+// actorOf returns the actor of the request, known is false for anonymous requests.
+func actorOf(ctx context.Context) (actor string, known bool) {
+	actor = storage.ActorFromContext(ctx)
+	return actor, actor != storage.AnonymousActor
+}
+
+// principalProp points to the collection of the actor, which is also the principal.
+func principalProp(ctx context.Context) davProp {
+	value := `<unauthenticated xmlns="DAV:"/>`
+	if actor, ok := actorOf(ctx); ok {
+		value = hrefValue(collectionHref(actor))
+	}
+	return davProp{XMLName: xml.Name{Space: davNS, Local: "current-user-principal"}, Value: value}
+}
+
+func rootProps(ctx context.Context) []davProp {
+	return []davProp{
+		{XMLName: xml.Name{Space: davNS, Local: "resourcetype"}, Value: `<collection xmlns="DAV:"/>`},
+		principalProp(ctx),
+	}
+}
+
+func collectionProps(ctx context.Context, owner string, events []storage.Event) []davProp {
+	ctag := collectionTag(events)
+	reports := ""
+	for _, name := range []xml.Name{calendarQuery, calendarMultiget} {
+		reports += fmt.Sprintf(`<supported-report xmlns="DAV:"><report><%s xmlns="%s"/></report></supported-report>`,
+			name.Local, name.Space)
+	}
+	return []davProp{
+		{
+			XMLName: xml.Name{Space: davNS, Local: "resourcetype"},
+			Value:   `<collection xmlns="DAV:"/><calendar xmlns="` + caldavNS + `"/>`,
+		},
+		{XMLName: xml.Name{Space: davNS, Local: "displayname"}, Value: xmlText(owner)},
+		{XMLName: xml.Name{Space: calendarServerNS, Local: "getctag"}, Value: ctag},
+		{XMLName: xml.Name{Space: davNS, Local: "getetag"}, Value: xmlText(strconv.Quote(ctag))},
+		principalProp(ctx),
+		{XMLName: xml.Name{Space: davNS, Local: "principal-URL"}, Value: hrefValue(collectionHref(owner))},
+		{XMLName: xml.Name{Space: caldavNS, Local: "calendar-home-set"}, Value: hrefValue(collectionHref(owner))},
+		{
+			XMLName: xml.Name{Space: caldavNS, Local: "supported-calendar-component-set"},
+			Value:   `<comp xmlns="` + caldavNS + `" name="VEVENT"/>`,
+		},
+		{XMLName: xml.Name{Space: davNS, Local: "supported-report-set"}, Value: reports},
+	}
+}
+
+func eventProps(e storage.Event, withData bool) []davProp {
+	props := []davProp{
+		{XMLName: xml.Name{Space: davNS, Local: "resourcetype"}},
+		{XMLName: xml.Name{Space: davNS, Local: "getetag"}, Value: xmlText(etag(e.Version))},
+		{XMLName: xml.Name{Space: davNS, Local: "getcontenttype"}, Value: xmlText(ical.ContentType)},
+		{XMLName: xml.Name{Space: davNS, Local: "getlastmodified"}, Value: e.UpdatedAt.UTC().Format(http.TimeFormat)},
+	}
+	if withData {
+		props = append(props, davProp{XMLName: calendarDataProp, Value: xmlText(string(ical.Encode(e, e.ID)))})
+	}
+	return props
+}
+
+// collectionTag changes whenever an event of the collection is added, changed or removed.
+func collectionTag(events []storage.Event) string {
+	versions := make([]string, 0, len(events))
+	for _, e := range events {
+		versions = append(versions, e.ID+":"+strconv.FormatInt(e.Version, 10))
+	}
+	sort.Strings(versions)
+	sum := sha256.Sum256([]byte(strings.Join(versions, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func hrefValue(href string) string {
+	return `<href xmlns="DAV:">` + xmlText(href) + `</href>`
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeMultistatus(w http.ResponseWriter, r *http.Request, responses []davResponse) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(davMultistatus{Responses: responses}); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to write multistatus: %v", err)
+	}
+}
+
+func caldavErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFoundEvent):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrDuplicateEventID):
+		return http.StatusConflict
+	case errors.Is(err, ical.ErrInvalidObject), errors.Is(err, storage.ErrIncorrectEventTime),
+		errors.Is(err, ErrInvalidDAVRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnsupportedReport):
+		return http.StatusForbidden
+	default:
+		return errorStatus(err)
+	}
+}
+
+func returnCaldavErr(w http.ResponseWriter, r *http.Request, err error) {
+	status := caldavErrorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Errorf("%s %v failed: %v", r.Method, r.URL, err)
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
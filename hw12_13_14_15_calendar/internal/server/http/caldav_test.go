@@ -0,0 +1,265 @@
+package internalhttp
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/caldav"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ical"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testPassword is the CalDAV password of alice.
+const testPassword = "s3cret"
+
+func newCaldavTest(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+	config := CaldavConfig{Passwords: []CaldavPassword{{User: "alice", Bcrypt: string(hash)}}}
+	require.NoError(t, config.Validate())
+	s := &Server{app: mockApp(), caldavPasswords: config.passwords()}
+	srv := httptest.NewServer(actorMiddleware(http.HandlerFunc(s.CalDAV)))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func caldavEvent(title, owner string, start time.Time) storage.Event {
+	return storage.Event{Title: title, OwnerID: owner, StartTime: start, EndTime: start.Add(time.Hour)}
+}
+
+func TestServer_CalDAV(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newCaldavTest(t)
+	start := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	own, err := s.app.CreateEvent(ctx, caldavEvent("review", "alice", start))
+	require.NoError(t, err)
+	other, err := s.app.CreateEvent(ctx, caldavEvent("private", "bob", start))
+	require.NoError(t, err)
+
+	client, err := caldav.NewClient(http.DefaultClient, srv.URL+"/caldav/alice/", "alice", testPassword)
+	require.NoError(t, err)
+	ctag, err := client.CTag(ctx)
+	require.NoError(t, err)
+	resources, err := client.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []caldav.Resource{{Href: client.Href(own.ID), ETag: `"1"`}}, resources)
+
+	data, tag, err := client.Get(ctx, client.Href(own.ID))
+	require.NoError(t, err)
+	require.Equal(t, `"1"`, tag)
+	decoded, uid, err := ical.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, own.ID, uid)
+	require.Equal(t, "review", decoded.Title)
+	_, _, err = client.Get(ctx, client.Href(other.ID))
+	require.ErrorIs(t, err, caldav.ErrNotFound, "events of other owners are not in the collection")
+
+	created := caldavEvent("standup", "", start.Add(time.Hour))
+	tag, err = client.Put(ctx, client.Href("new-1"), ical.Encode(created, "client-uid"), "")
+	require.NoError(t, err)
+	require.Equal(t, `"1"`, tag)
+	names, err := s.app.GetCaldavNames(ctx, "alice")
+	require.NoError(t, err)
+	stored, err := s.app.GetEvent(ctx, names["new-1"])
+	require.NoError(t, err)
+	require.Equal(t, "alice", stored.OwnerID)
+	require.Equal(t, "standup", stored.Title)
+
+	_, err = client.Put(ctx, client.Href("new-1"), ical.Encode(created, "new-1"), "")
+	require.ErrorIs(t, err, caldav.ErrPreconditionFailed, "the resource exists")
+	created.Title = "standup moved"
+	tag, err = client.Put(ctx, client.Href("new-1"), ical.Encode(created, "new-1"), `"1"`)
+	require.NoError(t, err)
+	require.Equal(t, `"2"`, tag)
+	_, err = client.Put(ctx, client.Href("new-1"), ical.Encode(created, "new-1"), `"1"`)
+	require.ErrorIs(t, err, caldav.ErrPreconditionFailed, "the version is stale")
+
+	_, err = client.Put(ctx, client.Href(other.ID), ical.Encode(created, other.ID), "")
+	require.NoError(t, err, "the name of another owner's event is a new resource")
+	require.NoError(t, client.Delete(ctx, client.Href(other.ID), `"1"`))
+	kept, err := s.app.GetEvent(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, "private", kept.Title, "the event of another owner is kept")
+
+	require.ErrorIs(t, client.Delete(ctx, client.Href(own.ID), `"7"`), caldav.ErrPreconditionFailed)
+	require.NoError(t, client.Delete(ctx, client.Href(own.ID), `"1"`))
+	resources, err = client.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []caldav.Resource{{Href: client.Href("new-1"), ETag: `"2"`}}, resources)
+
+	changed, err := client.CTag(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, ctag, changed)
+}
+
+type testMultistatus struct {
+	Responses []struct {
+		Href   string `xml:"DAV: href"`
+		Status string `xml:"DAV: status"`
+		Found  struct {
+			Principal string `xml:"DAV: current-user-principal>href"`
+			ETag      string `xml:"DAV: getetag"`
+			Data      string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+		} `xml:"DAV: propstat>prop"`
+	} `xml:"DAV: response"`
+}
+
+func caldavRequest(
+	t *testing.T, srv *httptest.Server, method, path, depth, body string,
+) (*http.Response, testMultistatus) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, srv.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.SetBasicAuth("alice", testPassword)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var ms testMultistatus
+	if resp.StatusCode == http.StatusMultiStatus {
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&ms))
+	}
+	return resp, ms
+}
+
+func TestServer_CalDAVReports(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newCaldavTest(t)
+	start := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Hour)
+	first, err := s.app.CreateEvent(ctx, caldavEvent("first", "alice", start))
+	require.NoError(t, err)
+	second, err := s.app.CreateEvent(ctx, caldavEvent("second", "alice", start.Add(48*time.Hour)))
+	require.NoError(t, err)
+
+	resp, ms := caldavRequest(t, srv, "PROPFIND", "/caldav/", "0",
+		`<propfind xmlns="DAV:"><prop><current-user-principal/></prop></propfind>`)
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	require.Len(t, ms.Responses, 1)
+	require.Equal(t, "/caldav/alice/", ms.Responses[0].Found.Principal)
+
+	query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/><C:calendar-data/></D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+<C:time-range start="` + start.Format(davTimeLayout) + `" end="` + start.Add(24*time.Hour).Format(davTimeLayout) + `"/>
+</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+	resp, ms = caldavRequest(t, srv, "REPORT", "/caldav/alice/", "1", query)
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	require.Len(t, ms.Responses, 1)
+	require.Equal(t, "/caldav/alice/"+first.ID+".ics", ms.Responses[0].Href)
+	require.Equal(t, `"1"`, ms.Responses[0].Found.ETag)
+	decoded, _, err := ical.Decode([]byte(ms.Responses[0].Found.Data))
+	require.NoError(t, err)
+	require.Equal(t, "first", decoded.Title)
+
+	todos := strings.Replace(query, `name="VEVENT"`, `name="VTODO"`, 1)
+	_, ms = caldavRequest(t, srv, "REPORT", "/caldav/alice/", "1", todos)
+	require.Empty(t, ms.Responses, "there are no to-dos")
+
+	multiget := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><D:getetag/></D:prop><D:href>/caldav/alice/` + second.ID + `.ics</D:href>
+<D:href>/caldav/alice/missing.ics</D:href>
+</C:calendar-multiget>`
+	resp, ms = caldavRequest(t, srv, "REPORT", "/caldav/alice/", "1", multiget)
+	require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	require.Len(t, ms.Responses, 2)
+	require.Equal(t, `"1"`, ms.Responses[0].Found.ETag)
+	require.Contains(t, ms.Responses[1].Status, "404")
+
+	resp, _ = caldavRequest(t, srv, "REPORT", "/caldav/alice/", "1", `<sync-collection xmlns="DAV:"/>`)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = caldavRequest(t, srv, http.MethodGet, "/caldav/alice/", "", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = caldavRequest(t, srv, http.MethodPut, "/caldav/alice/bad.ics", "", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_CalDAVAuthentication(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newCaldavTest(t)
+	e, err := s.app.CreateEvent(ctx, caldavEvent("private", "bob", time.Now().Add(24*time.Hour)))
+	require.NoError(t, err)
+	href := "/caldav/bob/" + e.ID + ".ics"
+
+	tests := []struct {
+		name           string
+		user, password string
+		actor          string
+		method, path   string
+		expectedCode   int
+	}{
+		{name: "anonymous", method: http.MethodGet, path: href, expectedCode: http.StatusUnauthorized},
+		{
+			name: "wrong password", user: "alice", password: "guess",
+			method: http.MethodGet, path: "/caldav/alice/", expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown user", user: "bob", password: testPassword,
+			method: http.MethodGet, path: href, expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "calendar of another owner", user: "alice", password: testPassword,
+			method: http.MethodGet, path: href, expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "event of another owner removed", user: "alice", password: testPassword,
+			method: http.MethodDelete, path: href, expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "unverified actor header", actor: "bob",
+			method: http.MethodGet, path: href, expectedCode: http.StatusUnauthorized,
+		},
+		{name: "options", method: http.MethodOptions, path: href, expectedCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, tt.method, srv.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			if tt.actor != "" {
+				req.Header.Set(actorHeader, tt.actor)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedCode == http.StatusUnauthorized {
+				require.Contains(t, resp.Header.Get("WWW-Authenticate"), "Basic")
+			}
+		})
+	}
+	_, err = s.app.GetEvent(ctx, e.ID)
+	require.NoError(t, err, "the event of another owner is kept")
+
+	// Without passwords the users are identified like in the rest of the API.
+	s.caldavPasswords = nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+href, nil)
+	require.NoError(t, err)
+	req.Header.Set(actorHeader, "bob")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCaldavConfigValidate(t *testing.T) {
+	config := CaldavConfig{Passwords: []CaldavPassword{
+		{User: "alice", Bcrypt: "$2a$10$uf5/8HtUp204yBjW3ZfNMO2fl/CK6iB2nwdUBGuHbTT1WI7BEVq.K"},
+		{User: "bob", Bcrypt: "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+	}}
+	err := config.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "passwords[1].bcrypt")
+	require.NotContains(t, err.Error(), "passwords[0]")
+}
@@ -4,20 +4,94 @@ import (
 	"net/http"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 )
 
+// statusRecorder remembers the status code written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		entry := logger.FromContext(r.Context())
 		ip, err := getIP(r)
 		if err != nil {
-			log.Errorf("failed to get client IP: %v", err)
+			entry.Errorf("failed to get client IP: %v", err)
 		}
-		log.WithField("ip", ip).WithField("method", r.Method).WithField("path", r.URL).
+		entry.WithField("ip", ip).WithField("method", r.Method).WithField("path", r.URL).
 			WithField("HTTP version", r.Proto).WithField("user-agent", r.Header.Get("user-agent")).
-			WithField("latency", time.Since(start)).
+			WithField("status", recorder.status).WithField("latency", time.Since(start)).
 			Info("http request processed")
 	})
 }
+
+// requestIDMiddleware takes the request ID from the header or generates a new one,
+// passes it through the context and returns it in the response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+const (
+	// actorHeader identifies the user on whose behalf the request is made.
+	actorHeader = "X-User-ID"
+	// requestIDHeader correlates logs of the request across services.
+	requestIDHeader = "X-Request-ID"
+	// idempotencyKeyHeader makes a repeated creation request return the original result.
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+func actorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := r.Header.Get(actorHeader); actor != "" {
+			r = r.WithContext(storage.WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rateLimitMiddleware(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The API key and user headers are not verified, a client could get a new bucket
+		// with every value, so the bucket is taken by the client address.
+		ip, err := getIP(r)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if ok, wait := limiter.Allow(ip); !ok {
+			w.Header().Set("Retry-After", ratelimit.RetryAfter(wait))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(http.StatusText(http.StatusTooManyRequests)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -9,28 +9,60 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/quickadd"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/tlsconfig"
 )
 
+var ErrInvalidIfMatch = errors.New("invalid If-Match header")
+
 type Config struct {
-	Host string
-	Port int
+	Host   string
+	Port   int
+	TLS    tlsconfig.ServerConfig
+	Caldav CaldavConfig
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Required("host", c.Host)
+	v.Port("port", c.Port)
+	v.Check("tls", c.TLS.Validate())
+	v.Check("caldav", c.Caldav.Validate())
+	return v.Err()
 }
 
 type Server struct {
-	srv  *http.Server
-	addr string
-	app  *app.App
+	srv       *http.Server
+	addr      string
+	app       *app.App
+	limiter   *ratelimit.Limiter
+	tls       tlsconfig.ServerConfig
+	closing   chan struct{}
+	closeOnce sync.Once
+	// caldavPasswords are the bcrypt hashes of the CalDAV passwords by the user names.
+	caldavPasswords map[string][]byte
 }
 
-func NewServer(config Config, app *app.App) *Server {
+// NewServer creates the server, a nil limiter disables rate limiting.
+func NewServer(config Config, app *app.App, limiter *ratelimit.Limiter) *Server {
 	return &Server{
-		addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
-		srv:  &http.Server{Addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port))}, //nolint
-		app:  app,
+		addr:    net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		srv:     &http.Server{Addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port))}, //nolint
+		app:     app,
+		limiter: limiter,
+		tls:     config.TLS,
+		closing: make(chan struct{}),
+
+		caldavPasswords: config.Caldav.passwords(),
 	}
 }
 
@@ -42,13 +74,43 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/add", s.AddEvent)
 	mux.HandleFunc("/update", s.UpdateEvent)
 	mux.HandleFunc("/remove", s.RemoveEvent)
+	mux.HandleFunc("/get", s.GetEvent)
+	mux.HandleFunc("/restore", s.RestoreEvent)
+	mux.HandleFunc("/trash", s.ListTrash)
+	mux.HandleFunc("/batch/add", s.BatchCreate)
+	mux.HandleFunc("/batch/update", s.BatchUpdate)
+	mux.HandleFunc("/batch/remove", s.BatchDelete)
 	mux.HandleFunc("/events/day", s.GetEventsForDay)
 	mux.HandleFunc("/events/week", s.GetEventsForWeek)
 	mux.HandleFunc("/events/month", s.GetEventsForMonth)
+	mux.HandleFunc("/tags/stats", s.GetTagStats)
+	mux.HandleFunc("/events/search", s.SearchEvents)
+	mux.HandleFunc("/events/quick", s.QuickAddEvent)
+	mux.HandleFunc("/events/watch", s.WatchEvents)
+	mux.HandleFunc("/events/history", s.GetEventHistory)
+	mux.HandleFunc("/events/activity", s.GetOwnerActivity)
+	mux.HandleFunc("/attachments/upload", s.UploadAttachment)
+	mux.HandleFunc("/attachments/download", s.DownloadAttachment)
+	mux.HandleFunc("/attachments/remove", s.RemoveAttachment)
+	mux.HandleFunc("/webhooks/add", s.AddWebhook)
+	mux.HandleFunc("/webhooks/list", s.ListWebhooks)
+	mux.HandleFunc("/webhooks/remove", s.RemoveWebhook)
+	mux.HandleFunc("/webhooks/enable", s.EnableWebhook)
+	mux.HandleFunc("/webhooks/deliveries", s.GetWebhookDeliveries)
+	mux.HandleFunc("/caldav/", s.CalDAV)
+	mux.HandleFunc("/.well-known/caldav", s.WellKnownCalDAV)
 
-	s.srv.Handler = loggingMiddleware(mux)
+	s.srv.Handler = requestIDMiddleware(loggingMiddleware(rateLimitMiddleware(s.limiter, actorMiddleware(mux))))
 
-	err := s.srv.ListenAndServe()
+	var err error
+	if s.tls.Enabled {
+		if s.srv.TLSConfig, err = s.tls.Load(); err != nil {
+			return fmt.Errorf("failed to load tls config: %w", err)
+		}
+		err = s.srv.ListenAndServeTLS("", "")
+	} else {
+		err = s.srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("http server failed: %w", err)
 	}
@@ -57,6 +119,7 @@ func (s *Server) Start(ctx context.Context) error {
 }
 
 func (s *Server) Stop(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
 	return s.srv.Shutdown(ctx)
 }
 
@@ -77,16 +140,17 @@ func (s *Server) AddEvent(w http.ResponseWriter, r *http.Request) {
 
 	err := parseRequestBody(r, &event)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
-	id, err := s.app.CreateEvent(context.Background(), event)
+	event, err = s.app.CreateEventIdempotent(r.Context(), r.Header.Get(idempotencyKeyHeader), event)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", etag(event.Version))
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(id))
+	w.Write([]byte(event.ID))
 }
 
 type UpdateReq struct {
@@ -94,38 +158,268 @@ type UpdateReq struct {
 	Event storage.Event `json:"event"`
 }
 
+// UpdateEvent replaces the event, PATCH requests are handled as a JSON merge patch.
 func (s *Server) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		s.PatchEvent(w, r)
+		return
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
 	updateEvent := UpdateReq{}
-	err := parseRequestBody(r, &updateEvent)
+	err = parseRequestBody(r, &updateEvent)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
-	err = s.app.UpdateEvent(context.Background(), updateEvent.ID, updateEvent.Event)
+	version, err = s.app.UpdateEvent(r.Context(), updateEvent.ID, updateEvent.Event, version)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", etag(version))
 	w.WriteHeader(http.StatusOK)
 }
 
+// PatchEvent applies a JSON merge patch from the body to the event with the id from the query.
+func (s *Server) PatchEvent(w http.ResponseWriter, r *http.Request) {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	patch := storage.EventPatch{}
+	err = parseRequestBody(r, &patch)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	event, err := s.app.PatchEvent(r.Context(), r.URL.Query().Get("id"), patch, version)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(event.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(event)
+}
+
 func (s *Server) RemoveEvent(w http.ResponseWriter, r *http.Request) {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
 	event := storage.Event{}
-	err := parseRequestBody(r, &event)
+	err = parseRequestBody(r, &event)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	err = s.app.RemoveEvent(r.Context(), event.ID, version)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) GetEvent(w http.ResponseWriter, r *http.Request) {
+	req := storage.Event{}
+	err := parseRequestBody(r, &req)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
-	err = s.app.RemoveEvent(context.Background(), event.ID)
+	event, err := s.app.GetEvent(r.Context(), req.ID)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(event.Version))
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(event)
+}
+
+func (s *Server) RestoreEvent(w http.ResponseWriter, r *http.Request) {
+	req := storage.Event{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	event, err := s.app.RestoreEvent(r.Context(), req.ID)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(event.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(event)
+}
+
+type TrashReq struct {
+	OwnerID string `json:"ownerId"`
+}
+
+func (s *Server) ListTrash(w http.ResponseWriter, r *http.Request) {
+	req := TrashReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	events, err := s.app.ListTrash(r.Context(), req.OwnerID)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
+}
+
+type BatchUpdateReq struct {
+	ID      string        `json:"id"`
+	Event   storage.Event `json:"event"`
+	Version int64         `json:"version"`
+}
+
+type BatchRemoveReq struct {
+	ID      string `json:"id"`
+	Version int64  `json:"version"`
+}
+
+type BatchItemResult struct {
+	ID      string `json:"id"`
+	Version int64  `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s *Server) BatchCreate(w http.ResponseWriter, r *http.Request) {
+	var events []storage.Event
+	err := parseRequestBody(r, &events)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	results, err := s.app.BatchCreate(r.Context(), events)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	returnBatchResults(w, results)
+}
+
+func (s *Server) BatchUpdate(w http.ResponseWriter, r *http.Request) {
+	var req []BatchUpdateReq
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	items := make([]storage.BatchUpdateItem, 0, len(req))
+	for _, item := range req {
+		items = append(items, storage.BatchUpdateItem{ID: item.ID, Event: item.Event, Version: item.Version})
+	}
+	results, err := s.app.BatchUpdate(r.Context(), items)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	returnBatchResults(w, results)
+}
+
+func (s *Server) BatchDelete(w http.ResponseWriter, r *http.Request) {
+	var req []BatchRemoveReq
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	items := make([]storage.BatchRemoveItem, 0, len(req))
+	for _, item := range req {
+		items = append(items, storage.BatchRemoveItem{ID: item.ID, Version: item.Version})
+	}
+	results, err := s.app.BatchDelete(r.Context(), items)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	returnBatchResults(w, results)
+}
+
+func returnBatchResults(w http.ResponseWriter, results []storage.BatchResult) {
+	resp := make([]BatchItemResult, 0, len(results))
+	for _, res := range results {
+		item := BatchItemResult{ID: res.ID, Version: res.Version}
+		if res.Err != nil {
+			item.Error = res.Err.Error()
+		}
+		resp = append(resp, item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type ActivityReq struct {
+	OwnerID string    `json:"ownerId"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Limit   int       `json:"limit"`
+}
+
+// defaultActivityLimit is used when the activity request has no limit.
+const defaultActivityLimit = 100
+
+func (s *Server) GetEventHistory(w http.ResponseWriter, r *http.Request) {
+	req := storage.Event{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	records, err := s.app.GetEventHistory(r.Context(), req.ID)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
+
+func (s *Server) GetOwnerActivity(w http.ResponseWriter, r *http.Request) {
+	req := ActivityReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultActivityLimit
+	}
+	records, err := s.app.GetOwnerActivity(r.Context(), req.OwnerID, req.From, req.To, req.Limit)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
 }
 
 type ReqDate struct {
 	Date time.Time `json:"date"`
+	// Tags selects events having all of them.
+	Tags []string `json:"tags"`
 }
 
 const (
@@ -138,27 +432,27 @@ func (s *Server) GetEvents(w http.ResponseWriter, r *http.Request, period string
 	date := ReqDate{}
 	err := parseRequestBody(r, &date)
 	if err != nil {
-		returnErr(w, err)
+		returnErr(w, r, err)
 		return
 	}
 	var event []storage.Event
 	switch period {
 	case day:
-		event, err = s.app.GetEventsForDay(context.Background(), date.Date)
+		event, err = s.app.GetEventsForDay(r.Context(), date.Date, storage.EventFilter{Tags: date.Tags})
 		if err != nil {
-			returnErr(w, err)
+			returnErr(w, r, err)
 			return
 		}
 	case week:
-		event, err = s.app.GetEventsForWeek(context.Background(), date.Date)
+		event, err = s.app.GetEventsForWeek(r.Context(), date.Date, storage.EventFilter{Tags: date.Tags})
 		if err != nil {
-			returnErr(w, err)
+			returnErr(w, r, err)
 			return
 		}
 	case month:
-		event, err = s.app.GetEventsForMonth(context.Background(), date.Date)
+		event, err = s.app.GetEventsForMonth(r.Context(), date.Date, storage.EventFilter{Tags: date.Tags})
 		if err != nil {
-			returnErr(w, err)
+			returnErr(w, r, err)
 			return
 		}
 	default:
@@ -182,6 +476,84 @@ func (s *Server) GetEventsForMonth(w http.ResponseWriter, r *http.Request) {
 	s.GetEvents(w, r, month)
 }
 
+type TagStatsReq struct {
+	OwnerID string `json:"ownerId"`
+}
+
+func (s *Server) GetTagStats(w http.ResponseWriter, r *http.Request) {
+	req := TagStatsReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	stats, err := s.app.GetTagStats(r.Context(), req.OwnerID)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+type SearchReq struct {
+	// Query is the text of storage.ParseSearchQuery.
+	Query   string `json:"query"`
+	OwnerID string `json:"ownerId"`
+	Limit   int    `json:"limit"`
+}
+
+// defaultSearchLimit is used when the search request has no limit.
+const defaultSearchLimit = 50
+
+func (s *Server) SearchEvents(w http.ResponseWriter, r *http.Request) {
+	req := SearchReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchLimit
+	}
+	results, err := s.app.SearchEvents(r.Context(), req.Query, req.OwnerID, req.Limit)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+type QuickAddReq struct {
+	// Text describes the event, see quickadd.Parse.
+	Text    string `json:"text"`
+	OwnerID string `json:"ownerId"`
+	// TimeZone is the IANA name of the zone the text is written in, empty means UTC.
+	TimeZone string `json:"timeZone"`
+}
+
+// QuickAddEvent creates the event described by the text and returns it.
+func (s *Server) QuickAddEvent(w http.ResponseWriter, r *http.Request) {
+	req := QuickAddReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	event, err := s.app.QuickAddEvent(r.Context(), req.Text, req.OwnerID, req.TimeZone)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(event.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(event)
+}
+
 func parseRequestBody(r *http.Request, v interface{}) error {
 	res, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -196,7 +568,61 @@ func parseRequestBody(r *http.Request, v interface{}) error {
 	return nil
 }
 
-func returnErr(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
+// etag formats an event version as a strong entity tag.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the version expected by the client, zero when any version is acceptable.
+func parseIfMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidIfMatch, value)
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidIfMatch, value)
+	}
+	return version, nil
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrInvalidIfMatch), errors.Is(err, storage.ErrInvalidPatch),
+		errors.Is(err, ErrInvalidResumeToken), errors.Is(err, storage.ErrInvalidEvent),
+		errors.Is(err, app.ErrInvalidAttachment), errors.Is(err, storage.ErrInvalidSearchQuery),
+		errors.Is(err, quickadd.ErrInvalidText), errors.Is(err, storage.ErrInvalidWebhook),
+		errors.Is(err, storage.ErrIncorrectEventTime):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNotFoundEvent), errors.Is(err, storage.ErrNotFoundAttachment),
+		errors.Is(err, storage.ErrNotFoundWebhook):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrTokenExpired):
+		return http.StatusGone
+	case errors.Is(err, app.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, app.ErrAttachmentsDisabled):
+		return http.StatusNotImplemented
+	case errors.Is(err, storage.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrIdempotencyKeyInProgress):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func returnErr(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Errorf("%s %v failed: %v", r.Method, r.URL, err)
+	}
+	w.WriteHeader(status)
 	w.Write([]byte(err.Error()))
 }
@@ -1,13 +1,21 @@
 package internalhttp
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	memoryblob "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/blob/memory"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
 	"github.com/stretchr/testify/require"
 )
@@ -184,6 +192,7 @@ func TestServer_RemoveEvent(t *testing.T) {
 			}
 			resp := httptest.NewRecorder()
 			s.RemoveEvent(resp, tt.args.r)
+			require.Equal(t, http.StatusNotFound, resp.Code)
 			require.Equal(t, tt.expectedMessage, resp.Body.String())
 		})
 	}
@@ -225,3 +234,547 @@ func TestServer_GetEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_VersionConflict(t *testing.T) {
+	s := &Server{app: mockApp()}
+	event := []byte(`{
+    "id":"123",
+    "title":"dadadasfasfaf",
+    "startTime": "2099-01-02T15:04:05Z",
+    "endTime": "2099-01-03T15:04:05Z",
+    "ownerId":"Москва"
+}`)
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader(event)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, `"1"`, resp.Header().Get("ETag"))
+
+	update := []byte(`{"id":"123","event":` + string(event) + `}`)
+	req := httptest.NewRequest(http.MethodPost, "/update", bytes.NewReader(update))
+	req.Header.Set("If-Match", `"1"`)
+	resp = httptest.NewRecorder()
+	s.UpdateEvent(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, `"2"`, resp.Header().Get("ETag"))
+
+	req = httptest.NewRequest(http.MethodPost, "/update", bytes.NewReader(update))
+	req.Header.Set("If-Match", `"1"`)
+	resp = httptest.NewRecorder()
+	s.UpdateEvent(resp, req)
+	require.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/remove", bytes.NewReader([]byte(`{"id":"123"}`)))
+	req.Header.Set("If-Match", `"1"`)
+	resp = httptest.NewRecorder()
+	s.RemoveEvent(resp, req)
+	require.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/remove", bytes.NewReader([]byte(`{"id":"123"}`)))
+	req.Header.Set("If-Match", "2")
+	resp = httptest.NewRecorder()
+	s.RemoveEvent(resp, req)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/remove", bytes.NewReader([]byte(`{"id":"123"}`)))
+	req.Header.Set("If-Match", `"2"`)
+	resp = httptest.NewRecorder()
+	s.RemoveEvent(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestServer_PatchEvent(t *testing.T) {
+	s := &Server{app: mockApp()}
+	event := []byte(`{
+    "id":"123",
+    "title":"title",
+    "startTime": "2099-01-02T15:04:05Z",
+    "endTime": "2099-01-03T15:04:05Z",
+    "description":"description",
+    "ownerId":"owner"
+}`)
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader(event)))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "change title", body: `{"title":"new title","description":null}`, expectedCode: http.StatusOK},
+		{name: "read only field", body: `{"id":"321"}`, expectedCode: http.StatusBadRequest},
+		{name: "invalid merged event", body: `{"endTime":"2099-01-01T15:04:05Z"}`, expectedCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/update?id=123", bytes.NewReader([]byte(tt.body)))
+			resp := httptest.NewRecorder()
+			s.UpdateEvent(resp, req)
+			require.Equal(t, tt.expectedCode, resp.Code, resp.Body.String())
+		})
+	}
+
+	resp = httptest.NewRecorder()
+	s.GetEventsForDay(resp, httptest.NewRequest(http.MethodPost, "/events/day",
+		bytes.NewReader([]byte(`{"date":"2099-01-02T00:00:00Z"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var events []storage.Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &events))
+	require.Equal(t, 1, len(events))
+	require.Equal(t, "new title", events[0].Title)
+	require.Equal(t, "", events[0].Description)
+	require.Equal(t, "owner", events[0].OwnerID)
+	require.Equal(t, int64(2), events[0].Version)
+}
+
+func TestServer_Batch(t *testing.T) {
+	s := &Server{app: mockApp()}
+	events := []byte(`[
+    {"id":"1","title":"first","startTime":"2099-01-02T15:04:05Z","endTime":"2099-01-03T15:04:05Z"},
+    {"id":"1","title":"duplicate","startTime":"2099-01-02T15:04:05Z","endTime":"2099-01-03T15:04:05Z"},
+    {"id":"2","title":"second","startTime":"2099-01-02T15:04:05Z","endTime":"2099-01-03T15:04:05Z"}
+]`)
+	resp := httptest.NewRecorder()
+	s.BatchCreate(resp, httptest.NewRequest(http.MethodPost, "/batch/add", bytes.NewReader(events)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var results []BatchItemResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	require.Equal(t, []BatchItemResult{
+		{ID: "1", Version: 1},
+		{ID: "1", Error: `duplicate ID "1": event with same ID exists`},
+		{ID: "2", Version: 1},
+	}, results)
+
+	resp = httptest.NewRecorder()
+	s.BatchDelete(resp, httptest.NewRequest(http.MethodPost, "/batch/remove",
+		bytes.NewReader([]byte(`[{"id":"1","version":1},{"id":"3"}]`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	results = nil
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	require.Equal(t, []BatchItemResult{
+		{ID: "1"},
+		{ID: "3", Error: `failed to remove event with id "3": event not found`},
+	}, results)
+
+	resp = httptest.NewRecorder()
+	s.GetEvent(resp, httptest.NewRequest(http.MethodPost, "/get", bytes.NewReader([]byte(`{"id":"2"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, `"1"`, resp.Header().Get("ETag"))
+	var event storage.Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &event))
+	require.Equal(t, "second", event.Title)
+}
+
+func TestServer_WatchEvents(t *testing.T) {
+	s := &Server{app: mockApp(), closing: make(chan struct{})}
+	srv := httptest.NewServer(http.HandlerFunc(s.WatchEvents))
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+"?ownerId=owner", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	_, err = s.app.CreateEvent(context.Background(), storage.Event{
+		ID:        "123",
+		StartTime: time.Date(2099, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2099, 1, 3, 0, 0, 0, 0, time.UTC),
+		OwnerID:   "owner",
+	})
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "id: 1\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: created\n", line)
+
+	close(s.closing)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+}
+
+func TestServer_WatchEventsExpiredToken(t *testing.T) {
+	s := &Server{app: mockApp(), closing: make(chan struct{})}
+	ctx := context.Background()
+	for _, id := range []string{"1", "2"} {
+		_, err := s.app.CreateEvent(ctx, storage.Event{
+			ID:        id,
+			StartTime: time.Date(2099, 1, 2, 0, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2099, 1, 3, 0, 0, 0, 0, time.UTC),
+			OwnerID:   "owner",
+		})
+		require.NoError(t, err)
+	}
+	_, err := s.app.Storage.PurgeChanges(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	s.WatchEvents(resp, httptest.NewRequest(http.MethodGet, "/events/watch?resumeToken=1", nil))
+	require.Equal(t, http.StatusGone, resp.Code)
+}
+
+func TestServer_Audit(t *testing.T) {
+	s := &Server{app: mockApp()}
+	handler := actorMiddleware(http.HandlerFunc(s.UpdateEvent))
+	event := `{"id":"123","title":"title","startTime":"2099-01-02T15:04:05Z",` +
+		`"endTime":"2099-01-03T15:04:05Z","ownerId":"owner"}`
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(event))))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	req := httptest.NewRequest(http.MethodPatch, "/update?id=123", bytes.NewReader([]byte(`{"title":"moved"}`)))
+	req.Header.Set("X-User-ID", "alice")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.GetEventHistory(resp, httptest.NewRequest(http.MethodPost, "/events/history",
+		bytes.NewReader([]byte(`{"id":"123"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var records []storage.AuditRecord
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &records))
+	require.Equal(t, 2, len(records))
+	require.Equal(t, storage.AuditCreated, records[0].Action)
+	require.Equal(t, storage.AnonymousActor, records[0].Actor)
+	require.Equal(t, storage.AuditUpdated, records[1].Action)
+	require.Equal(t, "alice", records[1].Actor)
+	require.Equal(t, "title", records[1].Before.Title)
+	require.Equal(t, "moved", records[1].After.Title)
+
+	resp = httptest.NewRecorder()
+	s.GetOwnerActivity(resp, httptest.NewRequest(http.MethodPost, "/events/activity",
+		bytes.NewReader([]byte(`{"ownerId":"owner","limit":1}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	records = nil
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &records))
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "123", records[0].EventID)
+}
+
+func TestServer_IdempotencyKey(t *testing.T) {
+	s := &Server{app: mockApp()}
+	add := func(key, title string) *httptest.ResponseRecorder {
+		event := `{"title":"` + title + `","startTime":"2099-01-02T15:04:05Z","endTime":"2099-01-03T15:04:05Z"}`
+		req := httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(event)))
+		req.Header.Set(idempotencyKeyHeader, key)
+		resp := httptest.NewRecorder()
+		s.AddEvent(resp, req)
+		return resp
+	}
+
+	first := add("key", "title")
+	require.Equal(t, http.StatusOK, first.Code)
+	repeated := add("key", "title")
+	require.Equal(t, http.StatusOK, repeated.Code)
+	require.Equal(t, first.Body.String(), repeated.Body.String())
+	require.Equal(t, `"1"`, repeated.Header().Get("ETag"))
+
+	require.Equal(t, http.StatusUnprocessableEntity, add("key", "other title").Code)
+	other := add("other key", "title")
+	require.Equal(t, http.StatusOK, other.Code)
+	require.NotEqual(t, first.Body.String(), other.Body.String())
+}
+
+func TestServer_Tags(t *testing.T) {
+	s := &Server{app: mockApp()}
+	for _, event := range []string{
+		`{"id":"1","startTime":"2099-01-02T10:00:00Z","endTime":"2099-01-02T11:00:00Z","ownerId":"owner",` +
+			`"tags":["On-Call","ops"],"color":"#ff8800","location":{"name":"Room 1"}}`,
+		`{"id":"2","startTime":"2099-01-02T12:00:00Z","endTime":"2099-01-02T13:00:00Z","ownerId":"owner",` +
+			`"tags":["ops"]}`,
+	} {
+		resp := httptest.NewRecorder()
+		s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(event))))
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	}
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(
+		`{"startTime":"2099-01-02T10:00:00Z","endTime":"2099-01-02T11:00:00Z","color":"orange"}`))))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.GetEventsForDay(resp, httptest.NewRequest(http.MethodPost, "/events/day",
+		bytes.NewReader([]byte(`{"date":"2099-01-02T00:00:00Z","tags":["on-call"]}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var events []storage.Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &events))
+	require.Equal(t, 1, len(events))
+	require.Equal(t, []string{"on-call", "ops"}, events[0].Tags)
+	require.Equal(t, "Room 1", events[0].Location.Name)
+
+	resp = httptest.NewRecorder()
+	s.GetTagStats(resp, httptest.NewRequest(http.MethodPost, "/tags/stats",
+		bytes.NewReader([]byte(`{"ownerId":"owner"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var stats []storage.TagCount
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &stats))
+	require.Equal(t, []storage.TagCount{{Tag: "ops", Count: 2}, {Tag: "on-call", Count: 1}}, stats)
+}
+
+func TestServer_Search(t *testing.T) {
+	s := &Server{app: mockApp()}
+	for _, event := range []string{
+		`{"id":"1","startTime":"2099-01-02T10:00:00Z","endTime":"2099-01-02T11:00:00Z","ownerId":"owner",` +
+			`"title":"Design review","description":"Spring release"}`,
+		`{"id":"2","startTime":"2099-01-02T12:00:00Z","endTime":"2099-01-02T13:00:00Z","ownerId":"other",` +
+			`"title":"Planning","description":"Review the design"}`,
+	} {
+		resp := httptest.NewRecorder()
+		s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(event))))
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	resp := httptest.NewRecorder()
+	s.SearchEvents(resp, httptest.NewRequest(http.MethodPost, "/events/search",
+		bytes.NewReader([]byte(`{"query":"desig* review"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var results []storage.SearchResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	require.Len(t, results, 2)
+	require.Equal(t, "1", results[0].Event.ID)
+	require.Greater(t, results[0].Rank, results[1].Rank)
+
+	resp = httptest.NewRecorder()
+	s.SearchEvents(resp, httptest.NewRequest(http.MethodPost, "/events/search",
+		bytes.NewReader([]byte(`{"query":"\"design review\"","ownerId":"other"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `[]`, resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	s.SearchEvents(resp, httptest.NewRequest(http.MethodPost, "/events/search",
+		bytes.NewReader([]byte(`{"query":" "}`))))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServer_QuickAdd(t *testing.T) {
+	s := &Server{app: mockApp()}
+	resp := httptest.NewRecorder()
+	s.QuickAddEvent(resp, httptest.NewRequest(http.MethodPost, "/events/quick", bytes.NewReader([]byte(
+		`{"text":"Lunch with Anna tomorrow 13:00-14:00 remind 1d","ownerId":"owner","timeZone":"UTC"}`))))
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var event storage.Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &event))
+	require.NotEmpty(t, event.ID)
+	require.Equal(t, "Lunch with Anna", event.Title)
+	require.Equal(t, "owner", event.OwnerID)
+	require.Equal(t, 13, event.StartTime.Hour())
+	require.Equal(t, time.Hour, event.EndTime.Sub(event.StartTime))
+	require.Equal(t, int32(1), event.NotifyBefore)
+	require.Equal(t, etag(event.Version), resp.Header().Get("ETag"))
+
+	for _, body := range []string{
+		`{"text":"Lunch with Anna","ownerId":"owner"}`,
+		`{"text":"Lunch tomorrow at noon","timeZone":"Nowhere/Unknown"}`,
+	} {
+		resp = httptest.NewRecorder()
+		s.QuickAddEvent(resp, httptest.NewRequest(http.MethodPost, "/events/quick", bytes.NewReader([]byte(body))))
+		require.Equal(t, http.StatusBadRequest, resp.Code, body)
+	}
+}
+
+func TestServer_Attachments(t *testing.T) {
+	s := &Server{app: app.New(memorystorage.New(), app.WithAttachments(memoryblob.New(), 16))}
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(
+		`{"id":"1","startTime":"2099-01-02T10:00:00Z","endTime":"2099-01-02T11:00:00Z"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.UploadAttachment(resp, httptest.NewRequest(http.MethodPost, "/attachments/upload?eventId=1&name=agenda.txt",
+		bytes.NewReader([]byte("1. Introduction"))))
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var attachment storage.Attachment
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &attachment))
+	require.Equal(t, "text/plain; charset=utf-8", attachment.ContentType)
+	require.Equal(t, int64(15), attachment.Size)
+	download := "/attachments/download?eventId=1&id=" + attachment.ID
+
+	resp = httptest.NewRecorder()
+	s.DownloadAttachment(resp, httptest.NewRequest(http.MethodGet, download, nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "1. Introduction", resp.Body.String())
+	require.Equal(t, `attachment; filename=agenda.txt`, resp.Header().Get("Content-Disposition"))
+
+	resp = httptest.NewRecorder()
+	s.UploadAttachment(resp, httptest.NewRequest(http.MethodPost, "/attachments/upload?eventId=1&name=slides.pdf",
+		bytes.NewReader([]byte("%PDF-1.7 and more than 16 bytes"))))
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.RemoveAttachment(resp, httptest.NewRequest(http.MethodPost, "/attachments/remove",
+		bytes.NewReader([]byte(`{"eventId":"1","id":"`+attachment.ID+`"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = httptest.NewRecorder()
+	s.DownloadAttachment(resp, httptest.NewRequest(http.MethodGet, download, nil))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	(&Server{app: mockApp()}).UploadAttachment(resp, httptest.NewRequest(http.MethodPost,
+		"/attachments/upload?eventId=1&name=agenda.txt", bytes.NewReader([]byte("agenda"))))
+	require.Equal(t, http.StatusNotImplemented, resp.Code)
+}
+
+func TestServer_Trash(t *testing.T) {
+	s := &Server{app: mockApp()}
+	event := `{"id":"123","title":"title","startTime":"2099-01-02T15:04:05Z",` +
+		`"endTime":"2099-01-03T15:04:05Z","ownerId":"owner"}`
+	resp := httptest.NewRecorder()
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader([]byte(event))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = httptest.NewRecorder()
+	s.RemoveEvent(resp, httptest.NewRequest(http.MethodPost, "/remove", bytes.NewReader([]byte(`{"id":"123"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.ListTrash(resp, httptest.NewRequest(http.MethodPost, "/trash", bytes.NewReader([]byte(`{"ownerId":"owner"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var events []storage.Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &events))
+	require.Equal(t, 1, len(events))
+	require.NotNil(t, events[0].DeletedAt)
+
+	resp = httptest.NewRecorder()
+	s.RestoreEvent(resp, httptest.NewRequest(http.MethodPost, "/restore", bytes.NewReader([]byte(`{"id":"123"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, `"3"`, resp.Header().Get("ETag"))
+
+	resp = httptest.NewRecorder()
+	s.GetEvent(resp, httptest.NewRequest(http.MethodPost, "/get", bytes.NewReader([]byte(`{"id":"123"}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.RestoreEvent(resp, httptest.NewRequest(http.MethodPost, "/restore", bytes.NewReader([]byte(`{"id":"123"}`))))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Config{Enabled: true, Rate: 0.001, Burst: 2})
+	handler := rateLimitMiddleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		apiKey       string
+		expectedCode int
+	}{
+		{name: "first request", expectedCode: http.StatusOK},
+		{name: "second request", expectedCode: http.StatusOK},
+		{name: "limit exceeded", expectedCode: http.StatusTooManyRequests},
+		{name: "unverified api key", apiKey: "key", expectedCode: http.StatusTooManyRequests},
+		{name: "another client", remoteAddr: "192.0.2.2:1234", expectedCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/add", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, tt.expectedCode, resp.Code)
+			if tt.expectedCode == http.StatusTooManyRequests {
+				require.NotEmpty(t, resp.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestServer_RequestID(t *testing.T) {
+	var requestID string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = logger.RequestIDFromContext(r.Context())
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	require.NotEmpty(t, requestID)
+	require.Equal(t, requestID, resp.Header().Get("X-Request-ID"))
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("X-Request-ID", "42")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, "42", requestID)
+	require.Equal(t, "42", resp.Header().Get("X-Request-ID"))
+}
+
+func TestServer_Webhooks(t *testing.T) {
+	s := &Server{app: mockApp()}
+	resp := httptest.NewRecorder()
+	s.AddWebhook(resp, httptest.NewRequest(http.MethodPost, "/webhooks/add",
+		bytes.NewReader([]byte(`{"url":"ftp://example.com"}`))))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.AddWebhook(resp, httptest.NewRequest(http.MethodPost, "/webhooks/add",
+		bytes.NewReader([]byte(`{"url":"https://169.254.169.254/latest/meta-data"}`))))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = httptest.NewRecorder()
+	s.AddWebhook(resp, httptest.NewRequest(http.MethodPost, "/webhooks/add",
+		bytes.NewReader([]byte(`{"url":"https://example.com/hook","eventTypes":["created"]}`))))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var created CreatedWebhook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.NotEmpty(t, created.ID)
+	require.NotEmpty(t, created.Secret, "the secret is returned on creation")
+
+	resp = httptest.NewRecorder()
+	s.ListWebhooks(resp, httptest.NewRequest(http.MethodGet, "/webhooks/list", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NotContains(t, resp.Body.String(), created.Secret, "the secret is not listed")
+	var webhooks []storage.Webhook
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&webhooks))
+	require.Len(t, webhooks, 1)
+
+	id := []byte(`{"id":"` + created.ID + `"}`)
+	resp = httptest.NewRecorder()
+	s.GetWebhookDeliveries(resp, httptest.NewRequest(http.MethodPost, "/webhooks/deliveries", bytes.NewReader(id)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = httptest.NewRecorder()
+	s.RemoveWebhook(resp, httptest.NewRequest(http.MethodPost, "/webhooks/remove", bytes.NewReader(id)))
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = httptest.NewRecorder()
+	s.EnableWebhook(resp, httptest.NewRequest(http.MethodPost, "/webhooks/enable", bytes.NewReader(id)))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestServer_MissingEvent(t *testing.T) {
+	s := &Server{app: mockApp()}
+	missing := []byte(`{"id":"missing"}`)
+	update := []byte(`{"id":"missing","event":{"title":"t","startTime":"2099-01-02T15:04:05Z",` +
+		`"endTime":"2099-01-03T15:04:05Z","ownerId":"owner"}}`)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    []byte
+	}{
+		{name: "get", handler: s.GetEvent, body: missing},
+		{name: "update", handler: s.UpdateEvent, body: update},
+		{name: "remove", handler: s.RemoveEvent, body: missing},
+		{name: "restore", handler: s.RestoreEvent, body: missing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			tt.handler(resp, httptest.NewRequest(http.MethodPost, "/"+tt.name, bytes.NewReader(tt.body)))
+			require.Equal(t, http.StatusNotFound, resp.Code)
+		})
+	}
+
+	resp := httptest.NewRecorder()
+	past := []byte(`{"title":"t","startTime":"2001-01-02T15:04:05Z","endTime":"2001-01-03T15:04:05Z","ownerId":"owner"}`)
+	s.AddEvent(resp, httptest.NewRequest(http.MethodPost, "/add", bytes.NewReader(past)))
+	require.Equal(t, http.StatusBadRequest, resp.Code, "events in the past are rejected")
+}
@@ -0,0 +1,83 @@
+package internalhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+)
+
+// sseKeepAlive is how often a comment is sent to keep idle event streams open.
+const sseKeepAlive = 15 * time.Second
+
+var ErrInvalidResumeToken = errors.New("invalid resume token")
+
+// WatchEvents streams changes of the owner's events as Server-Sent Events. The feed is
+// resumed after the token from the Last-Event-ID header or the resumeToken query parameter.
+func (s *Server) WatchEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		returnErr(w, r, errors.New("streaming is not supported"))
+		return
+	}
+	token := r.Header.Get("Last-Event-ID")
+	if token == "" {
+		token = r.URL.Query().Get("resumeToken")
+	}
+	var after int64
+	if token != "" {
+		var err error
+		after, err = strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			returnErr(w, r, fmt.Errorf("%w: %q", ErrInvalidResumeToken, token))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// Streams never finish by themselves, so they are closed when the server stops.
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	changes, err := s.app.WatchEvents(ctx, r.URL.Query().Get("ownerId"), after)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(c)
+			if err != nil {
+				logger.FromContext(r.Context()).Errorf("failed to marshal change: %v", err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Token, c.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,116 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// defaultDeliveriesLimit is used when the deliveries request has no limit.
+const defaultDeliveriesLimit = 100
+
+type WebhookReq struct {
+	URL        string               `json:"url"`
+	EventTypes []storage.ChangeType `json:"eventTypes"`
+	OwnerID    string               `json:"ownerId"`
+	// Secret signs the payloads, a random one is generated when it is empty.
+	Secret string `json:"secret"`
+}
+
+// CreatedWebhook is the only response carrying the secret of the webhook.
+type CreatedWebhook struct {
+	storage.Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookIDReq struct {
+	ID    string `json:"id"`
+	Limit int    `json:"limit"`
+}
+
+func (s *Server) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	req := WebhookReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	hook, err := s.app.CreateWebhook(r.Context(), storage.Webhook{
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		OwnerID:    req.OwnerID,
+		Secret:     req.Secret,
+	})
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CreatedWebhook{Webhook: hook, Secret: hook.Secret})
+}
+
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.app.GetWebhooks(r.Context())
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (s *Server) RemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	req := WebhookIDReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	if err := s.app.RemoveWebhook(r.Context(), req.ID); err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// EnableWebhook enables the webhook disabled after repeated failures.
+func (s *Server) EnableWebhook(w http.ResponseWriter, r *http.Request) {
+	req := WebhookIDReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	hook, err := s.app.EnableWebhook(r.Context(), req.ID)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, the latest deliveries go first.
+func (s *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	req := WebhookIDReq{}
+	err := parseRequestBody(r, &req)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultDeliveriesLimit
+	}
+	deliveries, err := s.app.GetWebhookDeliveries(r.Context(), req.ID, req.Limit)
+	if err != nil {
+		returnErr(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFoundAttachment = errors.New("attachment not found")
+
+// Attachment describes a file attached to the event, the content is kept in a blob store under the ID.
+type Attachment struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// FindAttachment returns the attachment of the event with the ID.
+func (e *Event) FindAttachment(id string) (Attachment, error) {
+	for _, a := range e.Attachments {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return Attachment{}, ErrNotFoundAttachment
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditCreated  AuditAction = "created"
+	AuditUpdated  AuditAction = "updated"
+	AuditDeleted  AuditAction = "deleted"
+	AuditPurged   AuditAction = "purged"
+	AuditNotified AuditAction = "notified"
+	AuditRestored AuditAction = "restored"
+)
+
+// AuditRecord is an entry of the append-only audit trail. Before is nil for created
+// events, After is nil for deleted and purged ones.
+type AuditRecord struct {
+	ID      int64       `json:"id"`
+	Action  AuditAction `json:"action"`
+	EventID string      `json:"eventId"`
+	OwnerID string      `json:"ownerId"`
+	Actor   string      `json:"actor"`
+	Time    time.Time   `json:"time"`
+	Before  *Event      `json:"before,omitempty"`
+	After   *Event      `json:"after,omitempty"`
+}
+
+// AnonymousActor is recorded in the audit trail when the context carries no actor.
+const AnonymousActor = "anonymous"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the user on whose behalf the events are changed,
+// the storages record the actor with the changes made in the context.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context or AnonymousActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// NewAuditRecord builds a record of the action made by the actor of the context at the time,
+// before and after are the stored rows.
+func NewAuditRecord(ctx context.Context, action AuditAction, at time.Time, before, after *Event) AuditRecord {
+	r := AuditRecord{Action: action, Actor: ActorFromContext(ctx), Time: at, Before: before, After: after}
+	for _, e := range []*Event{after, before} {
+		if e != nil {
+			r.EventID, r.OwnerID = e.ID, e.OwnerID
+			break
+		}
+	}
+	return r
+}
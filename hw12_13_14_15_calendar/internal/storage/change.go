@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTokenExpired is returned for a token followed by changes purged from the feed,
+// the client has to read the current state again instead of resuming.
+var ErrTokenExpired = errors.New("change token expired")
+
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change is an entry of the event change feed. Tokens grow monotonically,
+// a client resumes the feed by passing the token of the last received change.
+type Change struct {
+	Token   int64      `json:"token"`
+	Type    ChangeType `json:"type"`
+	EventID string     `json:"eventId"`
+	OwnerID string     `json:"ownerId"`
+	Event   Event      `json:"event"`
+	Time    time.Time  `json:"time"`
+}
+
+// ChangeListener is implemented by storages shared between several processes.
+// ListenChanges calls fn for every change recorded by any of them until ctx is done.
+type ChangeListener interface {
+	ListenChanges(ctx context.Context, fn func(Change)) error
+}
@@ -1,29 +1,140 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/util"
 )
 
+var ErrInvalidEvent = errors.New("invalid event")
+
+// colorPattern matches colors in the #rrggbb notation.
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// westernmostOffset is the offset from UTC of the latest time zone, a date starts there last.
+const westernmostOffset = 12 * time.Hour
+
 type Event struct {
-	ID           string    `json:"id"`
-	Title        string    `json:"title"`
-	IsSent       bool      `json:"isSent"`
-	StartTime    time.Time `json:"startTime"`
-	EndTime      time.Time `json:"endTime"`
-	Description  string    `json:"description"`
-	OwnerID      string    `json:"ownerId"`
-	NotifyBefore int32     `json:"notifyBefore"`
+	ID           string     `json:"id"`
+	Title        string     `json:"title"`
+	IsSent       bool       `json:"isSent"`
+	StartTime    time.Time  `json:"startTime"`
+	EndTime      time.Time  `json:"endTime"`
+	Description  string     `json:"description"`
+	OwnerID      string     `json:"ownerId"`
+	NotifyBefore int32      `json:"notifyBefore"`
+	Version      int64      `json:"version"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	// Tags categorize the event, they are stored normalized by NormalizeTags.
+	Tags []string `json:"tags,omitempty"`
+	// Color is the display color in the #rrggbb notation, empty means the default one.
+	Color         string   `json:"color"`
+	Location      Location `json:"location"`
+	ConferenceURL string   `json:"conferenceUrl"`
+	// AllDay events take whole dates regardless of the time zone, see NormalizeDates.
+	AllDay bool `json:"allDay"`
+	// Attachments are changed only by AddAttachment and RemoveAttachment of the storage,
+	// adding and updating the event keeps the stored ones.
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Location is where the event takes place.
+type Location struct {
+	// Name is a free text address or room.
+	Name string `json:"name"`
+	// Geo is set when the coordinates of the place are known.
+	Geo *GeoPoint `json:"geo,omitempty"`
+}
+
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
-func (e *Event) Validate() error {
+// Validate checks the event starting after now.
+func (e *Event) Validate(now time.Time) error {
 	if !e.EndTime.After(e.StartTime) {
 		return fmt.Errorf("start time of the event must be in the future: %w", ErrIncorrectEventTime)
 	}
 
-	if e.StartTime.Before(time.Now()) {
+	if e.StartsBefore(now) {
 		return ErrIncorrectEventTime
 	}
 
+	return e.ValidateAttributes()
+}
+
+// NormalizeDates turns the times of an all-day event into dates stored as UTC midnights: the start
+// is the date of StartTime and the end is the day after the last one. The dates are taken in the
+// location of the times, an end within the start date makes a single day event.
+func (e *Event) NormalizeDates() {
+	if !e.AllDay {
+		return
+	}
+	e.StartTime, e.EndTime = DateRange(e.StartTime, e.EndTime)
+	if !e.EndTime.After(e.StartTime) {
+		e.EndTime = e.StartTime.AddDate(0, 0, 1)
+	}
+}
+
+// StartsBefore reports whether the event starts before the time. The date of an all-day event
+// is compared with the date in the westernmost time zone, so it can be created for today anywhere.
+func (e *Event) StartsBefore(t time.Time) bool {
+	if e.AllDay {
+		return e.StartTime.Before(dateOf(t.UTC().Add(-westernmostOffset)))
+	}
+	return e.StartTime.Before(t)
+}
+
+// Overlaps reports whether the event takes any time of [start:end). All-day events are matched
+// by the dates of the range in its location, so they fall on the same days in every time zone.
+func (e *Event) Overlaps(start, end time.Time) bool {
+	if e.AllDay {
+		start, end = DateRange(start, end)
+	}
+	return e.StartTime.Before(end) && e.EndTime.After(start)
+}
+
+// DateRange returns the dates touched by [start:end) as UTC midnights, the way all-day events are stored.
+func DateRange(start, end time.Time) (time.Time, time.Time) {
+	endDate := dateOf(end)
+	if !util.TruncateToDay(end).Equal(end) {
+		endDate = endDate.AddDate(0, 0, 1)
+	}
+	return dateOf(start), endDate
+}
+
+// dateOf returns the date of the time in its location as a UTC midnight.
+func dateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// ValidateAttributes checks the fields of the event other than its time.
+func (e *Event) ValidateAttributes() error {
+	for _, tag := range e.Tags {
+		if len(tag) > maxTagLength {
+			return fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidEvent, tag, maxTagLength)
+		}
+	}
+	if e.Color != "" && !colorPattern.MatchString(e.Color) {
+		return fmt.Errorf("%w: color %q is not in the #rrggbb notation", ErrInvalidEvent, e.Color)
+	}
+	if geo := e.Location.Geo; geo != nil {
+		if geo.Latitude < -90 || geo.Latitude > 90 || geo.Longitude < -180 || geo.Longitude > 180 {
+			return fmt.Errorf("%w: coordinates %v, %v are out of range", ErrInvalidEvent, geo.Latitude, geo.Longitude)
+		}
+	}
+	if e.ConferenceURL != "" {
+		u, err := url.Parse(e.ConferenceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: conference URL %q is not an http(s) URL", ErrInvalidEvent, e.ConferenceURL)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyExists      = errors.New("idempotency key exists")
+	ErrNotFoundIdempotencyRecord = errors.New("idempotency record not found")
+	ErrIdempotencyKeyReused      = errors.New("idempotency key is reused with another request")
+	ErrIdempotencyKeyInProgress  = errors.New("request with the idempotency key is in progress")
+)
+
+// IdempotencyRecord remembers the result of a request made with an idempotency key.
+type IdempotencyRecord struct {
+	// Key is unique per actor, so clients do not see results of each other.
+	Key   string
+	Actor string
+	// RequestHash identifies the payload of the request, a key is not reused for another payload.
+	RequestHash string
+	// Event is the created event, it is nil while the request is in progress.
+	Event     *Event
+	CreatedAt time.Time
+}
@@ -0,0 +1,50 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) AddAttachment(ctx context.Context, eventID string, a storage.Attachment) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.active(eventID)
+	if !ok {
+		return storage.Event{}, fmt.Errorf("failed to attach to event with id %q: %w", eventID, storage.ErrNotFoundEvent)
+	}
+	before := e
+	attachments := make([]storage.Attachment, 0, len(e.Attachments)+1)
+	e.Attachments = append(append(attachments, e.Attachments...), a)
+	e.Version++
+	e.UpdatedAt = s.clock.Now()
+	s.data[eventID] = e
+	s.record(ctx, storage.AuditUpdated, &before, &e)
+	return e, nil
+}
+
+func (s *Storage) RemoveAttachment(ctx context.Context, eventID, attachmentID string) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.active(eventID)
+	if !ok {
+		return storage.Event{}, fmt.Errorf("failed to detach from event with id %q: %w", eventID, storage.ErrNotFoundEvent)
+	}
+	if _, err := e.FindAttachment(attachmentID); err != nil {
+		return storage.Event{}, fmt.Errorf("failed to detach %q from event with id %q: %w", attachmentID, eventID, err)
+	}
+	before := e
+	attachments := make([]storage.Attachment, 0, len(e.Attachments)-1)
+	for _, a := range e.Attachments {
+		if a.ID != attachmentID {
+			attachments = append(attachments, a)
+		}
+	}
+	e.Attachments = attachments
+	e.Version++
+	e.UpdatedAt = s.clock.Now()
+	s.data[eventID] = e
+	s.record(ctx, storage.AuditUpdated, &before, &e)
+	return e, nil
+}
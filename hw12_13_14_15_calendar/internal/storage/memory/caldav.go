@@ -0,0 +1,42 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) LinkCaldavName(_ context.Context, ownerID, name, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[eventID]; !ok {
+		return fmt.Errorf("failed to link %q to event %q: %w", name, eventID, storage.ErrNotFoundEvent)
+	}
+	if s.caldavNames[ownerID] == nil {
+		s.caldavNames[ownerID] = make(map[string]string)
+	}
+	s.caldavNames[ownerID][name] = eventID
+	return nil
+}
+
+func (s *Storage) GetCaldavNames(_ context.Context, ownerID string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make(map[string]string, len(s.caldavNames[ownerID]))
+	for name, id := range s.caldavNames[ownerID] {
+		names[name] = id
+	}
+	return names, nil
+}
+
+// unlinkCaldavNames drops the names of the purged event.
+func (s *Storage) unlinkCaldavNames(e storage.Event) {
+	for _, names := range s.caldavNames {
+		for name, id := range names {
+			if id == e.ID {
+				delete(names, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+type idempotencyKey struct {
+	actor string
+	key   string
+}
+
+func (s *Storage) AddIdempotencyRecord(_ context.Context, r storage.IdempotencyRecord, expiredBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{actor: r.Actor, key: r.Key}
+	if current, ok := s.idempotency[k]; ok && !current.CreatedAt.Before(expiredBefore) {
+		return fmt.Errorf("failed to add idempotency key %q: %w", r.Key, storage.ErrIdempotencyKeyExists)
+	}
+	r.Event = nil
+	s.idempotency[k] = r
+	return nil
+}
+
+func (s *Storage) GetIdempotencyRecord(_ context.Context, actor, key string) (storage.IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.idempotency[idempotencyKey{actor: actor, key: key}]
+	if !ok {
+		return storage.IdempotencyRecord{}, fmt.Errorf(
+			"failed to get idempotency key %q: %w", key, storage.ErrNotFoundIdempotencyRecord)
+	}
+	return r, nil
+}
+
+func (s *Storage) SetIdempotencyResult(_ context.Context, actor, key string, e storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{actor: actor, key: key}
+	r, ok := s.idempotency[k]
+	if !ok {
+		return fmt.Errorf("failed to set result of idempotency key %q: %w", key, storage.ErrNotFoundIdempotencyRecord)
+	}
+	r.Event = &e
+	s.idempotency[k] = r
+	return nil
+}
+
+func (s *Storage) RemoveIdempotencyRecord(_ context.Context, actor, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotency, idempotencyKey{actor: actor, key: key})
+	return nil
+}
+
+func (s *Storage) PurgeIdempotencyRecords(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var purged int64
+	for k, r := range s.idempotency {
+		if r.CreatedAt.Before(before) {
+			delete(s.idempotency, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,193 @@
+package memorystorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// fieldWeights rank matches in the title above matches in the description.
+var fieldWeights = [...]float64{1, 0.4}
+
+// searchIndex maps the words of the titles and descriptions of the active events to the event IDs,
+// so a search ranks only the events having all the words of the query. The writes only mark the events
+// stale, they are reindexed by the next search.
+type searchIndex struct {
+	mu       sync.Mutex
+	postings map[string]map[string]struct{}
+	// words are the indexed words of every event.
+	words map[string][]string
+	stale map[string]struct{}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]struct{}),
+		words:    make(map[string][]string),
+		stale:    make(map[string]struct{}),
+	}
+}
+
+// invalidate marks the event added, changed or deleted, the caller holds the write lock of the storage.
+func (x *searchIndex) invalidate(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.stale[id] = struct{}{}
+}
+
+// candidates returns the IDs of the stored events having every word of the terms, the last word of
+// a prefix term matches the words starting with it. The order of the words of a phrase is checked
+// by the rank. The caller holds the read lock of the storage.
+func (x *searchIndex) candidates(data map[string]storage.Event, terms []storage.SearchTerm) map[string]struct{} {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.refresh(data)
+	var found map[string]struct{}
+	for _, term := range terms {
+		for i, word := range term.Words {
+			ids := x.postings[word]
+			if term.Prefix && i == len(term.Words)-1 {
+				ids = x.prefixed(word)
+			}
+			matched := make(map[string]struct{}, len(ids))
+			for id := range ids {
+				if _, ok := found[id]; ok || found == nil {
+					matched[id] = struct{}{}
+				}
+			}
+			if len(matched) == 0 {
+				return nil
+			}
+			found = matched
+		}
+	}
+	return found
+}
+
+// refresh reindexes the stale events, the events in the trash are not indexed.
+func (x *searchIndex) refresh(data map[string]storage.Event) {
+	for id := range x.stale {
+		for _, word := range x.words[id] {
+			delete(x.postings[word], id)
+			if len(x.postings[word]) == 0 {
+				delete(x.postings, word)
+			}
+		}
+		delete(x.words, id)
+		if e, ok := data[id]; ok && e.DeletedAt == nil {
+			x.words[id] = eventWords(e)
+			for _, word := range x.words[id] {
+				ids, ok := x.postings[word]
+				if !ok {
+					ids = make(map[string]struct{})
+					x.postings[word] = ids
+				}
+				ids[id] = struct{}{}
+			}
+		}
+		delete(x.stale, id)
+	}
+}
+
+// prefixed returns the IDs of the events having a word starting with the prefix.
+func (x *searchIndex) prefixed(prefix string) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for word, wordIDs := range x.postings {
+		if strings.HasPrefix(word, prefix) {
+			for id := range wordIDs {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
+
+// eventWords returns the distinct words of the title and the description.
+func eventWords(e storage.Event) []string {
+	seen := make(map[string]bool)
+	words := make([]string, 0)
+	for _, word := range append(storage.SearchWords(e.Title), storage.SearchWords(e.Description)...) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// searchRank returns the weighted number of occurrences of every term in the event,
+// zero when any of the terms is missing.
+func searchRank(e storage.Event, terms []storage.SearchTerm) float64 {
+	fields := [len(fieldWeights)][]string{storage.SearchWords(e.Title), storage.SearchWords(e.Description)}
+	var total float64
+	for _, term := range terms {
+		var rank float64
+		for field, weight := range fieldWeights {
+			rank += weight * float64(occurrences(fields[field], term))
+		}
+		if rank == 0 {
+			return 0
+		}
+		total += rank
+	}
+	return total
+}
+
+// occurrences counts the positions in the words where the words of the term follow each other.
+func occurrences(words []string, term storage.SearchTerm) int {
+	count := 0
+	for start := 0; start+len(term.Words) <= len(words); start++ {
+		if matchAt(words[start:], term) {
+			count++
+		}
+	}
+	return count
+}
+
+func matchAt(words []string, term storage.SearchTerm) bool {
+	last := len(term.Words) - 1
+	for i, word := range term.Words {
+		if i == last && term.Prefix {
+			if !strings.HasPrefix(words[i], word) {
+				return false
+			}
+		} else if words[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Storage) SearchEvents(_ context.Context, query storage.SearchQuery) ([]storage.SearchResult, error) {
+	if len(query.Terms) == 0 {
+		return nil, storage.ErrInvalidSearchQuery
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]storage.SearchResult, 0)
+	for id := range s.search.candidates(s.data, query.Terms) {
+		e := s.data[id]
+		if query.OwnerID != "" && e.OwnerID != query.OwnerID {
+			continue
+		}
+		if rank := searchRank(e, query.Terms); rank > 0 {
+			results = append(results, storage.SearchResult{Event: e, Rank: rank})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		if !results[i].Event.StartTime.Equal(results[j].Event.StartTime) {
+			return results[i].Event.StartTime.Before(results[j].Event.StartTime)
+		}
+		return results[i].Event.ID < results[j].Event.ID
+	})
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
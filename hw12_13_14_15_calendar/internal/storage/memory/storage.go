@@ -3,24 +3,65 @@ package memorystorage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/util"
 )
 
+// maxChanges bounds the change feed kept in memory, older changes are dropped.
+const maxChanges = 10000
+
+// noUpperBound ends the ranges without an end.
+var noUpperBound = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
 type Storage struct {
 	mu           sync.RWMutex
 	data         map[string]storage.Event
+	search       *searchIndex
 	idSeq        int
 	firstWeekDay time.Weekday
+	changes      []storage.Change
+	changeSeq    int64
+	purgedToken  int64
+	audit        []storage.AuditRecord
+	idempotency  map[idempotencyKey]storage.IdempotencyRecord
+	webhooks     []storage.Webhook
+	webhookSeq   int
+	deliveries   []storage.WebhookDelivery
+	deliverySeq  int64
+	caldavNames  map[string]map[string]string
+	clock        clock.Clock
 }
 
-func New() *Storage {
-	return &Storage{data: make(map[string]storage.Event), firstWeekDay: time.Monday}
+type Option func(*Storage)
+
+// WithClock sets the clock checking the event times and stamping the changes and the audit records,
+// the system one by default.
+func WithClock(c clock.Clock) Option {
+	return func(s *Storage) {
+		s.clock = c
+	}
+}
+
+func New(opts ...Option) *Storage {
+	s := &Storage{
+		data:         make(map[string]storage.Event),
+		search:       newSearchIndex(),
+		firstWeekDay: time.Monday,
+		idempotency:  make(map[idempotencyKey]storage.IdempotencyRecord),
+		caldavNames:  make(map[string]map[string]string),
+		clock:        clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Storage) Connect(_ context.Context) error {
@@ -31,59 +72,236 @@ func (s *Storage) Close(_ context.Context) error {
 	return nil
 }
 
-func (s *Storage) AddEvent(_ context.Context, e *storage.Event) error {
+func (s *Storage) AddEvent(ctx context.Context, e *storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addEvent(ctx, e)
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateEvent(ctx, id, e, version)
+}
+
+func (s *Storage) PatchEvent(
+	ctx context.Context,
+	id string,
+	patch storage.EventPatch,
+	version int64,
+) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.active(id)
+	if !ok {
+		return storage.Event{}, fmt.Errorf("failed to patch event with id %q: %w", id, storage.ErrNotFoundEvent)
+	}
+	if err := checkVersion(current, version); err != nil {
+		return storage.Event{}, fmt.Errorf("failed to patch event with id %q: %w", id, err)
+	}
+	e := patch.Apply(current)
+	if err := e.Validate(s.clock.Now()); err != nil {
+		return storage.Event{}, err
+	}
+	e.Version = current.Version + 1
+	e.UpdatedAt = s.clock.Now()
+	s.data[id] = e
+	s.search.invalidate(id)
+	s.record(ctx, storage.AuditUpdated, &current, &e)
+	return e, nil
+}
+
+func (s *Storage) RemoveEvent(ctx context.Context, id string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeEvent(ctx, id, version)
+}
+
+func (s *Storage) GetEvent(_ context.Context, id string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.active(id)
+	if !ok {
+		return storage.Event{}, fmt.Errorf("failed to get event with id %q: %w", id, storage.ErrNotFoundEvent)
+	}
+	return e, nil
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id string) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[id]
+	if !ok || e.DeletedAt == nil {
+		return storage.Event{}, fmt.Errorf("failed to restore event with id %q: %w", id, storage.ErrNotFoundEvent)
+	}
+	e.DeletedAt = nil
+	e.Version++
+	e.UpdatedAt = s.clock.Now()
+	s.data[id] = e
+	s.search.invalidate(id)
+	s.record(ctx, storage.AuditRestored, nil, &e)
+	return e, nil
+}
+
+func (s *Storage) GetTrash(_ context.Context, ownerID string) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]storage.Event, 0)
+	for _, e := range s.data {
+		if e.DeletedAt != nil && (ownerID == "" || e.OwnerID == ownerID) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := make([]storage.Event, 0)
+	for id, e := range s.data {
+		if e.DeletedAt != nil && e.DeletedAt.Before(before) {
+			purged = append(purged, e)
+			delete(s.data, id)
+			s.unlinkCaldavNames(e)
+			purgedEvent := e
+			s.search.invalidate(id)
+			s.record(ctx, storage.AuditPurged, &purgedEvent, nil)
+		}
+	}
+	return purged, nil
+}
+
+func (s *Storage) BatchCreate(ctx context.Context, events []storage.Event) ([]storage.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]storage.BatchResult, len(events))
+	for i := range events {
+		e := events[i]
+		err := s.addEvent(ctx, &e)
+		results[i] = storage.BatchResult{ID: e.ID, Version: e.Version, Err: err}
+		if err == nil {
+			results[i].Event = &e
+		}
+	}
+	return results, nil
+}
+
+func (s *Storage) BatchUpdate(ctx context.Context, items []storage.BatchUpdateItem) ([]storage.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]storage.BatchResult, len(items))
+	for i, item := range items {
+		version, err := s.updateEvent(ctx, item.ID, item.Event, item.Version)
+		results[i] = storage.BatchResult{ID: item.ID, Version: version, Err: err}
+	}
+	return results, nil
+}
+
+func (s *Storage) BatchDelete(ctx context.Context, items []storage.BatchRemoveItem) ([]storage.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]storage.BatchResult, len(items))
+	for i, item := range items {
+		results[i] = storage.BatchResult{ID: item.ID, Err: s.removeEvent(ctx, item.ID, item.Version)}
+	}
+	return results, nil
+}
+
+func (s *Storage) addEvent(ctx context.Context, e *storage.Event) error {
+	e.NormalizeDates()
 	if !e.EndTime.After(e.StartTime) {
 		return fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
 	}
 
-	if e.StartTime.Before(time.Now()) {
+	if e.StartsBefore(s.clock.Now()) {
 		return storage.ErrIncorrectEventTime
 	}
+	if err := e.ValidateAttributes(); err != nil {
+		return err
+	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, ok := s.data[e.ID]; ok {
 		return fmt.Errorf("duplicate ID %q: %w", e.ID, storage.ErrDuplicateEventID)
 	}
 	if e.ID == "" {
 		e.ID = s.nextID()
 	}
+	e.Tags = storage.NormalizeTags(e.Tags)
+	e.Attachments = nil
+	e.Version = 1
+	e.UpdatedAt = s.clock.Now()
+	e.DeletedAt = nil
 	s.data[e.ID] = *e
+	created := *e
+	s.search.invalidate(e.ID)
+	s.record(ctx, storage.AuditCreated, nil, &created)
 	return nil
 }
 
-func (s *Storage) UpdateEvent(_ context.Context, id string, e storage.Event) error {
-	if e.StartTime.Before(time.Now()) {
-		return fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
+func (s *Storage) updateEvent(ctx context.Context, id string, e storage.Event, version int64) (int64, error) {
+	e.NormalizeDates()
+	if e.StartsBefore(s.clock.Now()) {
+		return 0, fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
 	}
 	if !e.EndTime.After(e.StartTime) {
-		return fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+		return 0, fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+	}
+	if err := e.ValidateAttributes(); err != nil {
+		return 0, err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.data[id]; !ok {
-		return fmt.Errorf("failed to update event with id %q: %w", id, storage.ErrNotFoundEvent)
+	current, ok := s.active(id)
+	if !ok {
+		return 0, fmt.Errorf("failed to update event with id %q: %w", id, storage.ErrNotFoundEvent)
+	}
+	if err := checkVersion(current, version); err != nil {
+		return 0, fmt.Errorf("failed to update event with id %q: %w", id, err)
 	}
 	e.ID = id
+	e.Tags = storage.NormalizeTags(e.Tags)
+	e.Attachments = current.Attachments
+	e.Version = current.Version + 1
+	e.UpdatedAt = s.clock.Now()
+	e.DeletedAt = nil
 	s.data[e.ID] = e
-	return nil
+	s.search.invalidate(id)
+	s.record(ctx, storage.AuditUpdated, &current, &e)
+	return e.Version, nil
 }
 
-func (s *Storage) RemoveEvent(_ context.Context, id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.data[id]; !ok {
+func (s *Storage) removeEvent(ctx context.Context, id string, version int64) error {
+	current, ok := s.active(id)
+	if !ok {
 		return fmt.Errorf("failed to remove event with id %q: %w", id, storage.ErrNotFoundEvent)
 	}
-	delete(s.data, id)
+	if err := checkVersion(current, version); err != nil {
+		return fmt.Errorf("failed to remove event with id %q: %w", id, err)
+	}
+	before := current
+	now := s.clock.Now()
+	current.DeletedAt = &now
+	current.Version++
+	current.UpdatedAt = now
+	s.data[id] = current
+	s.search.invalidate(id)
+	s.record(ctx, storage.AuditDeleted, &before, nil)
 	return nil
 }
 
+// active returns the event if it exists and is not in the trash.
+func (s *Storage) active(id string) (storage.Event, bool) {
+	e, ok := s.data[id]
+	if !ok || e.DeletedAt != nil {
+		return storage.Event{}, false
+	}
+	return e, true
+}
+
 func (s *Storage) GetEventsForDay(_ context.Context, date time.Time) ([]storage.Event, error) {
 	startTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	endTime := startTime.Add(24 * time.Hour)
-	return s.selectByRange(startTime, endTime)
+	return s.selectByRange("", startTime, endTime)
 }
 
 func (s *Storage) GetEventsForWeek(_ context.Context, startDate time.Time) ([]storage.Event, error) {
@@ -92,7 +310,7 @@ func (s *Storage) GetEventsForWeek(_ context.Context, startDate time.Time) ([]st
 		return nil, storage.ErrIncorrectStartDate
 	}
 	endTime := startTime.AddDate(0, 0, 7)
-	return s.selectByRange(startTime, endTime)
+	return s.selectByRange("", startTime, endTime)
 }
 
 func (s *Storage) GetEventsForMonth(_ context.Context, startDate time.Time) ([]storage.Event, error) {
@@ -101,7 +319,44 @@ func (s *Storage) GetEventsForMonth(_ context.Context, startDate time.Time) ([]s
 		return nil, storage.ErrIncorrectStartDate
 	}
 	endTime := startTime.AddDate(0, 1, 0)
-	return s.selectByRange(startTime, endTime)
+	return s.selectByRange("", startTime, endTime)
+}
+
+func (s *Storage) GetOwnerEvents(_ context.Context, ownerID string, from, to time.Time) ([]storage.Event, error) {
+	if to.IsZero() {
+		to = noUpperBound
+	}
+	events, err := s.selectByRange(ownerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].StartTime.Equal(events[j].StartTime) {
+			return events[i].StartTime.Before(events[j].StartTime)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+func (s *Storage) GetTagStats(_ context.Context, ownerID string) ([]storage.TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, e := range s.data {
+		if e.DeletedAt != nil || (ownerID != "" && e.OwnerID != ownerID) {
+			continue
+		}
+		for _, tag := range e.Tags {
+			counts[tag]++
+		}
+	}
+	stats := make([]storage.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		stats = append(stats, storage.TagCount{Tag: tag, Count: count})
+	}
+	storage.SortTagCounts(stats)
+	return stats, nil
 }
 
 func (s *Storage) GetEventsByNotifier(
@@ -113,8 +368,9 @@ func (s *Storage) GetEventsByNotifier(
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for _, event := range s.data {
-		notifyTime := event.StartTime.Add(time.Hour * time.Duration(event.NotifyBefore))
-		if event.NotifyBefore > 0 && !event.IsSent && notifyTime.Before(endTime) {
+		// NotifyBefore is in days as in the SQL storage.
+		notifyTime := event.StartTime.Add(-24 * time.Hour * time.Duration(event.NotifyBefore))
+		if event.NotifyBefore > 0 && !event.IsSent && event.DeletedAt == nil && !notifyTime.After(endTime) {
 			events = append(events, event)
 			if len(events) == limit {
 				return events, nil
@@ -132,57 +388,176 @@ func (s *Storage) MarkSentEvents(
 	if len(events) == 0 {
 		return nil
 	}
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	ids := make([]string, len(events))
-	for i, e := range events {
-		ids[i] = e.ID
-	}
-	for _, event := range s.data {
-		event.IsSent = contains(ids, event.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		if event, ok := s.data[e.ID]; ok {
+			sent := event
+			sent.IsSent = true
+			s.data[e.ID] = sent
+			s.record(ctx, storage.AuditNotified, &event, &sent)
+		}
 	}
 
 	return nil
 }
 
-func (s *Storage) RemoveAfter(ctx context.Context, time time.Time) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Storage) RemoveAfter(ctx context.Context, time time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := make([]storage.Event, 0)
 	for k, event := range s.data {
-		if event.StartTime.After(time) {
+		if event.StartTime.Before(time) {
+			removed = append(removed, event)
 			delete(s.data, k)
+			removedEvent := event
+			s.search.invalidate(k)
+			s.record(ctx, storage.AuditPurged, &removedEvent, nil)
 		}
 	}
-	return nil
+	return removed, nil
 }
 
-// Select in range [startTime:endTime).
-func (s *Storage) selectByRange(startTime time.Time, endTime time.Time) ([]storage.Event, error) {
+// selectByRange returns the active events of the owner overlapping the range, an empty owner
+// returns events of all owners.
+func (s *Storage) selectByRange(ownerID string, startTime time.Time, endTime time.Time) ([]storage.Event, error) {
 	events := make([]storage.Event, 0)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for _, event := range s.data {
-		if (event.StartTime.Equal(startTime) || event.StartTime.After(startTime)) && event.StartTime.Before(endTime) {
+		if event.DeletedAt != nil || (ownerID != "" && event.OwnerID != ownerID) {
+			continue
+		}
+		if event.Overlaps(startTime, endTime) {
 			events = append(events, event)
 		}
 	}
 	return events, nil
 }
 
+// checkVersion compares the stored version with the expected one, zero means any version.
+func checkVersion(current storage.Event, version int64) error {
+	if version != 0 && current.Version != version {
+		return fmt.Errorf("expected version %d, actual %d: %w", version, current.Version, storage.ErrVersionConflict)
+	}
+	return nil
+}
+
 func (s *Storage) nextID() string {
 	s.idSeq++
 	return strconv.Itoa(s.idSeq)
 }
 
-func contains(elems []string, v string) bool {
-	for _, s := range elems {
-		if v == s {
-			return true
+func (s *Storage) AddSenderLog(_ context.Context, _ *rabbit.Message) error {
+	return nil
+}
+
+func (s *Storage) AddChange(_ context.Context, c *storage.Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changeSeq++
+	c.Token = s.changeSeq
+	s.changes = append(s.changes, *c)
+	if len(s.changes) > maxChanges {
+		s.dropChanges(len(s.changes) - maxChanges)
+	}
+	return nil
+}
+
+// dropChanges removes the n oldest changes from the feed, the tokens preceding them expire.
+func (s *Storage) dropChanges(n int) {
+	if n == 0 {
+		return
+	}
+	s.purgedToken = s.changes[n-1].Token
+	s.changes = append(s.changes[:0:0], s.changes[n:]...)
+}
+
+func (s *Storage) GetChanges(_ context.Context, ownerID string, after int64, limit int) ([]storage.Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if after < s.purgedToken {
+		return nil, fmt.Errorf("%w: changes after %d were purged", storage.ErrTokenExpired, after)
+	}
+	changes := make([]storage.Change, 0)
+	for _, c := range s.changes {
+		if c.Token <= after || (ownerID != "" && c.OwnerID != ownerID) {
+			continue
+		}
+		changes = append(changes, c)
+		if len(changes) == limit {
+			break
 		}
 	}
-	return false
+	return changes, nil
 }
 
-func (s *Storage) AddSenderLog(_ context.Context, _ *rabbit.Message) error {
+func (s *Storage) LastChangeToken(_ context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changeSeq, nil
+}
+
+func (s *Storage) PurgeChanges(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.changes) && s.changes[n].Time.Before(before) {
+		n++
+	}
+	s.dropChanges(n)
+	return int64(n), nil
+}
+
+func (s *Storage) AddAuditRecord(_ context.Context, r *storage.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendAudit(r)
 	return nil
 }
+
+// record appends the action made on the event by the actor of the context to the audit trail,
+// before and after are the rows as stored. The caller holds the lock, so the record is written
+// together with the change.
+func (s *Storage) record(ctx context.Context, action storage.AuditAction, before, after *storage.Event) {
+	r := storage.NewAuditRecord(ctx, action, s.clock.Now(), before, after)
+	s.appendAudit(&r)
+}
+
+func (s *Storage) appendAudit(r *storage.AuditRecord) {
+	r.ID = int64(len(s.audit) + 1)
+	s.audit = append(s.audit, *r)
+}
+
+func (s *Storage) GetEventHistory(_ context.Context, eventID string) ([]storage.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]storage.AuditRecord, 0)
+	for _, r := range s.audit {
+		if r.EventID == eventID {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func (s *Storage) GetOwnerActivity(
+	_ context.Context,
+	ownerID string,
+	from, to time.Time,
+	limit int,
+) ([]storage.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]storage.AuditRecord, 0)
+	for _, r := range s.audit {
+		if r.OwnerID != ownerID || r.Time.Before(from) || (!to.IsZero() && !r.Time.Before(to)) {
+			continue
+		}
+		records = append(records, r)
+		if len(records) == limit {
+			break
+		}
+	}
+	return records, nil
+}
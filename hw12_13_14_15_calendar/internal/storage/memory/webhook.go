@@ -0,0 +1,195 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+func (s *Storage) AddWebhook(_ context.Context, w *storage.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookSeq++
+	w.ID = "webhook-" + strconv.Itoa(s.webhookSeq)
+	s.webhooks = append(s.webhooks, copyWebhook(*w))
+	return nil
+}
+
+func (s *Storage) GetWebhook(_ context.Context, id string) (storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.webhookIndex(id)
+	if !ok {
+		return storage.Webhook{}, fmt.Errorf("failed to get webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	return copyWebhook(s.webhooks[i]), nil
+}
+
+func (s *Storage) GetWebhooks(_ context.Context) ([]storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhooks := make([]storage.Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		webhooks = append(webhooks, copyWebhook(w))
+	}
+	return webhooks, nil
+}
+
+func (s *Storage) RemoveWebhook(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.webhookIndex(id)
+	if !ok {
+		return fmt.Errorf("failed to remove webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+	deliveries := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.WebhookID != id {
+			deliveries = append(deliveries, d)
+		}
+	}
+	s.deliveries = deliveries
+	return nil
+}
+
+func (s *Storage) RecordWebhookResult(
+	_ context.Context,
+	id string,
+	ok bool,
+	disableAfter int,
+	now time.Time,
+) (storage.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, found := s.webhookIndex(id)
+	if !found {
+		return storage.Webhook{}, fmt.Errorf("failed to record result of webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	w := &s.webhooks[i]
+	if ok {
+		w.Failures = 0
+	} else {
+		w.Failures++
+		if w.Failures >= disableAfter && w.DisabledAt == nil {
+			disabledAt := now.UTC()
+			w.DisabledAt = &disabledAt
+		}
+	}
+	return copyWebhook(*w), nil
+}
+
+func (s *Storage) EnableWebhook(_ context.Context, id string) (storage.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.webhookIndex(id)
+	if !ok {
+		return storage.Webhook{}, fmt.Errorf("failed to enable webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	s.webhooks[i].Failures, s.webhooks[i].DisabledAt = 0, nil
+	return copyWebhook(s.webhooks[i]), nil
+}
+
+func (s *Storage) AddWebhookDeliveries(_ context.Context, deliveries []storage.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range deliveries {
+		s.deliverySeq++
+		deliveries[i].ID = s.deliverySeq
+		s.deliveries = append(s.deliveries, deliveries[i])
+	}
+	return nil
+}
+
+func (s *Storage) ClaimWebhookDeliveries(
+	_ context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]storage.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []storage.WebhookDelivery
+	for i := range s.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		d := &s.deliveries[i]
+		if d.Status != storage.DeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		if j, ok := s.webhookIndex(d.WebhookID); !ok || s.webhooks[j].DisabledAt != nil {
+			continue
+		}
+		d.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *d)
+	}
+	return claimed, nil
+}
+
+func (s *Storage) UpdateWebhookDelivery(_ context.Context, d storage.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == d.ID {
+			s.deliveries[i] = d
+			return nil
+		}
+	}
+	// The delivery is gone with its webhook.
+	return nil
+}
+
+func (s *Storage) GetWebhookDeliveries(
+	_ context.Context,
+	webhookID string,
+	limit int,
+) ([]storage.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var deliveries []storage.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *Storage) PurgeWebhookDeliveries(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var purged int64
+	deliveries := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.Status != storage.DeliveryPending && d.UpdatedAt.Before(before) {
+			purged++
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	s.deliveries = deliveries
+	return purged, nil
+}
+
+func (s *Storage) webhookIndex(id string) (int, bool) {
+	for i, w := range s.webhooks {
+		if w.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// copyWebhook keeps the stored webhook from changes of the returned one.
+func copyWebhook(w storage.Webhook) storage.Webhook {
+	w.EventTypes = append([]storage.ChangeType(nil), w.EventTypes...)
+	if w.DisabledAt != nil {
+		disabledAt := *w.DisabledAt
+		w.DisabledAt = &disabledAt
+	}
+	return w
+}
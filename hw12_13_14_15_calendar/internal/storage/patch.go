@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidPatch = errors.New("invalid event patch")
+
+// EventPatch is a partial event update, nil fields are left untouched.
+type EventPatch struct {
+	Title         *string
+	StartTime     *time.Time
+	EndTime       *time.Time
+	Description   *string
+	OwnerID       *string
+	NotifyBefore  *int32
+	Tags          *[]string
+	Color         *string
+	Location      *Location
+	ConferenceURL *string
+	AllDay        *bool
+}
+
+// Apply returns a copy of the event with the patched fields replaced and the dates normalized.
+func (p EventPatch) Apply(e Event) Event {
+	if p.Title != nil {
+		e.Title = *p.Title
+	}
+	if p.StartTime != nil {
+		e.StartTime = *p.StartTime
+	}
+	if p.EndTime != nil {
+		e.EndTime = *p.EndTime
+	}
+	if p.Description != nil {
+		e.Description = *p.Description
+	}
+	if p.OwnerID != nil {
+		e.OwnerID = *p.OwnerID
+	}
+	if p.NotifyBefore != nil {
+		e.NotifyBefore = *p.NotifyBefore
+	}
+	if p.Tags != nil {
+		e.Tags = NormalizeTags(*p.Tags)
+	}
+	if p.Color != nil {
+		e.Color = *p.Color
+	}
+	if p.Location != nil {
+		e.Location = *p.Location
+	}
+	if p.ConferenceURL != nil {
+		e.ConferenceURL = *p.ConferenceURL
+	}
+	if p.AllDay != nil {
+		e.AllDay = *p.AllDay
+	}
+	e.NormalizeDates()
+	return e
+}
+
+// UnmarshalJSON decodes a JSON merge patch (RFC 7396), null resets a field to its zero value.
+func (p *EventPatch) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+	for name, raw := range fields {
+		var target interface{}
+		switch name {
+		case "title":
+			p.Title = new(string)
+			target = p.Title
+		case "startTime":
+			p.StartTime = new(time.Time)
+			target = p.StartTime
+		case "endTime":
+			p.EndTime = new(time.Time)
+			target = p.EndTime
+		case "description":
+			p.Description = new(string)
+			target = p.Description
+		case "ownerId":
+			p.OwnerID = new(string)
+			target = p.OwnerID
+		case "notifyBefore":
+			p.NotifyBefore = new(int32)
+			target = p.NotifyBefore
+		case "tags":
+			p.Tags = new([]string)
+			target = p.Tags
+		case "color":
+			p.Color = new(string)
+			target = p.Color
+		case "location":
+			p.Location = new(Location)
+			target = p.Location
+		case "conferenceUrl":
+			p.ConferenceURL = new(string)
+			target = p.ConferenceURL
+		case "allDay":
+			p.AllDay = new(bool)
+			target = p.AllDay
+		default:
+			return fmt.Errorf("%w: field %q cannot be patched", ErrInvalidPatch, name)
+		}
+		if string(raw) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return fmt.Errorf("%w: field %q: %s", ErrInvalidPatch, name, err.Error())
+		}
+	}
+	return nil
+}
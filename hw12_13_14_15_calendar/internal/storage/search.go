@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// SearchQuery selects active events matching all the terms in their title or description.
+type SearchQuery struct {
+	Terms []SearchTerm
+	// OwnerID limits the search to the events of the owner, empty searches events of all owners.
+	OwnerID string
+	Limit   int
+}
+
+// SearchTerm is a single word or a phrase of words following each other in the same field.
+type SearchTerm struct {
+	Words []string
+	// Prefix matches any word starting with the last word of the term.
+	Prefix bool
+}
+
+// SearchResult is the event found by the search, results with a higher rank are more relevant.
+// Ranks are only comparable within the results of the same search.
+type SearchResult struct {
+	Event Event   `json:"event"`
+	Rank  float64 `json:"rank"`
+}
+
+// ParseSearchQuery splits the text into terms. Quoted text is a phrase, as well as a word made of
+// several parts like "on-call", and a trailing asterisk turns the last word of a term into a prefix:
+//
+//	"design review" spring*
+func ParseSearchQuery(text string) []SearchTerm {
+	var terms []SearchTerm
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return terms
+		}
+		var chunk string
+		if text[0] == '"' {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				chunk, text = text[1:], ""
+			} else {
+				chunk, text = text[1:end+1], text[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(text, func(r rune) bool { return r == '"' || unicode.IsSpace(r) })
+			if end < 0 {
+				end = len(text)
+			}
+			chunk, text = text[:end], text[end:]
+		}
+		term := SearchTerm{
+			Words:  SearchWords(chunk),
+			Prefix: strings.HasSuffix(strings.TrimRightFunc(chunk, unicode.IsSpace), "*"),
+		}
+		if len(term.Words) > 0 {
+			terms = append(terms, term)
+		}
+	}
+}
+
+// SearchWords splits the text into lower case words of letters and digits.
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,98 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// attachmentList is stored in a jsonb column.
+type attachmentList []storage.Attachment
+
+func (l *attachmentList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*l = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported attachments value %T", src)
+	}
+	return json.Unmarshal(data, l)
+}
+
+func (l attachmentList) Value() (driver.Value, error) {
+	if l == nil {
+		l = attachmentList{}
+	}
+	return json.Marshal(l)
+}
+
+func (s *Storage) AddAttachment(ctx context.Context, eventID string, a storage.Attachment) (storage.Event, error) {
+	var e storage.Event
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := lockEvent(ctx, tx, eventID, 0)
+		if err != nil {
+			return fmt.Errorf("failed to attach to event with id %q: %w", eventID, err)
+		}
+		now := s.clock.Now()
+		e, err = getEvent(
+			ctx,
+			tx,
+			"UPDATE Events SET attachments=attachments || $2::jsonb, version=version+1, updated_at=$3 "+
+				"WHERE id=$1 RETURNING "+eventColumns,
+			eventID,
+			attachmentList{a},
+			now.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to attach to event with id %q: %w", eventID, err)
+		}
+		return recordAudit(ctx, tx, storage.AuditUpdated, now, &current, &e)
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
+
+func (s *Storage) RemoveAttachment(ctx context.Context, eventID, attachmentID string) (storage.Event, error) {
+	var e storage.Event
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := lockEvent(ctx, tx, eventID, 0)
+		if err == nil {
+			_, err = current.FindAttachment(attachmentID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to detach %q from event with id %q: %w", attachmentID, eventID, err)
+		}
+		now := s.clock.Now()
+		e, err = getEvent(
+			ctx,
+			tx,
+			"UPDATE Events SET attachments=("+
+				"SELECT COALESCE(jsonb_agg(a ORDER BY n), '[]'::jsonb) "+
+				"FROM jsonb_array_elements(attachments) WITH ORDINALITY AS t(a, n) WHERE a->>'id' <> $2"+
+				"), version=version+1, updated_at=$3 WHERE id=$1 RETURNING "+eventColumns,
+			eventID,
+			attachmentID,
+			now.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to detach %q from event with id %q: %w", attachmentID, eventID, err)
+		}
+		return recordAudit(ctx, tx, storage.AuditUpdated, now, &current, &e)
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
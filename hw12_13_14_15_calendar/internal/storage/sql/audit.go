@@ -0,0 +1,152 @@
+package sqlstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const auditColumns = "id, action, event_id, owner_id, actor, time, before, after"
+
+// noUpperBound replaces zero upper bound of the time range in queries.
+var noUpperBound = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type auditRow struct {
+	ID      int64     `db:"id"`
+	Action  string    `db:"action"`
+	EventID string    `db:"event_id"`
+	OwnerID string    `db:"owner_id"`
+	Actor   string    `db:"actor"`
+	Time    time.Time `db:"time"`
+	Before  []byte    `db:"before"`
+	After   []byte    `db:"after"`
+}
+
+func (s *Storage) AddAuditRecord(ctx context.Context, r *storage.AuditRecord) error {
+	return addAuditRecord(ctx, s.db, r)
+}
+
+// recordAudit appends the action made on the event by the actor of the context to the audit trail,
+// before and after are the rows as stored. It runs in the transaction of the change.
+func recordAudit(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	action storage.AuditAction,
+	now time.Time,
+	before, after *storage.Event,
+) error {
+	r := storage.NewAuditRecord(ctx, action, now, before, after)
+	return addAuditRecord(ctx, q, &r)
+}
+
+func addAuditRecord(ctx context.Context, q sqlx.QueryerContext, r *storage.AuditRecord) error {
+	before, err := marshalSnapshot(r.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalSnapshot(r.After)
+	if err != nil {
+		return err
+	}
+	err = sqlx.GetContext(
+		ctx,
+		q,
+		&r.ID,
+		"INSERT INTO event_audit(action, event_id, owner_id, actor, time, before, after) "+
+			"VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		r.Action, r.EventID, r.OwnerID, r.Actor, r.Time.UTC(), before, after,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add audit record: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetEventHistory(ctx context.Context, eventID string) ([]storage.AuditRecord, error) {
+	var rows []auditRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"SELECT "+auditColumns+" FROM event_audit WHERE event_id = $1 ORDER BY id",
+		eventID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of event %q: %w", eventID, err)
+	}
+	return toAuditRecords(rows)
+}
+
+func (s *Storage) GetOwnerActivity(
+	ctx context.Context,
+	ownerID string,
+	from, to time.Time,
+	limit int,
+) ([]storage.AuditRecord, error) {
+	if to.IsZero() {
+		to = noUpperBound
+	}
+	var rows []auditRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"SELECT "+auditColumns+" FROM event_audit "+
+			"WHERE owner_id = $1 AND time >= $2 AND time < $3 ORDER BY time, id LIMIT $4",
+		ownerID,
+		from.UTC(),
+		to.UTC(),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity of owner %q: %w", ownerID, err)
+	}
+	return toAuditRecords(rows)
+}
+
+func marshalSnapshot(e *storage.Event) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return data, nil
+}
+
+func unmarshalSnapshot(data []byte) (*storage.Event, error) {
+	if data == nil {
+		return nil, nil
+	}
+	e := &storage.Event{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	return e, nil
+}
+
+func toAuditRecords(rows []auditRow) ([]storage.AuditRecord, error) {
+	records := make([]storage.AuditRecord, 0, len(rows))
+	for _, row := range rows {
+		r := storage.AuditRecord{
+			ID:      row.ID,
+			Action:  storage.AuditAction(row.Action),
+			EventID: row.EventID,
+			OwnerID: row.OwnerID,
+			Actor:   row.Actor,
+			Time:    row.Time,
+		}
+		var err error
+		if r.Before, err = unmarshalSnapshot(row.Before); err != nil {
+			return nil, err
+		}
+		if r.After, err = unmarshalSnapshot(row.After); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
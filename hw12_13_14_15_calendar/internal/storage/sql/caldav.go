@@ -0,0 +1,45 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/lib/pq"
+)
+
+func (s *Storage) LinkCaldavName(ctx context.Context, ownerID, name, eventID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO caldav_names(owner_id, name, event_id) VALUES($1, $2, $3) "+
+			"ON CONFLICT (owner_id, name) DO UPDATE SET event_id=EXCLUDED.event_id",
+		ownerID,
+		name,
+		eventID,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == dbErrForeignKeyViolation || pqErr.Code == dbErrInvalidText) {
+		err = storage.ErrNotFoundEvent
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link %q to event %q: %w", name, eventID, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetCaldavNames(ctx context.Context, ownerID string) (map[string]string, error) {
+	var rows []struct {
+		Name    string `db:"name"`
+		EventID string `db:"event_id"`
+	}
+	err := s.db.SelectContext(ctx, &rows, "SELECT name, event_id FROM caldav_names WHERE owner_id=$1", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caldav names of owner %q: %w", ownerID, err)
+	}
+	names := make(map[string]string, len(rows))
+	for _, r := range rows {
+		names[r.Name] = r.EventID
+	}
+	return names, nil
+}
@@ -0,0 +1,203 @@
+package sqlstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/lib/pq"
+)
+
+const (
+	changesChannel = "event_changes"
+	// changesBatch limits a single catch up query of the listener.
+	changesBatch = 100
+	// changesPollInterval is how often the listener checks the connection and
+	// catches up on changes whose notifications could have been lost.
+	changesPollInterval = 30 * time.Second
+	// changesLock serializes the inserts of changes, so the ids become visible in order and
+	// readers never skip an id committed after a greater one.
+	changesLock = 7364521
+)
+
+type changeRow struct {
+	ID      int64     `db:"id"`
+	Type    string    `db:"type"`
+	EventID string    `db:"event_id"`
+	OwnerID string    `db:"owner_id"`
+	Event   []byte    `db:"event"`
+	Time    time.Time `db:"time"`
+}
+
+func (s *Storage) AddChange(ctx context.Context, c *storage.Change) error {
+	event, err := json.Marshal(c.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The lock is held until the commit, the id is taken after the previous change is committed.
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", changesLock); err != nil {
+		return fmt.Errorf("failed to lock changes: %w", err)
+	}
+	err = tx.GetContext(
+		ctx,
+		&c.Token,
+		"INSERT INTO event_changes(type, event_id, owner_id, event, time) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		c.Type, c.EventID, c.OwnerID, event, c.Time.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add change: %w", err)
+	}
+	// Other instances sharing the database pick the change up from the notification sent on commit.
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", changesChannel, fmt.Sprint(c.Token))
+	if err != nil {
+		return fmt.Errorf("failed to notify about change: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetChanges(ctx context.Context, ownerID string, after int64, limit int) ([]storage.Change, error) {
+	changes, err := s.selectChanges(ctx, ownerID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	// The purged token is read after the changes, so the ones purged meanwhile aren't missed.
+	purged, err := s.purgedToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if after < purged {
+		return nil, fmt.Errorf("%w: changes after %d were purged", storage.ErrTokenExpired, after)
+	}
+	return changes, nil
+}
+
+func (s *Storage) LastChangeToken(ctx context.Context) (int64, error) {
+	var token int64
+	err := s.db.GetContext(
+		ctx,
+		&token,
+		"SELECT COALESCE((SELECT MAX(id) FROM event_changes), (SELECT token FROM event_changes_purged), 0)",
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last change: %w", err)
+	}
+	return token, nil
+}
+
+// PurgeChanges deletes the changes and records the latest purged token in the same statement.
+func (s *Storage) PurgeChanges(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := s.db.GetContext(
+		ctx,
+		&purged,
+		"WITH purged AS (DELETE FROM event_changes WHERE time < $1 RETURNING id), "+
+			"marked AS (INSERT INTO event_changes_purged(token) SELECT MAX(id) FROM purged HAVING COUNT(*) > 0 "+
+			"ON CONFLICT (id) DO UPDATE SET token = GREATEST(event_changes_purged.token, EXCLUDED.token)) "+
+			"SELECT COUNT(*) FROM purged",
+		before.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge changes: %w", err)
+	}
+	return purged, nil
+}
+
+func (s *Storage) purgedToken(ctx context.Context) (int64, error) {
+	var token int64
+	err := s.db.GetContext(ctx, &token, "SELECT COALESCE((SELECT token FROM event_changes_purged), 0)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get purged change: %w", err)
+	}
+	return token, nil
+}
+
+// selectChanges returns the changes after the token regardless of the purged ones.
+func (s *Storage) selectChanges(ctx context.Context, ownerID string, after int64, limit int) ([]storage.Change, error) {
+	var rows []changeRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"SELECT id, type, event_id, owner_id, event, time FROM event_changes "+
+			"WHERE id > $1 AND ($2 = '' OR owner_id = $2) ORDER BY id LIMIT $3",
+		after,
+		ownerID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes: %w", err)
+	}
+	changes := make([]storage.Change, 0, len(rows))
+	for _, row := range rows {
+		c := storage.Change{
+			Token:   row.ID,
+			Type:    storage.ChangeType(row.Type),
+			EventID: row.EventID,
+			OwnerID: row.OwnerID,
+			Time:    row.Time,
+		}
+		if err := json.Unmarshal(row.Event, &c.Event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event of change %d: %w", row.ID, err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// ListenChanges delivers changes recorded by every instance using Postgres LISTEN/NOTIFY.
+// Notifications only wake the listener up, changes themselves are read from the table,
+// so nothing is lost when the listener reconnects.
+func (s *Storage) ListenChanges(ctx context.Context, fn func(storage.Change)) error {
+	last, err := s.LastChangeToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	listener := pq.NewListener(s.dsn(), time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.FromContext(ctx).Errorf("change listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(changesChannel); err != nil {
+		return fmt.Errorf("failed to listen %q: %w", changesChannel, err)
+	}
+
+	ticker := time.NewTicker(changesPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+		case <-ticker.C:
+			go func() { _ = listener.Ping() }()
+		}
+		for {
+			// The listener keeps up with the feed, the changes purged while it was disconnected are skipped.
+			changes, err := s.selectChanges(ctx, "", last, changesBatch)
+			if err != nil {
+				logger.FromContext(ctx).Errorf("failed to catch up changes: %v", err)
+				break
+			}
+			for _, c := range changes {
+				fn(c)
+				last = c.Token
+			}
+			if len(changes) < changesBatch {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// eventRow scans the columns which don't map to the fields of storage.Event directly.
+type eventRow struct {
+	storage.Event
+	TagList      pq.StringArray  `db:"tag_list"`
+	LocationName string          `db:"location_name"`
+	Latitude     sql.NullFloat64 `db:"latitude"`
+	Longitude    sql.NullFloat64 `db:"longitude"`
+	// AttachmentList is not updated by the event writes, it is changed only by the attachment methods.
+	AttachmentList attachmentList `db:"attachment_list"`
+}
+
+func (r eventRow) event() storage.Event {
+	e := r.Event
+	if len(r.TagList) > 0 {
+		e.Tags = r.TagList
+	}
+	e.Location = storage.Location{Name: r.LocationName}
+	if r.Latitude.Valid && r.Longitude.Valid {
+		e.Location.Geo = &storage.GeoPoint{Latitude: r.Latitude.Float64, Longitude: r.Longitude.Float64}
+	}
+	if len(r.AttachmentList) > 0 {
+		e.Attachments = r.AttachmentList
+	}
+	return e
+}
+
+func getEvent(ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) (storage.Event, error) {
+	var row eventRow
+	if err := sqlx.GetContext(ctx, q, &row, query, args...); err != nil {
+		return storage.Event{}, noRowsForInvalidID(err)
+	}
+	return row.event(), nil
+}
+
+// noRowsForInvalidID reports an ID which is not a UUID as sql.ErrNoRows, no event has such an ID.
+func noRowsForInvalidID(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == dbErrInvalidText {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+func selectEvents(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	query string,
+	args ...interface{},
+) ([]storage.Event, error) {
+	var rows []eventRow
+	if err := sqlx.SelectContext(ctx, q, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	events := make([]storage.Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.event())
+	}
+	return events, nil
+}
+
+// tagsValue stores the tags of the event, the column is not nullable.
+func tagsValue(tags []string) pq.StringArray {
+	if tags == nil {
+		return pq.StringArray{}
+	}
+	return tags
+}
+
+// geoValues returns the nullable latitude and longitude of the location.
+func geoValues(l storage.Location) (latitude, longitude sql.NullFloat64) {
+	if l.Geo == nil {
+		return latitude, longitude
+	}
+	return sql.NullFloat64{Float64: l.Geo.Latitude, Valid: true}, sql.NullFloat64{Float64: l.Geo.Longitude, Valid: true}
+}
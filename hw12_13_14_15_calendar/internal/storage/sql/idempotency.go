@@ -0,0 +1,113 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+type idempotencyRow struct {
+	Actor       string    `db:"actor"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	Event       []byte    `db:"event"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+func (s *Storage) AddIdempotencyRecord(
+	ctx context.Context,
+	r storage.IdempotencyRecord,
+	expiredBefore time.Time,
+) error {
+	// An expired record is replaced in place, so a taken key is reported by no affected rows.
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO idempotency_keys(actor, key, request_hash, created_at) VALUES($1, $2, $3, $4) "+
+			"ON CONFLICT (actor, key) DO UPDATE "+
+			"SET request_hash = EXCLUDED.request_hash, event = NULL, created_at = EXCLUDED.created_at "+
+			"WHERE idempotency_keys.created_at < $5",
+		r.Actor, r.Key, r.RequestHash, r.CreatedAt.UTC(), expiredBefore.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add idempotency key %q: %w", r.Key, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to add idempotency key %q: %w", r.Key, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("failed to add idempotency key %q: %w", r.Key, storage.ErrIdempotencyKeyExists)
+	}
+	return nil
+}
+
+func (s *Storage) GetIdempotencyRecord(ctx context.Context, actor, key string) (storage.IdempotencyRecord, error) {
+	var row idempotencyRow
+	err := s.db.GetContext(
+		ctx,
+		&row,
+		"SELECT actor, key, request_hash, event, created_at FROM idempotency_keys WHERE actor = $1 AND key = $2",
+		actor, key,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.IdempotencyRecord{}, fmt.Errorf(
+			"failed to get idempotency key %q: %w", key, storage.ErrNotFoundIdempotencyRecord)
+	}
+	if err != nil {
+		return storage.IdempotencyRecord{}, fmt.Errorf("failed to get idempotency key %q: %w", key, err)
+	}
+	e, err := unmarshalSnapshot(row.Event)
+	if err != nil {
+		return storage.IdempotencyRecord{}, err
+	}
+	return storage.IdempotencyRecord{
+		Key:         row.Key,
+		Actor:       row.Actor,
+		RequestHash: row.RequestHash,
+		Event:       e,
+		CreatedAt:   row.CreatedAt,
+	}, nil
+}
+
+func (s *Storage) SetIdempotencyResult(ctx context.Context, actor, key string, e storage.Event) error {
+	data, err := marshalSnapshot(&e)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE idempotency_keys SET event = $3 WHERE actor = $1 AND key = $2",
+		actor, key, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set result of idempotency key %q: %w", key, err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to set result of idempotency key %q: %w", key, storage.ErrNotFoundIdempotencyRecord)
+	}
+	return nil
+}
+
+func (s *Storage) RemoveIdempotencyRecord(ctx context.Context, actor, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE actor = $1 AND key = $2", actor, key)
+	if err != nil {
+		return fmt.Errorf("failed to remove idempotency key %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Storage) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return purged, nil
+}
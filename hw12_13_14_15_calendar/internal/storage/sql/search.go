@@ -0,0 +1,63 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// searchRow scans an event found by the search with its rank.
+type searchRow struct {
+	eventRow
+	Rank float64 `db:"rank"`
+}
+
+func (s *Storage) SearchEvents(ctx context.Context, query storage.SearchQuery) ([]storage.SearchResult, error) {
+	if len(query.Terms) == 0 {
+		return nil, storage.ErrInvalidSearchQuery
+	}
+	var limit interface{}
+	if query.Limit > 0 {
+		limit = query.Limit
+	}
+	var rows []searchRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"SELECT "+eventColumns+", ts_rank(search_vector, query) AS rank "+
+			"FROM Events, to_tsquery('simple', $1) AS query "+
+			"WHERE deleted_at IS NULL AND search_vector @@ query AND ($2 = '' OR owner_id = $2) "+
+			"ORDER BY rank DESC, start_timestamp, id LIMIT $3",
+		tsQuery(query.Terms),
+		query.OwnerID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search events: %w", err)
+	}
+	results := make([]storage.SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, storage.SearchResult{Event: row.event(), Rank: row.Rank})
+	}
+	return results, nil
+}
+
+// tsQuery formats the terms as a to_tsquery expression, the words of the terms
+// consist of letters and digits only and need no escaping.
+func tsQuery(terms []storage.SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words := make([]string, 0, len(term.Words))
+		for i, word := range term.Words {
+			lexeme := "'" + word + "'"
+			if term.Prefix && i == len(term.Words)-1 {
+				lexeme += ":*"
+			}
+			words = append(words, lexeme)
+		}
+		parts = append(parts, "("+strings.Join(words, " <-> ")+")")
+	}
+	return strings.Join(parts, " & ")
+}
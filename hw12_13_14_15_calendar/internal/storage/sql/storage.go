@@ -2,21 +2,34 @@ package sqlstorage
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/rabbit"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/util"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
-	log "github.com/sirupsen/logrus"
 )
 
 var ErrConnectionFailed = errors.New("failed to connect")
 
-const dbErrUniqueViolation = "23505"
+const (
+	dbErrUniqueViolation     = "23505"
+	dbErrForeignKeyViolation = "23503"
+	// dbErrInvalidText is returned for an ID which is not a UUID.
+	dbErrInvalidText = "22P02"
+
+	eventColumns = "id, title, start_timestamp AS startTime, end_timestamp AS endTime, description, " +
+		"notify_before AS notifyBefore, owner_id AS ownerId, version, updated_at AS updatedAt, " +
+		"deleted_at AS deletedAt, tags AS tag_list, color, location AS location_name, latitude, longitude, " +
+		"conference_url AS conferenceUrl, all_day AS allDay, attachments AS attachment_list"
+)
 
 type Config struct {
 	Host     string
@@ -24,6 +37,28 @@ type Config struct {
 	Database string
 	Username string
 	Password string
+	// SSLMode is the libpq sslmode, connections are not encrypted when it is empty.
+	SSLMode string
+	// SSLRootCert verifies the server certificate in the verify-ca and verify-full modes.
+	SSLRootCert string
+	// SSLCert and SSLKey are presented to servers which require client certificates.
+	SSLCert string
+	SSLKey  string
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.Required("host", c.Host)
+	v.Port("port", c.Port)
+	v.Required("database", c.Database)
+	v.Required("username", c.Username)
+	if c.SSLMode != "" {
+		v.OneOf("sslMode", c.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		v.Addf("sslCert", "must be set together with sslKey")
+	}
+	return v.Err()
 }
 
 type Storage struct {
@@ -32,37 +67,76 @@ type Storage struct {
 	database     string
 	username     string
 	password     string
+	sslMode      string
+	sslRootCert  string
+	sslCert      string
+	sslKey       string
 	db           *sqlx.DB
 	firstWeekDay time.Weekday
+	clock        clock.Clock
+}
+
+type Option func(*Storage)
+
+// WithClock sets the clock checking the event times and stamping the changes and the audit records,
+// the system one by default.
+func WithClock(c clock.Clock) Option {
+	return func(s *Storage) {
+		s.clock = c
+	}
 }
 
-func New(config Config) *Storage {
-	return &Storage{
+func New(config Config, opts ...Option) *Storage {
+	s := &Storage{
 		host:         config.Host,
 		port:         config.Port,
 		database:     config.Database,
 		username:     config.Username,
 		password:     config.Password,
+		sslMode:      config.SSLMode,
+		sslRootCert:  config.SSLRootCert,
+		sslCert:      config.SSLCert,
+		sslKey:       config.SSLKey,
 		firstWeekDay: time.Monday,
+		clock:        clock.Real,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Storage) Connect(ctx context.Context) error {
-	db, err := sqlx.ConnectContext(
-		ctx,
-		"postgres",
-		fmt.Sprintf(
-			"sslmode=disable host=%s port=%d dbname=%s user=%s password=%s",
-			s.host, s.port, s.database, s.username, s.password),
-	)
+	db, err := sqlx.ConnectContext(ctx, "postgres", s.dsn())
 	if err != nil {
-		log.Errorf("failed to connect: %v", err)
+		logger.FromContext(ctx).Errorf("failed to connect: %v", err)
 		return ErrConnectionFailed
 	}
 	s.db = db
 	return nil
 }
 
+func (s *Storage) dsn() string {
+	sslMode := s.sslMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf(
+		"sslmode=%s host=%s port=%d dbname=%s user=%s password=%s",
+		sslMode, s.host, s.port, s.database, s.username, s.password)
+	params := []struct{ name, value string }{
+		{"sslrootcert", s.sslRootCert},
+		{"sslcert", s.sslCert},
+		{"sslkey", s.sslKey},
+	}
+	for _, p := range params {
+		if p.value != "" {
+			dsn += fmt.Sprintf(" %s=%s", p.name, p.value)
+		}
+	}
+	return dsn
+}
+
 func (s *Storage) Close(ctx context.Context) error {
 	if err := s.db.Close(); err != nil {
 		return fmt.Errorf("failed to close connection: %w", err)
@@ -71,79 +145,385 @@ func (s *Storage) Close(ctx context.Context) error {
 }
 
 func (s *Storage) AddEvent(ctx context.Context, e *storage.Event) error {
-	if e.StartTime.Before(time.Now()) {
-		return fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := addEvent(ctx, tx, s.clock.Now(), e)
+		return err
+	})
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (int64, error) {
+	var newVersion int64
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		newVersion, err = updateEvent(ctx, tx, s.clock.Now(), id, e, version)
+		return err
+	})
+	return newVersion, err
+}
+
+// inTx runs the change and the records of its audit in a single transaction.
+func (s *Storage) inTx(ctx context.Context, apply func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := apply(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// addEvent stores the event, assigns its ID and version and returns the stored row.
+func addEvent(ctx context.Context, q sqlx.ExtContext, now time.Time, e *storage.Event) (storage.Event, error) {
+	e.NormalizeDates()
+	if e.StartsBefore(now) {
+		return storage.Event{}, fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
 	}
 	if !e.EndTime.After(e.StartTime) {
-		return fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+		return storage.Event{}, fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+	}
+	if err := e.ValidateAttributes(); err != nil {
+		return storage.Event{}, err
 	}
 
+	e.Tags = storage.NormalizeTags(e.Tags)
+	e.Attachments = nil
+	e.Version = 1
+	e.UpdatedAt = now.UTC()
+	latitude, longitude := geoValues(e.Location)
+	var row eventRow
 	var err error
 	switch e.ID {
 	case "":
-		err = s.db.GetContext(
+		err = sqlx.GetContext(
 			ctx,
-			&e.ID,
-			"INSERT INTO Events(title, start_timestamp, end_timestamp, description, notify_before, owner_id) "+
-				"VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
-			e.Title, e.StartTime.UTC(), e.EndTime.UTC(), e.Description, e.NotifyBefore, e.OwnerID)
+			q,
+			&row,
+			"INSERT INTO Events(title, start_timestamp, end_timestamp, description, notify_before, owner_id, "+
+				"version, updated_at, tags, color, location, latitude, longitude, conference_url, all_day) "+
+				"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING "+eventColumns,
+			e.Title, e.StartTime.UTC(), e.EndTime.UTC(), e.Description, e.NotifyBefore, e.OwnerID,
+			e.Version, e.UpdatedAt, tagsValue(e.Tags), e.Color, e.Location.Name, latitude, longitude, e.ConferenceURL,
+			e.AllDay)
 	default:
-		_, err = s.db.ExecContext(
+		err = sqlx.GetContext(
 			ctx,
-			"INSERT INTO Events(id, title, start_timestamp, end_timestamp, description, notify_before, owner_id) "+
-				"VALUES($1, $2, $3, $4, $5, $6, $7)",
-			e.ID, e.Title, e.StartTime.UTC(), e.EndTime.UTC(), e.Description, e.NotifyBefore, e.OwnerID)
+			q,
+			&row,
+			"INSERT INTO Events(id, title, start_timestamp, end_timestamp, description, notify_before, owner_id, "+
+				"version, updated_at, tags, color, location, latitude, longitude, conference_url, all_day) "+
+				"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING "+eventColumns,
+			e.ID, e.Title, e.StartTime.UTC(), e.EndTime.UTC(), e.Description, e.NotifyBefore, e.OwnerID,
+			e.Version, e.UpdatedAt, tagsValue(e.Tags), e.Color, e.Location.Name, latitude, longitude, e.ConferenceURL,
+			e.AllDay)
 	}
 	var pqErr *pq.Error
 	if errors.As(err, &pqErr) && pqErr.Code == dbErrUniqueViolation {
-		return fmt.Errorf("duplicate ID %q: %w", e.ID, storage.ErrDuplicateEventID)
+		return storage.Event{}, fmt.Errorf("duplicate ID %q: %w", e.ID, storage.ErrDuplicateEventID)
 	}
-
-	return err
+	if err != nil {
+		return storage.Event{}, err
+	}
+	created := row.event()
+	e.ID = created.ID
+	if err := recordAudit(ctx, q, storage.AuditCreated, now, nil, &created); err != nil {
+		return storage.Event{}, err
+	}
+	return created, nil
 }
 
-func (s *Storage) UpdateEvent(ctx context.Context, id string, e storage.Event) error {
-	if e.StartTime.Before(time.Now()) {
-		return fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
+func updateEvent(
+	ctx context.Context,
+	q sqlx.ExtContext,
+	now time.Time,
+	id string,
+	e storage.Event,
+	version int64,
+) (int64, error) {
+	e.NormalizeDates()
+	if e.StartsBefore(now) {
+		return 0, fmt.Errorf("start time of the event must be in the future: %w", storage.ErrIncorrectEventTime)
 	}
 	if !e.EndTime.After(e.StartTime) {
-		return fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+		return 0, fmt.Errorf("event end time should be after of start time: %w", storage.ErrIncorrectEventTime)
+	}
+	if err := e.ValidateAttributes(); err != nil {
+		return 0, err
 	}
 
-	var found bool
-	err := s.db.GetContext(
+	current, err := lockEvent(ctx, q, id, version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update event with id %q: %w", id, err)
+	}
+	latitude, longitude := geoValues(e.Location)
+	updated, err := getEvent(
 		ctx,
-		&found,
-		"UPDATE Events SET title=$2, start_timestamp=$3, end_timestamp=$4, description=$5, notify_before=$6 "+
-			"WHERE id=$1 RETURNING TRUE",
+		q,
+		"UPDATE Events SET title=$2, start_timestamp=$3, end_timestamp=$4, description=$5, notify_before=$6, "+
+			"version=version+1, updated_at=$7, tags=$8, color=$9, location=$10, latitude=$11, longitude=$12, "+
+			"conference_url=$13, all_day=$14 WHERE id=$1 RETURNING "+eventColumns,
 		id,
 		e.Title,
-		e.StartTime,
-		e.EndTime,
+		e.StartTime.UTC(),
+		e.EndTime.UTC(),
 		e.Description,
 		e.NotifyBefore,
+		now.UTC(),
+		tagsValue(storage.NormalizeTags(e.Tags)),
+		e.Color,
+		e.Location.Name,
+		latitude,
+		longitude,
+		e.ConferenceURL,
+		e.AllDay,
 	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update event with id %q: %w", id, err)
+	}
+	if err := recordAudit(ctx, q, storage.AuditUpdated, now, &current, &updated); err != nil {
+		return 0, err
+	}
+	return updated.Version, nil
+}
 
-	if !found {
-		return fmt.Errorf("failed to update event with id %q: %w", e.ID, storage.ErrNotFoundEvent)
+func (s *Storage) PatchEvent(
+	ctx context.Context,
+	id string,
+	patch storage.EventPatch,
+	version int64,
+) (storage.Event, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	return err
+	defer func() { _ = tx.Rollback() }()
+
+	current, err := lockEvent(ctx, tx, id, version)
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("failed to patch event with id %q: %w", id, err)
+	}
+
+	now := s.clock.Now()
+	e := patch.Apply(current)
+	if err := e.Validate(now); err != nil {
+		return storage.Event{}, err
+	}
+	latitude, longitude := geoValues(e.Location)
+	updated, err := getEvent(
+		ctx,
+		tx,
+		"UPDATE Events SET title=$2, start_timestamp=$3, end_timestamp=$4, description=$5, notify_before=$6, "+
+			"owner_id=$7, version=version+1, updated_at=$8, tags=$9, color=$10, location=$11, latitude=$12, "+
+			"longitude=$13, conference_url=$14, all_day=$15 WHERE id=$1 RETURNING "+eventColumns,
+		id,
+		e.Title,
+		e.StartTime.UTC(),
+		e.EndTime.UTC(),
+		e.Description,
+		e.NotifyBefore,
+		e.OwnerID,
+		now.UTC(),
+		tagsValue(e.Tags),
+		e.Color,
+		e.Location.Name,
+		latitude,
+		longitude,
+		e.ConferenceURL,
+		e.AllDay,
+	)
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("failed to patch event with id %q: %w", id, err)
+	}
+	if err := recordAudit(ctx, tx, storage.AuditUpdated, now, &current, &updated); err != nil {
+		return storage.Event{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return storage.Event{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
 }
 
-func (s *Storage) RemoveEvent(ctx context.Context, id string) error {
-	var found bool
-	err := s.db.GetContext(ctx, &found, "DELETE FROM Events WHERE id=$1 RETURNING TRUE", id)
+func (s *Storage) RemoveEvent(ctx context.Context, id string, version int64) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return removeEvent(ctx, tx, s.clock.Now(), id, version)
+	})
+}
 
-	if !found {
-		return fmt.Errorf("failed to remove event with id %q: %w", id, storage.ErrNotFoundEvent)
+func (s *Storage) GetEvent(ctx context.Context, id string) (storage.Event, error) {
+	e, err := getEvent(ctx, s.db, "SELECT "+eventColumns+" FROM Events WHERE id=$1 AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = storage.ErrNotFoundEvent
 	}
-	return err
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("failed to get event with id %q: %w", id, err)
+	}
+	return e, nil
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id string) (storage.Event, error) {
+	var e storage.Event
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		now := s.clock.Now()
+		var err error
+		e, err = getEvent(
+			ctx,
+			tx,
+			"UPDATE Events SET deleted_at=NULL, version=version+1, updated_at=$2 "+
+				"WHERE id=$1 AND deleted_at IS NOT NULL RETURNING "+eventColumns,
+			id,
+			now.UTC(),
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = storage.ErrNotFoundEvent
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore event with id %q: %w", id, err)
+		}
+		return recordAudit(ctx, tx, storage.AuditRestored, now, nil, &e)
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
+
+func (s *Storage) GetTrash(ctx context.Context, ownerID string) ([]storage.Event, error) {
+	return selectEvents(
+		ctx,
+		s.db,
+		"SELECT "+eventColumns+" FROM Events WHERE deleted_at IS NOT NULL AND ($1 = '' OR owner_id = $1) "+
+			"ORDER BY deleted_at DESC",
+		ownerID,
+	)
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	return s.purge(ctx, "DELETE FROM Events WHERE deleted_at < $1 RETURNING "+eventColumns, before.UTC())
+}
+
+// purge deletes the events for good and records their audit.
+func (s *Storage) purge(ctx context.Context, query string, args ...interface{}) ([]storage.Event, error) {
+	var purged []storage.Event
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if purged, err = selectEvents(ctx, tx, query, args...); err != nil {
+			return err
+		}
+		now := s.clock.Now()
+		for i := range purged {
+			if err := recordAudit(ctx, tx, storage.AuditPurged, now, &purged[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+func (s *Storage) BatchCreate(ctx context.Context, events []storage.Event) ([]storage.BatchResult, error) {
+	return s.batch(ctx, len(events), func(tx *sqlx.Tx, i int) storage.BatchResult {
+		e := events[i]
+		created, err := addEvent(ctx, tx, s.clock.Now(), &e)
+		res := storage.BatchResult{ID: e.ID, Version: e.Version, Err: err}
+		if err == nil {
+			res.Event = &created
+		}
+		return res
+	})
+}
+
+func (s *Storage) BatchUpdate(ctx context.Context, items []storage.BatchUpdateItem) ([]storage.BatchResult, error) {
+	return s.batch(ctx, len(items), func(tx *sqlx.Tx, i int) storage.BatchResult {
+		version, err := updateEvent(ctx, tx, s.clock.Now(), items[i].ID, items[i].Event, items[i].Version)
+		return storage.BatchResult{ID: items[i].ID, Version: version, Err: err}
+	})
+}
+
+func (s *Storage) BatchDelete(ctx context.Context, items []storage.BatchRemoveItem) ([]storage.BatchResult, error) {
+	return s.batch(ctx, len(items), func(tx *sqlx.Tx, i int) storage.BatchResult {
+		return storage.BatchResult{ID: items[i].ID, Err: removeEvent(ctx, tx, s.clock.Now(), items[i].ID, items[i].Version)}
+	})
+}
+
+// batch runs n items in a single transaction. Every item is wrapped into a savepoint,
+// so a failed item is rolled back without aborting the others.
+func (s *Storage) batch(
+	ctx context.Context,
+	n int,
+	apply func(tx *sqlx.Tx, i int) storage.BatchResult,
+) ([]storage.BatchResult, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	results := make([]storage.BatchResult, n)
+	for i := 0; i < n; i++ {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+			return nil, fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		results[i] = apply(tx, i)
+		if results[i].Err != nil {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				return nil, fmt.Errorf("failed to rollback to savepoint: %w", err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item"); err != nil {
+			return nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
+}
+
+func removeEvent(ctx context.Context, q sqlx.ExtContext, now time.Time, id string, version int64) error {
+	current, err := lockEvent(ctx, q, id, version)
+	if err == nil {
+		_, err = q.ExecContext(
+			ctx,
+			"UPDATE Events SET deleted_at=$2, version=version+1, updated_at=$2 WHERE id=$1",
+			id,
+			now.UTC(),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove event with id %q: %w", id, err)
+	}
+	return recordAudit(ctx, q, storage.AuditDeleted, now, &current, nil)
+}
+
+// lockEvent reads the active event for a versioned write and locks its row until the end of the transaction,
+// zero version matches any. Events in the trash are not found.
+func lockEvent(ctx context.Context, q sqlx.QueryerContext, id string, version int64) (storage.Event, error) {
+	e, err := getEvent(ctx, q, "SELECT "+eventColumns+" FROM Events WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrNotFoundEvent
+	}
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if version != 0 && e.Version != version {
+		return storage.Event{}, fmt.Errorf(
+			"expected version %d, actual %d: %w", version, e.Version, storage.ErrVersionConflict)
+	}
+	return e, nil
 }
 
 func (s *Storage) GetEventsForDay(ctx context.Context, date time.Time) ([]storage.Event, error) {
 	startTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	endTime := startTime.Add(24 * time.Hour)
-	return s.selectByRange(ctx, startTime, endTime)
+	return s.selectByRange(ctx, "", startTime, endTime)
 }
 
 func (s *Storage) GetEventsForWeek(ctx context.Context, startDate time.Time) ([]storage.Event, error) {
@@ -152,7 +532,7 @@ func (s *Storage) GetEventsForWeek(ctx context.Context, startDate time.Time) ([]
 		return nil, storage.ErrIncorrectStartDate
 	}
 	endTime := startTime.AddDate(0, 0, 7)
-	return s.selectByRange(ctx, startTime, endTime)
+	return s.selectByRange(ctx, "", startTime, endTime)
 }
 
 func (s *Storage) GetEventsForMonth(ctx context.Context, startDate time.Time) ([]storage.Event, error) {
@@ -161,7 +541,37 @@ func (s *Storage) GetEventsForMonth(ctx context.Context, startDate time.Time) ([
 		return nil, storage.ErrIncorrectStartDate
 	}
 	endTime := startTime.AddDate(0, 1, 0)
-	return s.selectByRange(ctx, startTime, endTime)
+	return s.selectByRange(ctx, "", startTime, endTime)
+}
+
+func (s *Storage) GetOwnerEvents(
+	ctx context.Context,
+	ownerID string,
+	from, to time.Time,
+) ([]storage.Event, error) {
+	if to.IsZero() {
+		to = noUpperBound
+	}
+	events, err := s.selectByRange(ctx, ownerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events of owner %q: %w", ownerID, err)
+	}
+	return events, nil
+}
+
+func (s *Storage) GetTagStats(ctx context.Context, ownerID string) ([]storage.TagCount, error) {
+	stats := make([]storage.TagCount, 0)
+	err := s.db.SelectContext(
+		ctx,
+		&stats,
+		"SELECT tag, count(*) AS count FROM Events, unnest(tags) AS tag "+
+			"WHERE deleted_at IS NULL AND ($1 = '' OR owner_id = $1) GROUP BY tag ORDER BY count DESC, tag",
+		ownerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tag stats: %w", err)
+	}
+	return stats, nil
 }
 
 func (s *Storage) GetEventsByNotifier(
@@ -169,19 +579,15 @@ func (s *Storage) GetEventsByNotifier(
 	limit int,
 	endTime time.Time,
 ) ([]storage.Event, error) {
-	var events []storage.Event
-	err := s.db.SelectContext(
+	return selectEvents(
 		ctx,
-		&events,
-		"SELECT id, title, start_timestamp AS startTime, end_timestamp AS endTime, description, "+
-			"notify_before AS notifyBefore, owner_id AS ownerId "+
-			"FROM Events WHERE notify_before > 0 AND (start_timestamp - (interval '1' day * notify_before))<=$1 "+
-			"AND NOT is_sent LIMIT $2",
+		s.db,
+		"SELECT "+eventColumns+" FROM Events "+
+			"WHERE notify_before > 0 AND (start_timestamp - (interval '1' day * notify_before))<=$1 "+
+			"AND NOT is_sent AND deleted_at IS NULL LIMIT $2",
 		endTime,
 		limit,
 	)
-
-	return events, err
 }
 
 func (s *Storage) MarkSentEvents(
@@ -191,44 +597,52 @@ func (s *Storage) MarkSentEvents(
 	if len(events) == 0 {
 		return nil
 	}
-	var found bool
-	for _, event := range events {
-		err := s.db.GetContext(
-			ctx,
-			&found,
-			"UPDATE Events SET is_sent = true WHERE id=$1 RETURNING TRUE",
-			event.ID,
-		)
-		if !found {
-			return fmt.Errorf("failed to update event with id %q: %w", event.ID, storage.ErrNotFoundEvent)
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		now := s.clock.Now()
+		for _, event := range events {
+			// Only is_sent is changed, it isn't among the event columns.
+			sent, err := getEvent(ctx, tx, "UPDATE Events SET is_sent = true WHERE id=$1 RETURNING "+eventColumns, event.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to update event with id %q: %w", event.ID, storage.ErrNotFoundEvent)
+			}
+			if err != nil {
+				return err
+			}
+			before := sent
+			sent.IsSent = true
+			if err := recordAudit(ctx, tx, storage.AuditNotified, now, &before, &sent); err != nil {
+				return err
+			}
 		}
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-func (s *Storage) RemoveAfter(ctx context.Context, time time.Time) error {
-	_, err := s.db.Exec("DELETE FROM Events WHERE start_timestamp < $1", time)
-	return err
+func (s *Storage) RemoveAfter(ctx context.Context, time time.Time) ([]storage.Event, error) {
+	return s.purge(ctx, "DELETE FROM Events WHERE start_timestamp < $1 RETURNING "+eventColumns, time)
 }
 
-// Select in range [startTime:endTime).
-func (s *Storage) selectByRange(ctx context.Context, startTime time.Time, endTime time.Time) ([]storage.Event, error) {
-	var events []storage.Event
-	err := s.db.SelectContext(
+// selectByRange returns the active events of the owner overlapping the range ordered by start time,
+// an empty owner returns events of all owners. All-day events are matched by dates as storage.Event.Overlaps does.
+func (s *Storage) selectByRange(
+	ctx context.Context,
+	ownerID string,
+	startTime time.Time,
+	endTime time.Time,
+) ([]storage.Event, error) {
+	startDate, endDate := storage.DateRange(startTime, endTime)
+	return selectEvents(
 		ctx,
-		&events,
-		"SELECT id, title, start_timestamp AS startTime, end_timestamp AS endTime, description, "+
-			"notify_before AS notifyBefore, owner_id AS ownerId "+
-			"FROM Events WHERE start_timestamp>=$1 AND end_timestamp<$2",
-		startTime,
-		endTime,
+		s.db,
+		"SELECT "+eventColumns+" FROM Events WHERE deleted_at IS NULL AND ($5 = '' OR owner_id = $5) AND "+
+			"((NOT all_day AND start_timestamp<$2 AND end_timestamp>$1) OR "+
+			"(all_day AND start_timestamp<$4 AND end_timestamp>$3)) ORDER BY start_timestamp, id",
+		startTime.UTC(),
+		endTime.UTC(),
+		startDate,
+		endDate,
+		ownerID,
 	)
-
-	return events, err
 }
 
 func (s *Storage) AddSenderLog(ctx context.Context, e *rabbit.Message) error {
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,7 +92,10 @@ func TestStorage(t *testing.T) {
 		e.Description = "updated description"
 		e.NotifyBefore = 100
 
-		require.NoError(t, s.UpdateEvent(context.Background(), e.ID, e))
+		version, err := s.UpdateEvent(context.Background(), e.ID, e, e.Version)
+		require.NoError(t, err)
+		require.Equal(t, e.Version+1, version)
+		e.Version = version
 
 		events, err := s.GetEventsForWeek(context.Background(), initDate)
 		require.NoError(t, err)
@@ -98,6 +103,96 @@ func TestStorage(t *testing.T) {
 		compareEvents(t, e, events[0])
 	})
 
+	t.Run("patch event", func(t *testing.T) {
+		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
+		e := storage.Event{
+			Title:        "test",
+			StartTime:    initDate.Add(1 * time.Hour),
+			EndTime:      initDate.Add(2 * time.Hour),
+			Description:  "description",
+			OwnerID:      "testId",
+			NotifyBefore: 1,
+		}
+		s := createStorage(t)
+		require.NoError(t, s.AddEvent(context.Background(), &e))
+
+		title := "patched title"
+		patched, err := s.PatchEvent(context.Background(), e.ID, storage.EventPatch{Title: &title}, e.Version)
+		require.NoError(t, err)
+		e.Title = title
+		e.Version++
+		compareEvents(t, e, patched)
+
+		endTime := e.StartTime
+		_, err = s.PatchEvent(context.Background(), e.ID, storage.EventPatch{EndTime: &endTime}, 0)
+		require.ErrorIs(t, err, storage.ErrIncorrectEventTime)
+
+		_, err = s.PatchEvent(context.Background(), e.ID, storage.EventPatch{Title: &title}, 1)
+		require.ErrorIs(t, err, storage.ErrVersionConflict)
+
+		events, err := s.GetEventsForDay(context.Background(), initDate)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(events))
+		compareEvents(t, e, events[0])
+	})
+
+	t.Run("get event", func(t *testing.T) {
+		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
+		e := storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: "testId"}
+		s := createStorage(t)
+		require.NoError(t, s.AddEvent(context.Background(), &e))
+
+		actual, err := s.GetEvent(context.Background(), e.ID)
+		require.NoError(t, err)
+		compareEvents(t, e, actual)
+
+		require.NoError(t, s.RemoveEvent(context.Background(), e.ID, 0))
+		_, err = s.GetEvent(context.Background(), e.ID)
+		require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
+		e := storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: "testId"}
+		invalid := storage.Event{Title: "invalid", StartTime: initDate, EndTime: initDate, OwnerID: "testId"}
+		s := createStorage(t)
+
+		results, err := s.BatchCreate(context.Background(), []storage.Event{e, invalid, e})
+		require.NoError(t, err)
+		require.Equal(t, 3, len(results))
+		require.NoError(t, results[0].Err)
+		require.Equal(t, int64(1), results[0].Version)
+		require.ErrorIs(t, results[1].Err, storage.ErrIncorrectEventTime)
+		require.NoError(t, results[2].Err)
+		stored, err := s.GetEvent(context.Background(), results[0].ID)
+		require.NoError(t, err)
+		require.Equal(t, stored, *results[0].Event)
+		require.Nil(t, results[1].Event)
+
+		e.Title = "updated"
+		results, err = s.BatchUpdate(context.Background(), []storage.BatchUpdateItem{
+			{ID: results[0].ID, Event: e, Version: 1},
+			{ID: results[2].ID, Event: e, Version: 2},
+		})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		require.Equal(t, int64(2), results[0].Version)
+		require.ErrorIs(t, results[1].Err, storage.ErrVersionConflict)
+
+		results, err = s.BatchDelete(context.Background(), []storage.BatchRemoveItem{
+			{ID: results[0].ID, Version: 2},
+			{ID: results[1].ID, Version: 2},
+		})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		require.ErrorIs(t, results[1].Err, storage.ErrVersionConflict)
+
+		events, err := s.GetEventsForDay(context.Background(), initDate)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(events))
+		require.Equal(t, "test", events[0].Title)
+	})
+
 	t.Run("delete event", func(t *testing.T) {
 		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
 		e := storage.Event{
@@ -113,7 +208,7 @@ func TestStorage(t *testing.T) {
 		s := createStorage(t)
 		require.NoError(t, s.AddEvent(context.Background(), &e))
 
-		require.NoError(t, s.RemoveEvent(context.Background(), e.ID))
+		require.NoError(t, s.RemoveEvent(context.Background(), e.ID, e.Version))
 
 		events, err := s.GetEventsForWeek(context.Background(), initDate)
 		require.NoError(t, err)
@@ -159,6 +254,587 @@ func TestStorage(t *testing.T) {
 	})
 }
 
+func TestStorageChanges(t *testing.T) {
+	s := createStorage(t)
+	for i, owner := range []string{"first", "second", "first"} {
+		c := storage.Change{
+			Type:    storage.ChangeCreated,
+			EventID: fmt.Sprint(i),
+			OwnerID: owner,
+			Event:   storage.Event{ID: fmt.Sprint(i), OwnerID: owner, Title: "test"},
+			Time:    time.Now(),
+		}
+		require.NoError(t, s.AddChange(context.Background(), &c))
+		require.NotZero(t, c.Token)
+	}
+
+	changes, err := s.GetChanges(context.Background(), "", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(changes))
+	require.Equal(t, "test", changes[0].Event.Title)
+
+	changes, err = s.GetChanges(context.Background(), "first", changes[0].Token, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(changes))
+	require.Equal(t, "2", changes[0].EventID)
+
+	changes, err = s.GetChanges(context.Background(), "", 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+}
+
+func TestStoragePurgeChanges(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+	var tokens []int64
+	for i, at := range []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Hour), now} {
+		c := storage.Change{Type: storage.ChangeCreated, EventID: fmt.Sprint(i), OwnerID: "owner", Time: at}
+		require.NoError(t, s.AddChange(ctx, &c))
+		tokens = append(tokens, c.Token)
+	}
+
+	purged, err := s.PurgeChanges(ctx, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), purged)
+	_, err = s.GetChanges(ctx, "owner", tokens[0], 10)
+	require.ErrorIs(t, err, storage.ErrTokenExpired)
+	_, err = s.GetChanges(ctx, "", 0, 10)
+	require.ErrorIs(t, err, storage.ErrTokenExpired, "the feed doesn't start with the first change anymore")
+	changes, err := s.GetChanges(ctx, "owner", tokens[1], 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, tokens[2], changes[0].Token)
+
+	purged, err = s.PurgeChanges(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+	last, err := s.LastChangeToken(ctx)
+	require.NoError(t, err)
+	require.Equal(t, tokens[2], last, "the token of the purged change is kept")
+	changes, err = s.GetChanges(ctx, "owner", last, 10)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	_, err = s.GetChanges(ctx, "owner", tokens[1], 10)
+	require.ErrorIs(t, err, storage.ErrTokenExpired)
+}
+
+func TestStorageAudit(t *testing.T) {
+	s := createStorage(t)
+	now := time.Now()
+	before := &storage.Event{ID: "1", OwnerID: "owner", Title: "before"}
+	after := &storage.Event{ID: "1", OwnerID: "owner", Title: "after"}
+	records := []storage.AuditRecord{
+		{Action: storage.AuditCreated, EventID: "1", OwnerID: "owner", Actor: "user", Time: now, After: before},
+		{Action: storage.AuditCreated, EventID: "2", OwnerID: "other", Actor: "user", Time: now},
+		{
+			Action: storage.AuditUpdated, EventID: "1", OwnerID: "owner", Actor: "user",
+			Time: now.Add(time.Hour), Before: before, After: after,
+		},
+		{
+			Action: storage.AuditDeleted, EventID: "1", OwnerID: "owner", Actor: "admin",
+			Time: now.Add(2 * time.Hour), Before: after,
+		},
+	}
+	for i := range records {
+		require.NoError(t, s.AddAuditRecord(context.Background(), &records[i]))
+		require.NotZero(t, records[i].ID)
+	}
+
+	history, err := s.GetEventHistory(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(history))
+	require.Equal(t, storage.AuditCreated, history[0].Action)
+	require.Nil(t, history[0].Before)
+	require.Equal(t, "before", history[1].Before.Title)
+	require.Equal(t, "after", history[1].After.Title)
+	require.Equal(t, "admin", history[2].Actor)
+	require.Nil(t, history[2].After)
+
+	activity, err := s.GetOwnerActivity(context.Background(), "owner", now.Add(time.Minute), time.Time{}, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(activity))
+	require.Equal(t, storage.AuditUpdated, activity[0].Action)
+
+	activity, err = s.GetOwnerActivity(context.Background(), "owner", now, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(activity))
+	require.Equal(t, storage.AuditCreated, activity[0].Action)
+}
+
+func TestStorageAuditMutations(t *testing.T) {
+	s := createStorage(t)
+	ctx := storage.WithActor(context.Background(), "user")
+	initDate := time.Now().Add(time.Hour)
+	e := storage.Event{Title: "before", OwnerID: "owner", StartTime: initDate, EndTime: initDate.Add(time.Hour)}
+	require.NoError(t, s.AddEvent(ctx, &e))
+	e.Title = "after"
+	_, err := s.UpdateEvent(ctx, e.ID, e, 0)
+	require.NoError(t, err)
+	_, err = s.UpdateEvent(ctx, e.ID, e, 1)
+	require.ErrorIs(t, err, storage.ErrVersionConflict)
+	require.NoError(t, s.RemoveEvent(context.Background(), e.ID, 0))
+
+	history, err := s.GetEventHistory(context.Background(), e.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(history), "the failed update is not recorded")
+	require.Equal(t, storage.AuditCreated, history[0].Action)
+	require.Equal(t, "user", history[0].Actor)
+	require.Equal(t, "owner", history[0].OwnerID)
+	require.Nil(t, history[0].Before)
+	require.Equal(t, int64(1), history[0].After.Version)
+	require.Equal(t, storage.AuditUpdated, history[1].Action)
+	require.Equal(t, "before", history[1].Before.Title)
+	require.Equal(t, "after", history[1].After.Title)
+	require.Equal(t, int64(2), history[1].After.Version)
+	require.Equal(t, storage.AuditDeleted, history[2].Action)
+	require.Equal(t, storage.AnonymousActor, history[2].Actor)
+	require.Equal(t, int64(2), history[2].Before.Version)
+	require.Nil(t, history[2].After)
+}
+
+func TestStorageTrash(t *testing.T) {
+	s := createStorage(t)
+	initDate := time.Now().Add(time.Hour)
+	e := storage.Event{OwnerID: "owner", StartTime: initDate, EndTime: initDate.Add(time.Hour)}
+	require.NoError(t, s.AddEvent(context.Background(), &e))
+	require.NoError(t, s.RemoveEvent(context.Background(), e.ID, e.Version))
+
+	_, err := s.GetEvent(context.Background(), e.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	events, err := s.GetEventsForDay(context.Background(), initDate)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(events))
+	_, err = s.UpdateEvent(context.Background(), e.ID, e, 0)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	require.ErrorIs(t, s.RemoveEvent(context.Background(), e.ID, 0), storage.ErrNotFoundEvent)
+	require.ErrorIs(t, s.AddEvent(context.Background(), &e), storage.ErrDuplicateEventID)
+
+	trash, err := s.GetTrash(context.Background(), "owner")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(trash))
+	require.NotNil(t, trash[0].DeletedAt)
+	trash, err = s.GetTrash(context.Background(), "other")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(trash))
+
+	restored, err := s.RestoreEvent(context.Background(), e.ID)
+	require.NoError(t, err)
+	require.Nil(t, restored.DeletedAt)
+	require.Equal(t, int64(3), restored.Version)
+	_, err = s.RestoreEvent(context.Background(), e.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	_, err = s.GetEvent(context.Background(), e.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, s.RemoveEvent(context.Background(), e.ID, 0))
+	purged, err := s.PurgeTrash(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(purged))
+	purged, err = s.PurgeTrash(context.Background(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(purged))
+	_, err = s.RestoreEvent(context.Background(), e.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+}
+
+func TestStorageAttributes(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	initDate := time.Now().Add(time.Hour)
+	e := storage.Event{
+		OwnerID: "owner", Title: "on-call", StartTime: initDate, EndTime: initDate.Add(time.Hour),
+		Tags:          []string{" On-Call", "ops", "on-call"},
+		Color:         "#ff8800",
+		Location:      storage.Location{Name: "Room 1", Geo: &storage.GeoPoint{Latitude: 55.75, Longitude: 37.62}},
+		ConferenceURL: "https://meet.example.com/on-call",
+	}
+	require.NoError(t, s.AddEvent(ctx, &e))
+	require.Equal(t, []string{"on-call", "ops"}, e.Tags)
+	other := storage.Event{
+		OwnerID: "other", StartTime: initDate, EndTime: initDate.Add(time.Hour), Tags: []string{"ops"},
+	}
+	require.NoError(t, s.AddEvent(ctx, &other))
+
+	stored, err := s.GetEvent(ctx, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, e.Tags, stored.Tags)
+	require.Equal(t, e.Color, stored.Color)
+	require.Equal(t, e.Location, stored.Location)
+	require.Equal(t, e.ConferenceURL, stored.ConferenceURL)
+	stored, err = s.GetEvent(ctx, other.ID)
+	require.NoError(t, err)
+	require.Nil(t, stored.Location.Geo)
+
+	stats, err := s.GetTagStats(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []storage.TagCount{{Tag: "ops", Count: 2}, {Tag: "on-call", Count: 1}}, stats)
+	stats, err = s.GetTagStats(ctx, "other")
+	require.NoError(t, err)
+	require.Equal(t, []storage.TagCount{{Tag: "ops", Count: 1}}, stats)
+
+	tags := []string{"Ops"}
+	patched, err := s.PatchEvent(ctx, e.ID, storage.EventPatch{Tags: &tags, Location: &storage.Location{}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ops"}, patched.Tags)
+	require.Equal(t, storage.Location{}, patched.Location)
+
+	invalid := []storage.Event{
+		{Color: "orange"},
+		{Location: storage.Location{Geo: &storage.GeoPoint{Latitude: 91}}},
+		{ConferenceURL: "meet.example.com"},
+		{Tags: []string{strings.Repeat("t", 65)}},
+	}
+	for _, e := range invalid {
+		e.StartTime, e.EndTime = initDate, initDate.Add(time.Hour)
+		require.ErrorIs(t, s.AddEvent(ctx, &e), storage.ErrInvalidEvent)
+		_, err := s.UpdateEvent(ctx, other.ID, e, 0)
+		require.ErrorIs(t, err, storage.ErrInvalidEvent)
+	}
+}
+
+func TestStorageAllDay(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day()+10, 0, 0, 0, 0, time.UTC)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+	// inZone returns the midnight of the same date in the zone.
+	inZone := func(date time.Time, loc *time.Location) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	}
+
+	// The conference takes three days and is not shown only on its first day.
+	conference := storage.Event{
+		OwnerID: "owner", Title: "conference",
+		StartTime: day.Add(10 * time.Hour), EndTime: day.AddDate(0, 0, 2).Add(18 * time.Hour),
+	}
+	require.NoError(t, s.AddEvent(ctx, &conference))
+	// The holiday is given in the Moscow time and takes the same date everywhere.
+	holiday := storage.Event{
+		OwnerID: "owner", Title: "holiday", AllDay: true,
+		StartTime: inZone(day.AddDate(0, 0, 1), moscow),
+	}
+	require.NoError(t, s.AddEvent(ctx, &holiday))
+	require.Equal(t, day.AddDate(0, 0, 1), holiday.StartTime)
+	require.Equal(t, day.AddDate(0, 0, 2), holiday.EndTime)
+
+	titles := func(date time.Time) []string {
+		events, err := s.GetEventsForDay(ctx, date)
+		require.NoError(t, err)
+		result := make([]string, 0, len(events))
+		for _, e := range events {
+			result = append(result, e.Title)
+		}
+		sort.Strings(result)
+		return result
+	}
+	require.Equal(t, []string{"conference"}, titles(day))
+	require.Equal(t, []string{"conference", "holiday"}, titles(holiday.StartTime))
+	require.Equal(t, []string{"conference", "holiday"}, titles(inZone(holiday.StartTime, moscow)))
+	require.Equal(t, []string{"conference", "holiday"}, titles(inZone(holiday.StartTime, newYork)))
+	require.Equal(t, []string{"conference"}, titles(day.AddDate(0, 0, 2)))
+	require.Empty(t, titles(day.AddDate(0, 0, 3)))
+
+	events, err := s.GetEventsForMonth(ctx, time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+
+	allDay := true
+	patched, err := s.PatchEvent(ctx, conference.ID, storage.EventPatch{AllDay: &allDay}, 0)
+	require.NoError(t, err)
+	require.Equal(t, day, patched.StartTime)
+	require.Equal(t, day.AddDate(0, 0, 3), patched.EndTime)
+
+	today := storage.Event{OwnerID: "owner", Title: "today", AllDay: true, StartTime: now}
+	require.NoError(t, s.AddEvent(ctx, &today))
+	past := storage.Event{OwnerID: "owner", Title: "past", AllDay: true, StartTime: now.AddDate(0, 0, -2)}
+	require.ErrorIs(t, s.AddEvent(ctx, &past), storage.ErrIncorrectEventTime)
+}
+
+func TestStorageOwnerEvents(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day()+10, 0, 0, 0, 0, time.UTC)
+	add := func(owner, title string, start time.Time, allDay bool) storage.Event {
+		e := storage.Event{
+			OwnerID: owner, Title: title, AllDay: allDay, StartTime: start, EndTime: start.Add(time.Hour),
+		}
+		require.NoError(t, s.AddEvent(ctx, &e))
+		return e
+	}
+	later := add("events owner", "later", day.AddDate(0, 0, 2).Add(10*time.Hour), false)
+	first := add("events owner", "first", day.Add(10*time.Hour), false)
+	holiday := add("events owner", "holiday", day.AddDate(0, 0, 1), true)
+	add("other owner", "other", day.Add(10*time.Hour), false)
+	removed := add("events owner", "removed", day.Add(12*time.Hour), false)
+	require.NoError(t, s.RemoveEvent(ctx, removed.ID, 0))
+
+	titles := func(from, to time.Time) []string {
+		events, err := s.GetOwnerEvents(ctx, "events owner", from, to)
+		require.NoError(t, err)
+		result := make([]string, 0, len(events))
+		for _, e := range events {
+			result = append(result, e.Title)
+		}
+		return result
+	}
+	require.Equal(t, []string{first.Title, holiday.Title, later.Title}, titles(time.Time{}, time.Time{}))
+	require.Equal(t, []string{first.Title}, titles(day, first.EndTime))
+	require.Equal(t, []string{holiday.Title, later.Title}, titles(first.EndTime, time.Time{}))
+	require.Empty(t, titles(later.EndTime, time.Time{}))
+}
+
+func TestStorageAttachments(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	initDate := time.Now().Add(time.Hour)
+	e := storage.Event{OwnerID: "owner", Title: "review", StartTime: initDate, EndTime: initDate.Add(time.Hour)}
+	require.NoError(t, s.AddEvent(ctx, &e))
+
+	createdAt := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	agenda := storage.Attachment{ID: "a1", Name: "agenda.txt", ContentType: "text/plain", Size: 15, CreatedAt: createdAt}
+	slides := storage.Attachment{
+		ID: "a2", Name: "slides.pdf", ContentType: "application/pdf", Size: 1024, CreatedAt: createdAt,
+	}
+	for _, a := range []storage.Attachment{agenda, slides} {
+		_, err := s.AddAttachment(ctx, e.ID, a)
+		require.NoError(t, err)
+	}
+	_, err := s.UpdateEvent(ctx, e.ID, e, 0)
+	require.NoError(t, err)
+	title := "design review"
+	_, err = s.PatchEvent(ctx, e.ID, storage.EventPatch{Title: &title}, 0)
+	require.NoError(t, err)
+
+	updated, err := s.RemoveAttachment(ctx, e.ID, agenda.ID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Attachment{slides}, updated.Attachments)
+	require.Equal(t, int64(6), updated.Version)
+	stored, err := s.GetEvent(ctx, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated.Attachments, stored.Attachments)
+
+	_, err = s.RemoveAttachment(ctx, e.ID, agenda.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundAttachment)
+	require.NoError(t, s.RemoveEvent(ctx, e.ID, 0))
+	_, err = s.AddAttachment(ctx, e.ID, agenda)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	_, err = s.RemoveAttachment(ctx, e.ID, slides.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+}
+
+func TestStorageCaldavNames(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	initDate := time.Now().Add(time.Hour)
+	first := storage.Event{OwnerID: "owner", StartTime: initDate, EndTime: initDate.Add(time.Hour)}
+	second := first
+	require.NoError(t, s.AddEvent(ctx, &first))
+	require.NoError(t, s.AddEvent(ctx, &second))
+
+	_, err := s.GetEvent(ctx, "meeting-1")
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent, "a resource name is not an event ID")
+	_, err = s.UpdateEvent(ctx, "meeting-1", first, 0)
+	require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	require.ErrorIs(t, s.RemoveEvent(ctx, "meeting-1", 0), storage.ErrNotFoundEvent)
+	require.ErrorIs(t, s.LinkCaldavName(ctx, "owner", "meeting-1", "meeting-1"), storage.ErrNotFoundEvent)
+
+	require.NoError(t, s.LinkCaldavName(ctx, "owner", "meeting-1", first.ID))
+	require.NoError(t, s.LinkCaldavName(ctx, "owner", "Meeting-2", second.ID))
+	names, err := s.GetCaldavNames(ctx, "owner")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"meeting-1": first.ID, "Meeting-2": second.ID}, names)
+	names, err = s.GetCaldavNames(ctx, "other")
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	require.NoError(t, s.LinkCaldavName(ctx, "owner", "meeting-1", second.ID))
+	require.NoError(t, s.RemoveEvent(ctx, second.ID, 0))
+	names, err = s.GetCaldavNames(ctx, "owner")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"meeting-1": second.ID, "Meeting-2": second.ID}, names,
+		"the names of the events in the trash are kept")
+	_, err = s.PurgeTrash(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	names, err = s.GetCaldavNames(ctx, "owner")
+	require.NoError(t, err)
+	require.Empty(t, names, "the names of the purged events are dropped")
+}
+
+func TestStorageWebhooks(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	hr := storage.Webhook{URL: "https://hr.example.com/hook", Secret: "s1", CreatedAt: now}
+	tickets := storage.Webhook{
+		URL:        "https://tickets.example.com/hook",
+		EventTypes: []storage.ChangeType{storage.ChangeCreated, storage.ChangeDeleted},
+		OwnerID:    "owner",
+		Secret:     "s2",
+		CreatedAt:  now.Add(time.Second),
+	}
+	for _, w := range []*storage.Webhook{&hr, &tickets} {
+		require.NoError(t, s.AddWebhook(ctx, w))
+		require.NotEmpty(t, w.ID)
+	}
+	webhooks, err := s.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	require.Equal(t, hr.ID, webhooks[0].ID)
+	require.Equal(t, tickets.EventTypes, webhooks[1].EventTypes)
+	require.Equal(t, "s2", webhooks[1].Secret)
+
+	deliveries := make([]storage.WebhookDelivery, 0, 3)
+	for token := int64(1); token <= 3; token++ {
+		deliveries = append(deliveries, storage.WebhookDelivery{
+			WebhookID:     hr.ID,
+			Token:         token,
+			Type:          storage.ChangeUpdated,
+			Payload:       []byte(`{"token":1}`),
+			Status:        storage.DeliveryPending,
+			NextAttemptAt: now.Add(time.Duration(token-1) * time.Minute),
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	require.NoError(t, s.AddWebhookDeliveries(ctx, deliveries))
+	claimed, err := s.ClaimWebhookDeliveries(ctx, now.Add(time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2, "the third delivery is not due")
+	require.Equal(t, deliveries[0].ID, claimed[0].ID)
+	require.JSONEq(t, `{"token":1}`, string(claimed[0].Payload))
+	claimed, err = s.ClaimWebhookDeliveries(ctx, now.Add(time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed, "the claimed deliveries are leased")
+
+	d := deliveries[0]
+	d.Status, d.Attempts, d.ResponseStatus, d.UpdatedAt = storage.DeliveryDelivered, 1, 200, now.Add(time.Minute)
+	require.NoError(t, s.UpdateWebhookDelivery(ctx, d))
+	logged, err := s.GetWebhookDeliveries(ctx, hr.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, logged, 2)
+	require.Equal(t, deliveries[2].ID, logged[0].ID, "the latest deliveries go first")
+
+	w, err := s.RecordWebhookResult(ctx, hr.ID, false, 2, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, w.Failures)
+	require.Nil(t, w.DisabledAt)
+	w, err = s.RecordWebhookResult(ctx, hr.ID, false, 2, now)
+	require.NoError(t, err)
+	require.Equal(t, 2, w.Failures)
+	require.NotNil(t, w.DisabledAt)
+	claimed, err = s.ClaimWebhookDeliveries(ctx, now.Add(time.Hour), time.Minute, 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed, "the deliveries of disabled webhooks are not claimed")
+	w, err = s.EnableWebhook(ctx, hr.ID)
+	require.NoError(t, err)
+	require.Zero(t, w.Failures)
+	require.Nil(t, w.DisabledAt)
+	w, err = s.RecordWebhookResult(ctx, hr.ID, true, 2, now)
+	require.NoError(t, err)
+	require.Zero(t, w.Failures)
+
+	purged, err := s.PurgeWebhookDeliveries(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged, "only the finished deliveries are purged")
+	require.NoError(t, s.RemoveWebhook(ctx, hr.ID))
+	logged, err = s.GetWebhookDeliveries(ctx, hr.ID, 10)
+	require.NoError(t, err)
+	require.Empty(t, logged, "the deliveries are removed with the webhook")
+	_, err = s.GetWebhook(ctx, hr.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundWebhook)
+	require.ErrorIs(t, s.RemoveWebhook(ctx, hr.ID), storage.ErrNotFoundWebhook)
+	_, err = s.EnableWebhook(ctx, hr.ID)
+	require.ErrorIs(t, err, storage.ErrNotFoundWebhook)
+}
+
+func TestStorageSearch(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	initDate := time.Now().Add(time.Hour)
+	events := []storage.Event{
+		{OwnerID: "alice", Title: "Design review", Description: "Review of the spring release design"},
+		{OwnerID: "alice", Title: "Sprint planning", Description: "Design tasks are reviewed, then the review is closed"},
+		{OwnerID: "bob", Title: "Design review", Description: "On-call handover"},
+		{OwnerID: "bob", Title: "Lunch", Description: "Review the menu"},
+	}
+	for i := range events {
+		events[i].StartTime, events[i].EndTime = initDate, initDate.Add(time.Hour)
+		require.NoError(t, s.AddEvent(ctx, &events[i]))
+	}
+	search := func(text, ownerID string, limit int) []string {
+		results, err := s.SearchEvents(ctx, storage.SearchQuery{
+			Terms: storage.ParseSearchQuery(text), OwnerID: ownerID, Limit: limit,
+		})
+		require.NoError(t, err)
+		ids := make([]string, 0, len(results))
+		for _, r := range results {
+			ids = append(ids, r.Event.ID)
+		}
+		return ids
+	}
+
+	// The title weighs more than the description.
+	require.Equal(t, []string{events[0].ID, events[2].ID, events[1].ID}, search("design", "", 0))
+	require.ElementsMatch(t, []string{events[0].ID, events[2].ID}, search(`"design review"`, "", 0))
+	require.ElementsMatch(t, []string{events[0].ID, events[1].ID}, search("design spr*", "", 0))
+	require.ElementsMatch(t, []string{events[0].ID, events[1].ID}, search("review", "alice", 0))
+	require.Equal(t, []string{events[2].ID}, search("on-call", "", 0))
+	require.Equal(t, []string{events[0].ID}, search("design", "", 1))
+	require.Empty(t, search("standup", "", 0))
+
+	title := "Retrospective"
+	_, err := s.PatchEvent(ctx, events[0].ID, storage.EventPatch{Title: &title}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{events[2].ID}, search(`"design review"`, "", 0))
+	require.NoError(t, s.RemoveEvent(ctx, events[2].ID, 0))
+	require.Empty(t, search(`"design review"`, "", 0))
+	require.Equal(t, []string{events[0].ID}, search("retro*", "", 0))
+}
+
+func TestStorageIdempotency(t *testing.T) {
+	s := createStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+	r := storage.IdempotencyRecord{Key: "key", Actor: "user", RequestHash: "hash", CreatedAt: now}
+	require.NoError(t, s.AddIdempotencyRecord(ctx, r, now.Add(-time.Hour)))
+	require.ErrorIs(t, s.AddIdempotencyRecord(ctx, r, now.Add(-time.Hour)), storage.ErrIdempotencyKeyExists)
+	other := r
+	other.Actor = "other"
+	require.NoError(t, s.AddIdempotencyRecord(ctx, other, now.Add(-time.Hour)))
+
+	got, err := s.GetIdempotencyRecord(ctx, "user", "key")
+	require.NoError(t, err)
+	require.Equal(t, "hash", got.RequestHash)
+	require.Nil(t, got.Event)
+	require.NoError(t, s.SetIdempotencyResult(ctx, "user", "key", storage.Event{ID: "1", Title: "created"}))
+	got, err = s.GetIdempotencyRecord(ctx, "user", "key")
+	require.NoError(t, err)
+	require.Equal(t, "created", got.Event.Title)
+	err = s.SetIdempotencyResult(ctx, "user", "missing", storage.Event{})
+	require.ErrorIs(t, err, storage.ErrNotFoundIdempotencyRecord)
+
+	// An expired record is replaced by the new request.
+	r.RequestHash, r.CreatedAt = "new hash", now.Add(time.Minute)
+	require.NoError(t, s.AddIdempotencyRecord(ctx, r, now.Add(time.Second)))
+	got, err = s.GetIdempotencyRecord(ctx, "user", "key")
+	require.NoError(t, err)
+	require.Equal(t, "new hash", got.RequestHash)
+	require.Nil(t, got.Event)
+
+	require.NoError(t, s.RemoveIdempotencyRecord(ctx, "user", "key"))
+	_, err = s.GetIdempotencyRecord(ctx, "user", "key")
+	require.ErrorIs(t, err, storage.ErrNotFoundIdempotencyRecord)
+	purged, err := s.PurgeIdempotencyRecords(ctx, now.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+	_, err = s.GetIdempotencyRecord(ctx, "other", "key")
+	require.ErrorIs(t, err, storage.ErrNotFoundIdempotencyRecord)
+}
+
 func TestStorageNegativeCases(t *testing.T) {
 	t.Run("add event with same id", func(t *testing.T) {
 		initDate := time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -182,14 +858,37 @@ func TestStorageNegativeCases(t *testing.T) {
 		e := storage.Event{ID: "___not_exists___", StartTime: initDate, EndTime: initDate.Add(time.Hour)}
 		s := createStorage(t)
 
-		require.ErrorIs(t, s.UpdateEvent(context.Background(), e.ID, e), storage.ErrNotFoundEvent)
+		_, err := s.UpdateEvent(context.Background(), e.ID, e, 0)
+		require.ErrorIs(t, err, storage.ErrNotFoundEvent)
+	})
+
+	t.Run("update with stale version", func(t *testing.T) {
+		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
+		e := storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: "testId"}
+		s := createStorage(t)
+		require.NoError(t, s.AddEvent(context.Background(), &e))
+
+		_, err := s.UpdateEvent(context.Background(), e.ID, e, e.Version)
+		require.NoError(t, err)
+		_, err = s.UpdateEvent(context.Background(), e.ID, e, e.Version)
+		require.ErrorIs(t, err, storage.ErrVersionConflict)
+	})
+
+	t.Run("delete with stale version", func(t *testing.T) {
+		initDate := time.Date(2300, 01, 01, 0, 0, 0, 0, time.UTC)
+		e := storage.Event{Title: "test", StartTime: initDate, EndTime: initDate.Add(time.Hour), OwnerID: "testId"}
+		s := createStorage(t)
+		require.NoError(t, s.AddEvent(context.Background(), &e))
+
+		require.ErrorIs(t, s.RemoveEvent(context.Background(), e.ID, e.Version+1), storage.ErrVersionConflict)
+		require.NoError(t, s.RemoveEvent(context.Background(), e.ID, e.Version))
 	})
 
 	t.Run("delete not exist event event", func(t *testing.T) {
 		e := storage.Event{ID: "___not_exists___"}
 		s := createStorage(t)
 
-		require.ErrorIs(t, s.RemoveEvent(context.Background(), e.ID), storage.ErrNotFoundEvent)
+		require.ErrorIs(t, s.RemoveEvent(context.Background(), e.ID, 0), storage.ErrNotFoundEvent)
 	})
 
 	t.Run("old event time for insert", func(t *testing.T) {
@@ -205,7 +904,8 @@ func TestStorageNegativeCases(t *testing.T) {
 		e := storage.Event{StartTime: initDate.Add(time.Hour), EndTime: initDate}
 		s := createStorage(t)
 
-		require.ErrorIs(t, s.UpdateEvent(context.Background(), e.ID, e), storage.ErrIncorrectEventTime)
+		_, err := s.UpdateEvent(context.Background(), e.ID, e, 0)
+		require.ErrorIs(t, err, storage.ErrIncorrectEventTime)
 	})
 
 	t.Run("incorrect event time for insert", func(t *testing.T) {
@@ -221,7 +921,8 @@ func TestStorageNegativeCases(t *testing.T) {
 		e := storage.Event{StartTime: initDate.Add(time.Hour), EndTime: initDate}
 		s := createStorage(t)
 
-		require.ErrorIs(t, s.UpdateEvent(context.Background(), e.ID, e), storage.ErrIncorrectEventTime)
+		_, err := s.UpdateEvent(context.Background(), e.ID, e, 0)
+		require.ErrorIs(t, err, storage.ErrIncorrectEventTime)
 	})
 }
 
@@ -296,10 +997,23 @@ func cleanupDb() error {
 	}
 	defer db.Close()
 
-	_, err = db.Exec("TRUNCATE TABLE Events")
+	_, err = db.Exec("TRUNCATE TABLE Events CASCADE")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("TRUNCATE TABLE event_changes, event_changes_purged")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("TRUNCATE TABLE event_audit")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("TRUNCATE TABLE idempotency_keys")
 	if err != nil {
 		return err
 	}
+	_, err = db.Exec("TRUNCATE TABLE webhooks CASCADE")
 	return err
 }
 
@@ -309,6 +1023,7 @@ func compareEvents(t *testing.T, expected storage.Event, actual storage.Event) {
 	require.True(t, expected.StartTime.Equal(actual.StartTime), "start time is not equals %q != %q", expected.StartTime, actual.StartTime)
 	expected.StartTime = actual.StartTime
 	expected.EndTime = actual.EndTime
+	expected.UpdatedAt = actual.UpdatedAt
 	require.Equal(t, expected, actual)
 }
 
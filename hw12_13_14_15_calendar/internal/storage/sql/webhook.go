@@ -0,0 +1,292 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	webhookColumns  = "id, url, event_types, owner_id, secret, failures, disabled_at, created_at"
+	deliveryColumns = "id, webhook_id, token, type, payload, status, attempts, next_attempt_at, response_status, " +
+		"error, created_at, updated_at"
+)
+
+type webhookRow struct {
+	ID         string         `db:"id"`
+	URL        string         `db:"url"`
+	EventTypes pq.StringArray `db:"event_types"`
+	OwnerID    string         `db:"owner_id"`
+	Secret     string         `db:"secret"`
+	Failures   int            `db:"failures"`
+	DisabledAt *time.Time     `db:"disabled_at"`
+	CreatedAt  time.Time      `db:"created_at"`
+}
+
+func (row webhookRow) webhook() storage.Webhook {
+	w := storage.Webhook{
+		ID:         row.ID,
+		URL:        row.URL,
+		OwnerID:    row.OwnerID,
+		Secret:     row.Secret,
+		Failures:   row.Failures,
+		DisabledAt: row.DisabledAt,
+		CreatedAt:  row.CreatedAt,
+	}
+	for _, t := range row.EventTypes {
+		w.EventTypes = append(w.EventTypes, storage.ChangeType(t))
+	}
+	return w
+}
+
+type deliveryRow struct {
+	ID             int64     `db:"id"`
+	WebhookID      string    `db:"webhook_id"`
+	Token          int64     `db:"token"`
+	Type           string    `db:"type"`
+	Payload        []byte    `db:"payload"`
+	Status         string    `db:"status"`
+	Attempts       int       `db:"attempts"`
+	NextAttemptAt  time.Time `db:"next_attempt_at"`
+	ResponseStatus int       `db:"response_status"`
+	Error          string    `db:"error"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+func (row deliveryRow) delivery() storage.WebhookDelivery {
+	return storage.WebhookDelivery{
+		ID:             row.ID,
+		WebhookID:      row.WebhookID,
+		Token:          row.Token,
+		Type:           storage.ChangeType(row.Type),
+		Payload:        row.Payload,
+		Status:         storage.DeliveryStatus(row.Status),
+		Attempts:       row.Attempts,
+		NextAttemptAt:  row.NextAttemptAt,
+		ResponseStatus: row.ResponseStatus,
+		Error:          row.Error,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+	}
+}
+
+func (s *Storage) AddWebhook(ctx context.Context, w *storage.Webhook) error {
+	types := make(pq.StringArray, 0, len(w.EventTypes))
+	for _, t := range w.EventTypes {
+		types = append(types, string(t))
+	}
+	err := s.db.GetContext(
+		ctx,
+		&w.ID,
+		"INSERT INTO webhooks(url, event_types, owner_id, secret, created_at) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		w.URL, types, w.OwnerID, w.Secret, w.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, id string) (storage.Webhook, error) {
+	var row webhookRow
+	err := s.db.GetContext(ctx, &row, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Webhook{}, fmt.Errorf("failed to get webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	if err != nil {
+		return storage.Webhook{}, fmt.Errorf("failed to get webhook %q: %w", id, err)
+	}
+	return row.webhook(), nil
+}
+
+func (s *Storage) GetWebhooks(ctx context.Context) ([]storage.Webhook, error) {
+	var rows []webhookRow
+	err := s.db.SelectContext(ctx, &rows, "SELECT "+webhookColumns+" FROM webhooks ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	webhooks := make([]storage.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhooks = append(webhooks, row.webhook())
+	}
+	return webhooks, nil
+}
+
+func (s *Storage) RemoveWebhook(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to remove webhook %q: %w", id, err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to remove webhook %q: %w", id, storage.ErrNotFoundWebhook)
+	}
+	return nil
+}
+
+func (s *Storage) RecordWebhookResult(
+	ctx context.Context,
+	id string,
+	ok bool,
+	disableAfter int,
+	now time.Time,
+) (storage.Webhook, error) {
+	return s.updateWebhook(
+		ctx,
+		id,
+		"failed to record result of webhook %q: %w",
+		"UPDATE webhooks SET failures = CASE WHEN $2 THEN 0 ELSE failures + 1 END, "+
+			"disabled_at = CASE WHEN NOT $2 AND failures + 1 >= $3 AND disabled_at IS NULL THEN $4 ELSE disabled_at END "+
+			"WHERE id = $1 RETURNING "+webhookColumns,
+		id, ok, disableAfter, now.UTC(),
+	)
+}
+
+func (s *Storage) EnableWebhook(ctx context.Context, id string) (storage.Webhook, error) {
+	return s.updateWebhook(
+		ctx,
+		id,
+		"failed to enable webhook %q: %w",
+		"UPDATE webhooks SET failures = 0, disabled_at = NULL WHERE id = $1 RETURNING "+webhookColumns,
+		id,
+	)
+}
+
+// updateWebhook runs the query returning the updated webhook, errMsg formats the ID and the error.
+func (s *Storage) updateWebhook(
+	ctx context.Context,
+	id, errMsg, query string,
+	args ...interface{},
+) (storage.Webhook, error) {
+	var row webhookRow
+	err := s.db.GetContext(ctx, &row, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Webhook{}, fmt.Errorf(errMsg, id, storage.ErrNotFoundWebhook)
+	}
+	if err != nil {
+		return storage.Webhook{}, fmt.Errorf(errMsg, id, err)
+	}
+	return row.webhook(), nil
+}
+
+func (s *Storage) AddWebhookDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for i := range deliveries {
+		if err := addDelivery(ctx, tx, &deliveries[i]); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func addDelivery(ctx context.Context, tx *sqlx.Tx, d *storage.WebhookDelivery) error {
+	err := tx.GetContext(
+		ctx,
+		&d.ID,
+		"INSERT INTO webhook_deliveries(webhook_id, token, type, payload, status, attempts, next_attempt_at, "+
+			"created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		d.WebhookID, d.Token, d.Type, []byte(d.Payload), d.Status, d.Attempts, d.NextAttemptAt.UTC(),
+		d.CreatedAt.UTC(), d.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add delivery to webhook %q: %w", d.WebhookID, err)
+	}
+	return nil
+}
+
+func (s *Storage) ClaimWebhookDeliveries(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]storage.WebhookDelivery, error) {
+	// Concurrent workers skip the rows claimed by each other.
+	var rows []deliveryRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"UPDATE webhook_deliveries SET next_attempt_at = $2 WHERE id IN ("+
+			"SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id "+
+			"WHERE d.status = $3 AND d.next_attempt_at <= $1 AND w.disabled_at IS NULL "+
+			"ORDER BY d.id LIMIT $4 FOR UPDATE OF d SKIP LOCKED) RETURNING "+deliveryColumns,
+		now.UTC(), now.Add(lease).UTC(), storage.DeliveryPending, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	deliveries := make([]storage.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, row.delivery())
+	}
+	// UPDATE ... RETURNING doesn't keep the order of the subquery.
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+func (s *Storage) UpdateWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, response_status = $5, "+
+			"error = $6, updated_at = $7 WHERE id = $1",
+		d.ID, d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.ResponseStatus, d.Error, d.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetWebhookDeliveries(
+	ctx context.Context,
+	webhookID string,
+	limit int,
+) ([]storage.WebhookDelivery, error) {
+	var rows []deliveryRow
+	err := s.db.SelectContext(
+		ctx,
+		&rows,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2",
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries of webhook %q: %w", webhookID, err)
+	}
+	deliveries := make([]storage.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, row.delivery())
+	}
+	return deliveries, nil
+}
+
+func (s *Storage) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM webhook_deliveries WHERE status <> $1 AND updated_at < $2",
+		storage.DeliveryPending, before.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge webhook deliveries: %w", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge webhook deliveries: %w", err)
+	}
+	return purged, nil
+}
@@ -13,19 +13,129 @@ var (
 	ErrNotFoundEvent      = errors.New("event not found")
 	ErrIncorrectStartDate = errors.New("date should be a first day of requested period")
 	ErrIncorrectEventTime = errors.New("incorrect event time")
+	ErrVersionConflict    = errors.New("event version conflict")
 )
 
+// BatchResult reports the outcome of a single item of a batch operation.
+type BatchResult struct {
+	ID      string
+	Version int64
+	// Event is the stored event of an item created by BatchCreate.
+	Event *Event
+	Err   error
+}
+
+type BatchUpdateItem struct {
+	ID      string
+	Event   Event
+	Version int64
+}
+
+type BatchRemoveItem struct {
+	ID      string
+	Version int64
+}
+
 type Storage interface {
 	Connect(ctx context.Context) error
 	Close(ctx context.Context) error
 	AddEvent(ctx context.Context, e *Event) error
-	UpdateEvent(ctx context.Context, id string, e Event) error
-	RemoveEvent(ctx context.Context, id string) error
+	// UpdateEvent replaces the event and returns its new version. A non-zero
+	// version must match the stored one, otherwise ErrVersionConflict is returned.
+	UpdateEvent(ctx context.Context, id string, e Event, version int64) (int64, error)
+	// PatchEvent applies a partial update, validates the merged event and returns it.
+	// A non-zero version must match the stored one.
+	PatchEvent(ctx context.Context, id string, patch EventPatch, version int64) (Event, error)
+	// RemoveEvent moves the event to the trash. A non-zero version must match the stored one.
+	// Events in the trash are not returned by any other method but GetTrash.
+	RemoveEvent(ctx context.Context, id string, version int64) error
+	// RestoreEvent moves the event back from the trash and returns it.
+	RestoreEvent(ctx context.Context, id string) (Event, error)
+	// GetTrash returns removed events of the owner, an empty owner returns events of all owners.
+	GetTrash(ctx context.Context, ownerID string) ([]Event, error)
+	// PurgeTrash permanently deletes events removed before the time and returns them.
+	PurgeTrash(ctx context.Context, before time.Time) ([]Event, error)
+	GetEvent(ctx context.Context, id string) (Event, error)
+	// BatchCreate, BatchUpdate and BatchDelete apply every item independently and report
+	// per-item results in the order of the input, the error is returned only if the whole batch failed.
+	BatchCreate(ctx context.Context, events []Event) ([]BatchResult, error)
+	BatchUpdate(ctx context.Context, items []BatchUpdateItem) ([]BatchResult, error)
+	BatchDelete(ctx context.Context, items []BatchRemoveItem) ([]BatchResult, error)
 	GetEventsForDay(ctx context.Context, date time.Time) ([]Event, error)
 	GetEventsForWeek(ctx context.Context, startDate time.Time) ([]Event, error)
 	GetEventsForMonth(ctx context.Context, startDate time.Time) ([]Event, error)
+	// GetOwnerEvents returns the active events of the owner taking any time of [from:to) ordered
+	// by start time, zero to means no upper bound.
+	GetOwnerEvents(ctx context.Context, ownerID string, from, to time.Time) ([]Event, error)
+	// GetTagStats counts active events of the owner per tag, an empty owner counts events of all owners.
+	// The most used tags go first.
+	GetTagStats(ctx context.Context, ownerID string) ([]TagCount, error)
+	// SearchEvents returns up to limit active events matching the query, the most relevant go first.
+	SearchEvents(ctx context.Context, query SearchQuery) ([]SearchResult, error)
 	GetEventsByNotifier(ctx context.Context, limit int, endTime time.Time) ([]Event, error)
-	RemoveAfter(ctx context.Context, time time.Time) error
+	// RemoveAfter deletes events started before the time and returns them.
+	RemoveAfter(ctx context.Context, time time.Time) ([]Event, error)
 	MarkSentEvents(ctx context.Context, events []Event) error
 	AddSenderLog(ctx context.Context, e *rabbit.Message) error
+	// AddChange records the change in the feed and assigns its token.
+	AddChange(ctx context.Context, c *Change) error
+	// GetChanges returns up to limit changes after the token ordered by token,
+	// an empty owner returns changes of all owners. ErrTokenExpired is returned when changes
+	// after the token were purged.
+	GetChanges(ctx context.Context, ownerID string, after int64, limit int) ([]Change, error)
+	// LastChangeToken returns the token of the latest change, zero when nothing was changed yet.
+	LastChangeToken(ctx context.Context) (int64, error)
+	// PurgeChanges deletes the changes made before the time and returns their number,
+	// the tokens preceding them expire.
+	PurgeChanges(ctx context.Context, before time.Time) (int64, error)
+	// AddAuditRecord appends the record to the audit trail and assigns its ID. The event mutations
+	// record their audit themselves, together with the change, as made by the actor of the context.
+	AddAuditRecord(ctx context.Context, r *AuditRecord) error
+	// GetEventHistory returns the audit records of the event ordered by time.
+	GetEventHistory(ctx context.Context, eventID string) ([]AuditRecord, error)
+	// GetOwnerActivity returns up to limit audit records of the owner's events in [from:to)
+	// ordered by time, zero to means no upper bound.
+	GetOwnerActivity(ctx context.Context, ownerID string, from, to time.Time, limit int) ([]AuditRecord, error)
+	// AddIdempotencyRecord reserves the key of the actor, a record created before expiredBefore
+	// is replaced. ErrIdempotencyKeyExists is returned when the key is taken.
+	AddIdempotencyRecord(ctx context.Context, r IdempotencyRecord, expiredBefore time.Time) error
+	GetIdempotencyRecord(ctx context.Context, actor, key string) (IdempotencyRecord, error)
+	// SetIdempotencyResult records the event created for the key.
+	SetIdempotencyResult(ctx context.Context, actor, key string, e Event) error
+	RemoveIdempotencyRecord(ctx context.Context, actor, key string) error
+	// PurgeIdempotencyRecords deletes records created before the time and returns their number.
+	PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int64, error)
+	// AddAttachment appends the attachment to the active event, bumps its version and returns it.
+	AddAttachment(ctx context.Context, eventID string, a Attachment) (Event, error)
+	// RemoveAttachment removes the attachment from the active event, bumps its version and returns it.
+	// ErrNotFoundAttachment is returned when the event has no such attachment.
+	RemoveAttachment(ctx context.Context, eventID, attachmentID string) (Event, error)
+	// LinkCaldavName links the name of a resource put by a CalDAV client of the owner to the event,
+	// a name linked before is moved to the event.
+	LinkCaldavName(ctx context.Context, ownerID, name, eventID string) error
+	// GetCaldavNames returns the IDs of the owner's events put by CalDAV clients by the names of their resources.
+	GetCaldavNames(ctx context.Context, ownerID string) (map[string]string, error)
+	// AddWebhook stores the webhook and assigns its ID.
+	AddWebhook(ctx context.Context, w *Webhook) error
+	GetWebhook(ctx context.Context, id string) (Webhook, error)
+	// GetWebhooks returns all the webhooks ordered by creation time.
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	// RemoveWebhook deletes the webhook with its deliveries.
+	RemoveWebhook(ctx context.Context, id string) error
+	// RecordWebhookResult resets the failures of the webhook after a delivered attempt or counts a failed one,
+	// the webhook is disabled at the time when it fails disableAfter attempts in a row. It returns the webhook.
+	RecordWebhookResult(ctx context.Context, id string, ok bool, disableAfter int, now time.Time) (Webhook, error)
+	// EnableWebhook clears the failures of the webhook and enables it again.
+	EnableWebhook(ctx context.Context, id string) (Webhook, error)
+	// AddWebhookDeliveries queues the deliveries and assigns their IDs.
+	AddWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries of enabled webhooks due at the time
+	// ordered by ID, they are not returned again until the lease is over.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// UpdateWebhookDelivery records the outcome of an attempt.
+	UpdateWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	// GetWebhookDeliveries returns up to limit deliveries of the webhook, the latest go first.
+	GetWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error)
+	// PurgeWebhookDeliveries deletes the finished deliveries updated before the time and returns their number.
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
 }
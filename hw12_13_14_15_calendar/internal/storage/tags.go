@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxTagLength limits the length of a single tag.
+const maxTagLength = 64
+
+// TagCount is the number of events with the tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// EventFilter selects events of listings, the zero filter matches all events.
+type EventFilter struct {
+	// Tags lists the tags all of which an event must have.
+	Tags []string
+}
+
+// Match reports whether the event passes the filter.
+func (f EventFilter) Match(e Event) bool {
+	for _, tag := range NormalizeTags(f.Tags) {
+		found := false
+		for _, t := range e.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the events passing the filter.
+func (f EventFilter) Filter(events []Event) []Event {
+	if len(f.Tags) == 0 {
+		return events
+	}
+	filtered := make([]Event, 0, len(events))
+	for _, e := range events {
+		if f.Match(e) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// NormalizeTags trims and lowercases the tags, drops empty and duplicate ones and sorts the rest.
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
+		}
+		seen[tag] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// SortTagCounts orders the most used tags first, tags used equally are ordered by name.
+func SortTagCounts(counts []TagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+}
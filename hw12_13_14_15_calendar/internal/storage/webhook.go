@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrNotFoundWebhook = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// Webhook is a subscription of a third-party system to the changes of events.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// EventTypes are the changes delivered, empty means all of them.
+	EventTypes []ChangeType `json:"eventTypes"`
+	// OwnerID limits the changes to the events of the owner, empty means all owners.
+	OwnerID string `json:"ownerId"`
+	// Secret signs the payloads, it is not serialized to keep it out of the responses.
+	Secret string `json:"-"`
+	// Failures counts the delivery attempts failed in a row.
+	Failures int `json:"failures"`
+	// DisabledAt is set when the webhook is disabled after repeated failures, nothing is delivered then.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: url %q is not an absolute https URL", ErrInvalidWebhook, w.URL)
+	}
+	for _, t := range w.EventTypes {
+		switch t {
+		case ChangeCreated, ChangeUpdated, ChangeDeleted:
+		default:
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, t)
+		}
+	}
+	if w.Secret == "" {
+		return fmt.Errorf("%w: secret is required", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+// Matches reports whether the change is delivered to the enabled webhook.
+func (w *Webhook) Matches(c Change) bool {
+	if w.DisabledAt != nil || (w.OwnerID != "" && w.OwnerID != c.OwnerID) {
+		return false
+	}
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == c.Type {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed is final, the delivery ran out of attempts.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a change queued for a webhook, delivered deliveries are kept as its log.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID string `json:"webhookId"`
+	// Token is the token of the change, receivers may use it to drop repeated deliveries.
+	Token   int64           `json:"token"`
+	Type    ChangeType      `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Status  DeliveryStatus  `json:"status"`
+	// Attempts counts the attempts made, NextAttemptAt is when a pending delivery is tried again.
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	// ResponseStatus is the HTTP status of the last attempt, zero when no response was received.
+	ResponseStatus int       `json:"responseStatus,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
@@ -5,21 +5,36 @@ import (
 	"fmt"
 	"time"
 
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
 	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
 	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
 	sqlstorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/sql"
 )
 
+const (
+	MemoryStorage = "memory"
+	SQLStorage    = "sql"
+)
+
 type Config struct {
 	StorageType string
 	Database    sqlstorage.Config
 }
 
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	v.OneOf("storageType", c.StorageType, MemoryStorage, SQLStorage)
+	if c.StorageType == SQLStorage {
+		v.Check("database", c.Database.Validate())
+	}
+	return v.Err()
+}
+
 func NewStorage(config Config) (storage.Storage, error) {
 	switch config.StorageType {
-	case "memory":
+	case MemoryStorage:
 		return memorystorage.New(), nil
-	case "sql":
+	case SQLStorage:
 		s := sqlstorage.New(config.Database)
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
@@ -0,0 +1,163 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+// ServerConfig enables TLS of a server, a client CA enables mutual TLS.
+type ServerConfig struct {
+	Enabled  bool
+	CertFile string
+	KeyFile  string
+	// ClientCAFile requires clients to present a certificate signed by one of the CAs of the file.
+	ClientCAFile string
+}
+
+func (c ServerConfig) Validate() error {
+	var v internalconfig.Validation
+	if c.Enabled {
+		v.Required("certFile", c.CertFile)
+		v.Required("keyFile", c.KeyFile)
+	}
+	return v.Err()
+}
+
+// Load returns the TLS config of a server. The certificate is reloaded when its files change,
+// so renewed certificates are served without a restart.
+func (c ServerConfig) Load() (*tls.Config, error) {
+	r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	modTime, err := r.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.certificate,
+	}
+	if c.ClientCAFile != "" {
+		config.ClientCAs, err = loadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientConfig enables TLS of a connection to a server.
+type ClientConfig struct {
+	Enabled bool
+	// CAFile verifies the server certificate, the system roots are used when it is empty.
+	CAFile string
+	// CertFile and KeyFile are presented to servers which require client certificates.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name the server certificate is verified against.
+	ServerName string
+}
+
+func (c ClientConfig) Validate() error {
+	var v internalconfig.Validation
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		v.Addf("certFile", "must be set together with keyFile")
+	}
+	return v.Err()
+}
+
+// Load returns the TLS config of a client.
+func (c ClientConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w in %q", ErrNoCertificates, file)
+	}
+	return pool, nil
+}
+
+// certReloader serves the certificate of the files, it is loaded again once the files are modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	loadedAt time.Time
+}
+
+func (r *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modTime, err := r.modTime()
+	if err == nil && !modTime.Equal(r.loadedAt) {
+		err = r.load(modTime)
+	}
+	if err != nil {
+		// The files may be in the middle of being replaced, the next handshake tries again.
+		log.Errorf("failed to reload certificate, the current one is kept: %v", err)
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.loadedAt = modTime
+	return nil
+}
+
+// modTime returns the latest modification time of the certificate and key files.
+func (r *certReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat certificate file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,158 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir string) (testCA, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return testCA{cert: cert, key: key}, file
+}
+
+// issue writes a certificate signed by the CA and its key to the files named after the common name.
+func (ca testCA) issue(t *testing.T, dir, name string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+}
+
+// serve accepts connections until the listener is closed, each one gets a greeting.
+func serve(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	lsn, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	t.Cleanup(func() { lsn.Close() })
+	go func() {
+		for {
+			conn, err := lsn.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+	return lsn.Addr().String()
+}
+
+// dial returns the common name of the server certificate.
+func dial(addr string, config *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := io.ReadAll(conn); err != nil {
+		return "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2)
+	clientCert, clientKey := ca.issue(t, dir, "client", 3)
+
+	serverConfig, err := ServerConfig{
+		Enabled: true, CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile,
+	}.Load()
+	require.NoError(t, err)
+	addr := serve(t, serverConfig)
+
+	clientConfig, err := ClientConfig{
+		Enabled: true, CAFile: caFile, CertFile: clientCert, KeyFile: clientKey,
+	}.Load()
+	require.NoError(t, err)
+	name, err := dial(addr, clientConfig)
+	require.NoError(t, err)
+	require.Equal(t, "server", name)
+
+	t.Run("no client certificate", func(t *testing.T) {
+		config, err := ClientConfig{Enabled: true, CAFile: caFile}.Load()
+		require.NoError(t, err)
+		_, err = dial(addr, config)
+		require.Error(t, err)
+	})
+
+	t.Run("certificate reload", func(t *testing.T) {
+		renewedCert, renewedKey := ca.issue(t, dir, "renewed", 4)
+		require.NoError(t, os.Rename(renewedCert, serverCert))
+		require.NoError(t, os.Rename(renewedKey, serverKey))
+		// The file system may keep the modification time with a coarse precision.
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(serverCert, later, later))
+
+		name, err := dial(addr, clientConfig)
+		require.NoError(t, err)
+		require.Equal(t, "renewed", name)
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.Error(t, ServerConfig{Enabled: true}.Validate())
+	require.NoError(t, ServerConfig{}.Validate())
+	require.Error(t, ClientConfig{Enabled: true, CertFile: "client.pem"}.Validate())
+	require.NoError(t, ClientConfig{Enabled: true}.Validate())
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// privateNetworks are not reachable from the internet, loopback, link-local and multicast
+// addresses are rejected besides them.
+var privateNetworks = mustParseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"fc00::/7",
+)
+
+// Guard keeps the webhooks from reaching the internal services, only the public addresses and
+// the addresses of the allowed networks are delivered to. The zero value allows the public addresses.
+type Guard struct {
+	allowed []*net.IPNet
+}
+
+// NewGuard allows the networks in CIDR notation besides the public addresses.
+func NewGuard(networks []string) (*Guard, error) {
+	allowed, err := parseNetworks(networks)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{allowed: allowed}, nil
+}
+
+// CheckURL checks the host of a new webhook URL, the URL itself is checked by storage.Webhook.Validate.
+// Only the hosts given by address are checked, the names are checked once they are resolved on delivery.
+func (g *Guard) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: url %q: %v", storage.ErrInvalidWebhook, raw, err)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: url %q: %v", storage.ErrInvalidWebhook, raw, ErrForbiddenAddress)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := g.CheckIP(ip); err != nil {
+			return fmt.Errorf("%w: url %q: %v", storage.ErrInvalidWebhook, raw, err)
+		}
+	}
+	return nil
+}
+
+// CheckIP returns ErrForbiddenAddress for the addresses not reachable from the internet
+// unless their network is allowed.
+func (g *Guard) CheckIP(ip net.IP) error {
+	if inNetworks(g.allowed, ip) {
+		return nil
+	}
+	if !ip.IsGlobalUnicast() || inNetworks(privateNetworks, ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+// control checks the resolved address right before the connection, so a name resolved
+// to an internal address after the webhook was created isn't reached either.
+func (g *Guard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return g.CheckIP(ip)
+}
+
+// transport dials the checked addresses only. Proxies are not used, they would hide the addresses.
+func (g *Guard) transport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: g.control}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+	for _, s := range networks {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, n)
+	}
+	return parsed, nil
+}
+
+func mustParseNetworks(networks ...string) []*net.IPNet {
+	parsed, err := parseNetworks(networks)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func inNetworks(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardCheckURL(t *testing.T) {
+	guard, err := NewGuard([]string{"10.1.0.0/16"})
+	require.NoError(t, err)
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{url: "https://hooks.example.com/calendar", ok: true},
+		{url: "https://93.184.216.34/hook", ok: true},
+		{url: "https://10.1.2.3/hook", ok: true},
+		{url: "https://localhost/hook"},
+		{url: "https://api.LOCALHOST./hook"},
+		{url: "https://127.0.0.1:8005/webhooks/add"},
+		{url: "https://10.2.0.1/hook"},
+		{url: "https://172.16.0.1/hook"},
+		{url: "https://192.168.1.1/hook"},
+		{url: "https://169.254.169.254/latest/meta-data"},
+		{url: "https://0.0.0.0/hook"},
+		{url: "https://[::1]/hook"},
+		{url: "https://[fd00::1]/hook"},
+		{url: "https://[fe80::1]/hook"},
+		{url: "https://[::ffff:127.0.0.1]/hook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := guard.CheckURL(tt.url)
+			if tt.ok {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, storage.ErrInvalidWebhook)
+		})
+	}
+}
+
+func TestGuardControl(t *testing.T) {
+	var guard Guard
+	require.NoError(t, guard.control("tcp", "93.184.216.34:443", nil))
+	require.ErrorIs(t, guard.control("tcp", "127.0.0.1:443", nil), ErrForbiddenAddress)
+	require.ErrorIs(t, guard.control("tcp6", "[::1]:443", nil), ErrForbiddenAddress)
+
+	_, err := NewGuard([]string{"10.0.0.1"})
+	require.Error(t, err)
+}
@@ -0,0 +1,312 @@
+// Package webhook delivers the changes of events queued by app.App to the subscribed webhooks.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	internalconfig "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/config"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/logger"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+)
+
+// The headers of a delivery request, its body is the JSON of the storage.Change.
+const (
+	WebhookHeader   = "X-Calendar-Webhook"
+	DeliveryHeader  = "X-Calendar-Delivery"
+	EventHeader     = "X-Calendar-Event"
+	TimestampHeader = "X-Calendar-Timestamp"
+	SignatureHeader = "X-Calendar-Signature"
+)
+
+const (
+	signaturePrefix = "sha256="
+	// maxErrorLength bounds the error kept in the delivery log.
+	maxErrorLength = 500
+	// maxResponseSize is the most bytes of a response read, so the connection can be reused.
+	maxResponseSize = 4 << 10
+	// purgeInterval is how often the delivery log is purged.
+	purgeInterval = time.Hour
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+type Config struct {
+	// Enabled runs the delivery worker, the webhooks are queued without it for the instances which run it.
+	Enabled bool
+	// PollInterval is how often due deliveries are looked for.
+	PollInterval time.Duration
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+	// BatchSize is the maximum number of deliveries taken at once.
+	BatchSize int
+	// MaxAttempts is how many times a delivery is tried before it fails for good.
+	MaxAttempts int
+	// MinBackoff is the delay after the first failed attempt, it doubles with every attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// DisableAfter disables a webhook after that many attempts failed in a row.
+	DisableAfter int
+	// LogRetention is how long finished deliveries are kept in the log.
+	LogRetention time.Duration
+	// AllowedNetworks are the private networks in CIDR notation the webhooks may be delivered to,
+	// only the public addresses are reached otherwise.
+	AllowedNetworks []string
+}
+
+func (c Config) Validate() error {
+	var v internalconfig.Validation
+	// The networks are checked on creation of webhooks, so they are valid without the worker too.
+	for i, n := range c.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			v.Addf(fmt.Sprintf("allowedNetworks[%d]", i), "must be a CIDR, got %q", n)
+		}
+	}
+	if !c.Enabled {
+		return v.Err()
+	}
+	v.Duration("pollInterval", c.PollInterval)
+	v.Duration("timeout", c.Timeout)
+	v.Positive("batchSize", c.BatchSize)
+	v.Positive("maxAttempts", c.MaxAttempts)
+	v.Duration("minBackoff", c.MinBackoff)
+	v.Duration("maxBackoff", c.MaxBackoff)
+	if c.MaxBackoff < c.MinBackoff {
+		v.Addf("maxBackoff", "must not be less than minBackoff %s, got %s", c.MinBackoff, c.MaxBackoff)
+	}
+	v.Positive("disableAfter", c.DisableAfter)
+	v.Duration("logRetention", c.LogRetention)
+	return v.Err()
+}
+
+// Storage is the part of storage.Storage used by the worker.
+type Storage interface {
+	GetWebhook(ctx context.Context, id string) (storage.Webhook, error)
+	RecordWebhookResult(ctx context.Context, id string, ok bool, disableAfter int, now time.Time) (storage.Webhook, error)
+	ClaimWebhookDeliveries(
+		ctx context.Context, now time.Time, lease time.Duration, limit int,
+	) ([]storage.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Worker delivers the queued changes, several workers may share the storage.
+type Worker struct {
+	stor      Storage
+	client    *http.Client
+	config    Config
+	clock     clock.Clock
+	guard     *Guard
+	lastPurge time.Time
+}
+
+type Option func(*Worker)
+
+// WithClock sets the clock of the loop, the signatures and the retries, the system one by default.
+func WithClock(c clock.Clock) Option {
+	return func(w *Worker) {
+		w.clock = c
+	}
+}
+
+// WithGuard sets the guard of the addresses delivered to, only the public ones are allowed by default.
+func WithGuard(g *Guard) Option {
+	return func(w *Worker) {
+		w.guard = g
+	}
+}
+
+// NewWorker creates the worker sending the requests with the client, redirects are not followed.
+// The transport of the client is replaced by the one dialing the addresses allowed by the guard.
+func NewWorker(stor Storage, client *http.Client, config Config, opts ...Option) *Worker {
+	w := &Worker{stor: stor, config: config, clock: clock.Real, guard: &Guard{}}
+	for _, opt := range opts {
+		opt(w)
+	}
+	c := *client
+	c.Transport = w.guard.transport()
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	w.client = &c
+	return w
+}
+
+// Run delivers the due changes every poll interval and purges the delivery log until ctx is done.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := w.clock.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		runCtx := logger.WithRequestID(ctx, logger.NewRequestID())
+		w.Deliver(runCtx)
+		if now := w.clock.Now(); now.Sub(w.lastPurge) >= purgeInterval {
+			w.purge(runCtx, now)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Deliver attempts the due deliveries until none is left and returns the number of attempts.
+// The failed attempts are retried with a backoff, errors of the storage are logged.
+func (w *Worker) Deliver(ctx context.Context) int {
+	// A claimed batch is not taken by other workers while this one sends it.
+	lease := w.config.Timeout * time.Duration(w.config.BatchSize+1)
+	attempts := 0
+	for ctx.Err() == nil {
+		deliveries, err := w.stor.ClaimWebhookDeliveries(ctx, w.clock.Now(), lease, w.config.BatchSize)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("failed to claim webhook deliveries: %v", err)
+			return attempts
+		}
+		for _, d := range deliveries {
+			if w.attempt(ctx, d) {
+				attempts++
+			}
+		}
+		if len(deliveries) < w.config.BatchSize {
+			break
+		}
+	}
+	return attempts
+}
+
+// attempt sends the delivery and records the outcome, it returns false when the delivery is not sent.
+func (w *Worker) attempt(ctx context.Context, d storage.WebhookDelivery) bool {
+	hook, err := w.stor.GetWebhook(ctx, d.WebhookID)
+	if err != nil {
+		// The deliveries of removed webhooks are removed too, others are retried after the lease.
+		if !errors.Is(err, storage.ErrNotFoundWebhook) {
+			logger.FromContext(ctx).Errorf("failed to get webhook of delivery %d: %v", d.ID, err)
+		}
+		return false
+	}
+	if hook.DisabledAt != nil || ctx.Err() != nil {
+		return false
+	}
+
+	status, err := w.send(ctx, hook, d)
+	now := w.clock.Now()
+	d.Attempts++
+	d.ResponseStatus = status
+	d.UpdatedAt = now
+	d.Error = ""
+	switch {
+	case err == nil:
+		d.Status = storage.DeliveryDelivered
+	case d.Attempts >= w.config.MaxAttempts:
+		d.Status = storage.DeliveryFailed
+		d.Error = truncate(err.Error())
+	default:
+		d.NextAttemptAt = now.Add(w.backoff(d.Attempts))
+		d.Error = truncate(err.Error())
+	}
+	if err := w.stor.UpdateWebhookDelivery(ctx, d); err != nil {
+		logger.FromContext(ctx).Errorf("failed to record webhook delivery %d: %v", d.ID, err)
+	}
+
+	hook, err = w.stor.RecordWebhookResult(ctx, hook.ID, d.Status == storage.DeliveryDelivered, w.config.DisableAfter, now)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to record result of webhook %q: %v", d.WebhookID, err)
+	} else if hook.DisabledAt != nil {
+		logger.FromContext(ctx).Warnf("webhook %q is disabled after %d failed attempts", hook.ID, hook.Failures)
+	}
+	return true
+}
+
+// send posts the signed payload, any status but 2xx is an error.
+func (w *Worker) send(ctx context.Context, hook storage.Webhook, d storage.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	now := w.clock.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeader, hook.ID)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(EventHeader, string(d.Type))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, now, d.Payload))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the failed attempt.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.config.MinBackoff
+	for i := 1; i < attempts && delay < w.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.config.MaxBackoff {
+		delay = w.config.MaxBackoff
+	}
+	return delay
+}
+
+func (w *Worker) purge(ctx context.Context, now time.Time) {
+	purged, err := w.stor.PurgeWebhookDeliveries(ctx, now.Add(-w.config.LogRetention))
+	if err != nil {
+		logger.FromContext(ctx).Errorf("failed to purge webhook deliveries: %v", err)
+		return
+	}
+	w.lastPurge = now
+	logger.FromContext(ctx).Debugf("purged %d webhook deliveries", purged)
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
+
+// Sign returns the signature of the payload sent at the time: "sha256=" followed by the hex
+// HMAC-SHA256 with the secret of the Unix time in seconds, a dot and the payload.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of the delivery request for the receivers, the requests signed
+// more than tolerance away from now are rejected to prevent replays.
+func Verify(secret string, header http.Header, payload []byte, now time.Time, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, header.Get(TimestampHeader))
+	}
+	timestamp := time.Unix(unix, 0)
+	if skew := now.Sub(timestamp); skew > tolerance || skew < -tolerance {
+		return fmt.Errorf("%w: timestamp %s is too far from now", ErrInvalidSignature, timestamp.UTC())
+	}
+	expected := Sign(secret, timestamp, payload)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(SignatureHeader))) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/clock"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var testConfig = Config{
+	Enabled:      true,
+	PollInterval: time.Second,
+	Timeout:      time.Second,
+	BatchSize:    2,
+	MaxAttempts:  3,
+	MinBackoff:   time.Minute,
+	MaxBackoff:   90 * time.Second,
+	DisableAfter: 5,
+	LogRetention: time.Hour,
+}
+
+// receiver records the requests and answers with the statuses in order, then with 200.
+type receiver struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	r := &receiver{t: t, statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handle))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+type workerTest struct {
+	t      *testing.T
+	clock  *clock.Fake
+	stor   *memorystorage.Storage
+	worker *Worker
+}
+
+func newWorkerTest(t *testing.T) *workerTest {
+	t.Helper()
+	c := clock.NewFake(testNow)
+	stor := memorystorage.New(memorystorage.WithClock(c))
+	// The receivers listen on the loopback.
+	guard, err := NewGuard([]string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	worker := NewWorker(stor, http.DefaultClient, testConfig, WithClock(c), WithGuard(guard))
+	return &workerTest{t: t, clock: c, stor: stor, worker: worker}
+}
+
+func (wt *workerTest) webhook(url string) storage.Webhook {
+	wt.t.Helper()
+	w := storage.Webhook{URL: url, Secret: "s3cret", CreatedAt: testNow}
+	require.NoError(wt.t, wt.stor.AddWebhook(context.Background(), &w))
+	return w
+}
+
+func (wt *workerTest) enqueue(w storage.Webhook, tokens ...int64) {
+	wt.t.Helper()
+	deliveries := make([]storage.WebhookDelivery, 0, len(tokens))
+	for _, token := range tokens {
+		deliveries = append(deliveries, storage.WebhookDelivery{
+			WebhookID:     w.ID,
+			Token:         token,
+			Type:          storage.ChangeCreated,
+			Payload:       []byte(`{"token":1}`),
+			Status:        storage.DeliveryPending,
+			NextAttemptAt: wt.clock.Now(),
+		})
+	}
+	require.NoError(wt.t, wt.stor.AddWebhookDeliveries(context.Background(), deliveries))
+}
+
+func (wt *workerTest) deliveries(w storage.Webhook) []storage.WebhookDelivery {
+	wt.t.Helper()
+	deliveries, err := wt.stor.GetWebhookDeliveries(context.Background(), w.ID, 100)
+	require.NoError(wt.t, err)
+	return deliveries
+}
+
+func TestDeliver(t *testing.T) {
+	wt := newWorkerTest(t)
+	r := newReceiver(t)
+	w := wt.webhook(r.URL)
+	wt.enqueue(w, 1, 2, 3)
+
+	require.Equal(t, 3, wt.worker.Deliver(context.Background()), "the backlog is sent in batches")
+	require.Equal(t, 3, r.requests())
+	for _, d := range wt.deliveries(w) {
+		require.Equal(t, storage.DeliveryDelivered, d.Status)
+		require.Equal(t, 1, d.Attempts)
+		require.Equal(t, http.StatusOK, d.ResponseStatus)
+	}
+
+	header := r.headers[0]
+	require.Equal(t, w.ID, header.Get(WebhookHeader))
+	require.Equal(t, "created", header.Get(EventHeader))
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.NoError(t, Verify("s3cret", header, r.bodies[0], testNow.Add(time.Minute), 5*time.Minute))
+	require.ErrorIs(t, Verify("other", header, r.bodies[0], testNow, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("s3cret", header, []byte(`{"token":2}`), testNow, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("s3cret", header, r.bodies[0], testNow.Add(time.Hour), time.Minute), ErrInvalidSignature,
+		"old requests are rejected")
+
+	require.Zero(t, wt.worker.Deliver(context.Background()), "nothing is sent twice")
+}
+
+func TestDeliverRetries(t *testing.T) {
+	wt := newWorkerTest(t)
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusMovedPermanently)
+	w := wt.webhook(r.URL)
+	wt.enqueue(w, 1)
+
+	wt.worker.Deliver(context.Background())
+	d := wt.deliveries(w)[0]
+	require.Equal(t, storage.DeliveryPending, d.Status)
+	require.Equal(t, http.StatusInternalServerError, d.ResponseStatus)
+	require.Contains(t, d.Error, "500")
+	require.Equal(t, testNow.Add(time.Minute), d.NextAttemptAt)
+
+	wt.clock.Advance(30 * time.Second)
+	require.Zero(t, wt.worker.Deliver(context.Background()), "the backoff is not over")
+	wt.clock.Advance(30 * time.Second)
+	wt.worker.Deliver(context.Background())
+	d = wt.deliveries(w)[0]
+	require.Equal(t, http.StatusMovedPermanently, d.ResponseStatus, "redirects are not followed")
+	require.Equal(t, wt.clock.Now().Add(90*time.Second), d.NextAttemptAt, "the backoff doubles up to the maximum")
+
+	wt.clock.Advance(90 * time.Second)
+	wt.worker.Deliver(context.Background())
+	d = wt.deliveries(w)[0]
+	require.Equal(t, storage.DeliveryDelivered, d.Status)
+	require.Equal(t, 3, d.Attempts)
+	require.Empty(t, d.Error)
+	hook, err := wt.stor.GetWebhook(context.Background(), w.ID)
+	require.NoError(t, err)
+	require.Zero(t, hook.Failures, "a delivered attempt resets the failures")
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	ctx := context.Background()
+	wt := newWorkerTest(t)
+	r := newReceiver(t, 500, 500, 500, 500, 500)
+	w := wt.webhook(r.URL)
+	wt.enqueue(w, 1)
+
+	for i := 0; i < testConfig.MaxAttempts; i++ {
+		wt.worker.Deliver(ctx)
+		wt.clock.Advance(testConfig.MaxBackoff)
+	}
+	d := wt.deliveries(w)[0]
+	require.Equal(t, storage.DeliveryFailed, d.Status)
+	require.Equal(t, testConfig.MaxAttempts, d.Attempts)
+	require.Zero(t, wt.worker.Deliver(ctx), "a failed delivery is not retried")
+
+	wt.enqueue(w, 2)
+	wt.worker.Deliver(ctx)
+	wt.clock.Advance(testConfig.MaxBackoff)
+	wt.worker.Deliver(ctx)
+	hook, err := wt.stor.GetWebhook(ctx, w.ID)
+	require.NoError(t, err)
+	require.NotNil(t, hook.DisabledAt, "the webhook is disabled after %d failures", testConfig.DisableAfter)
+	require.Equal(t, testConfig.DisableAfter, hook.Failures)
+
+	wt.clock.Advance(testConfig.MaxBackoff)
+	wt.enqueue(w, 3)
+	require.Zero(t, wt.worker.Deliver(ctx), "nothing is sent to the disabled webhook")
+	require.Equal(t, testConfig.DisableAfter, r.requests())
+	_, err = wt.stor.EnableWebhook(ctx, w.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, wt.worker.Deliver(ctx), "the pending deliveries resume")
+	for _, d := range wt.deliveries(w)[:2] {
+		require.Equal(t, storage.DeliveryDelivered, d.Status)
+	}
+
+	wt.clock.Advance(2 * testConfig.LogRetention)
+	wt.worker.purge(ctx, wt.clock.Now())
+	require.Empty(t, wt.deliveries(w), "the finished deliveries are purged")
+}
+
+func TestDeliverForbiddenAddress(t *testing.T) {
+	wt := newWorkerTest(t)
+	wt.worker = NewWorker(wt.stor, http.DefaultClient, testConfig, WithClock(wt.clock))
+	r := newReceiver(t)
+	w := wt.webhook(r.URL)
+	wt.enqueue(w, 1)
+
+	wt.worker.Deliver(context.Background())
+	require.Zero(t, r.requests(), "the loopback isn't reached")
+	d := wt.deliveries(w)[0]
+	require.Equal(t, storage.DeliveryPending, d.Status)
+	require.Contains(t, d.Error, ErrForbiddenAddress.Error())
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, Config{}.Validate(), "disabled worker needs no settings")
+	require.NoError(t, testConfig.Validate())
+	invalid := testConfig
+	invalid.MaxBackoff = time.Second
+	invalid.BatchSize = 0
+	err := invalid.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "maxBackoff")
+	require.Contains(t, err.Error(), "batchSize")
+
+	err = Config{AllowedNetworks: []string{"10.0.0.0/8", "10.0.0.1"}}.Validate()
+	require.Error(t, err, "the networks are checked without the worker too")
+	require.Contains(t, err.Error(), "allowedNetworks[1]")
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE event_changes (
+                        id bigserial NOT NULL,
+                        type varchar NOT NULL,
+                        event_id varchar NOT NULL,
+                        owner_id varchar NOT NULL,
+                        event jsonb NOT NULL,
+                        time timestamptz NOT NULL,
+                        CONSTRAINT event_changes_pk PRIMARY KEY (id)
+);
+-- +goose StatementEnd
+CREATE INDEX event_changes_owner_id_idx ON event_changes (owner_id, id);
+
+-- +goose Down
+DROP INDEX event_changes_owner_id_idx;
+DROP TABLE event_changes;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE event_audit (
+                        id bigserial NOT NULL,
+                        action varchar NOT NULL,
+                        event_id varchar NOT NULL,
+                        owner_id varchar NOT NULL,
+                        actor varchar NOT NULL,
+                        time timestamptz NOT NULL,
+                        before jsonb,
+                        after jsonb,
+                        CONSTRAINT event_audit_pk PRIMARY KEY (id)
+);
+-- +goose StatementEnd
+CREATE INDEX event_audit_event_id_idx ON event_audit (event_id, id);
+CREATE INDEX event_audit_owner_id_idx ON event_audit (owner_id, time);
+
+-- The audit trail is append-only.
+-- +goose StatementBegin
+CREATE FUNCTION event_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'event_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+CREATE TRIGGER event_audit_append_only BEFORE UPDATE OR DELETE ON event_audit
+    FOR EACH ROW EXECUTE PROCEDURE event_audit_append_only();
+
+-- +goose Down
+DROP TRIGGER event_audit_append_only ON event_audit;
+DROP FUNCTION event_audit_append_only();
+DROP INDEX event_audit_owner_id_idx;
+DROP INDEX event_audit_event_id_idx;
+DROP TABLE event_audit;
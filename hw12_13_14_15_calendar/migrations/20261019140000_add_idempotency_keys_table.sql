@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE idempotency_keys (
+                        actor varchar NOT NULL,
+                        key varchar NOT NULL,
+                        request_hash varchar NOT NULL,
+                        event jsonb,
+                        created_at timestamptz NOT NULL,
+                        CONSTRAINT idempotency_keys_pk PRIMARY KEY (actor, key)
+);
+-- +goose StatementEnd
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +goose Down
+DROP INDEX idempotency_keys_created_at_idx;
+DROP TABLE idempotency_keys;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE events ADD COLUMN color varchar NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN location varchar NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN latitude double precision NULL;
+ALTER TABLE events ADD COLUMN longitude double precision NULL;
+ALTER TABLE events ADD COLUMN conference_url varchar NOT NULL DEFAULT '';
+CREATE INDEX events_tags_idx ON events USING gin (tags);
+
+-- +goose Down
+DROP INDEX events_tags_idx;
+ALTER TABLE events DROP COLUMN conference_url;
+ALTER TABLE events DROP COLUMN longitude;
+ALTER TABLE events DROP COLUMN latitude;
+ALTER TABLE events DROP COLUMN location;
+ALTER TABLE events DROP COLUMN color;
+ALTER TABLE events DROP COLUMN tags;
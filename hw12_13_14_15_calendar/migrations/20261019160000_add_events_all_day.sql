@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN all_day boolean NOT NULL DEFAULT false;
+CREATE INDEX events_end_timestamp_idx ON events (end_timestamp);
+
+-- +goose Down
+DROP INDEX events_end_timestamp_idx;
+ALTER TABLE events DROP COLUMN all_day;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN attachments jsonb NOT NULL DEFAULT '[]';
+
+-- +goose Down
+ALTER TABLE events DROP COLUMN attachments;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- The simple configuration doesn't stem words, so the search matches the memory storage.
+ALTER TABLE events ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+) STORED;
+CREATE INDEX events_search_vector_idx ON events USING gin (search_vector);
+
+-- +goose Down
+DROP INDEX events_search_vector_idx;
+ALTER TABLE events DROP COLUMN search_vector;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webhooks (
+                        id uuid NOT NULL DEFAULT uuid_generate_v4(),
+                        url varchar NOT NULL,
+                        event_types text[] NOT NULL DEFAULT '{}',
+                        owner_id varchar NOT NULL DEFAULT '',
+                        secret varchar NOT NULL,
+                        failures int NOT NULL DEFAULT 0,
+                        disabled_at timestamptz,
+                        created_at timestamptz NOT NULL,
+                        CONSTRAINT webhooks_pk PRIMARY KEY (id)
+);
+CREATE TABLE webhook_deliveries (
+                        id bigserial NOT NULL,
+                        webhook_id uuid NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                        token int8 NOT NULL,
+                        type varchar NOT NULL,
+                        payload jsonb NOT NULL,
+                        status varchar NOT NULL,
+                        attempts int NOT NULL DEFAULT 0,
+                        next_attempt_at timestamptz NOT NULL,
+                        response_status int NOT NULL DEFAULT 0,
+                        error varchar NOT NULL DEFAULT '',
+                        created_at timestamptz NOT NULL,
+                        updated_at timestamptz NOT NULL,
+                        CONSTRAINT webhook_deliveries_pk PRIMARY KEY (id)
+);
+-- +goose StatementEnd
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_webhook_id_idx;
+DROP INDEX webhook_deliveries_pending_idx;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE caldav_names (
+                        owner_id varchar NOT NULL,
+                        name varchar NOT NULL,
+                        event_id uuid NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+                        CONSTRAINT caldav_names_pk PRIMARY KEY (owner_id, name)
+);
+-- +goose StatementEnd
+CREATE INDEX caldav_names_event_id_idx ON caldav_names (event_id);
+
+-- +goose Down
+DROP INDEX caldav_names_event_id_idx;
+DROP TABLE caldav_names;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE event_changes_purged (
+                        id int NOT NULL DEFAULT 1 CHECK (id = 1),
+                        token int8 NOT NULL,
+                        CONSTRAINT event_changes_purged_pk PRIMARY KEY (id)
+);
+-- +goose StatementEnd
+CREATE INDEX event_changes_time_idx ON event_changes (time);
+
+-- +goose Down
+DROP INDEX event_changes_time_idx;
+DROP TABLE event_changes_purged;
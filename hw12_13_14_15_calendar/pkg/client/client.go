@@ -0,0 +1,547 @@
+// Package client is the Go client of the calendar gRPC API. It converts the API messages to
+// the events of the calendar, retries calls while the server is unavailable and maps status
+// codes of failed calls to the errors of the storage.
+package client
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type (
+	// Event is an event of the calendar.
+	Event = storage.Event
+	// EventPatch updates the set fields of an event only.
+	EventPatch = storage.EventPatch
+	// Location is where an event takes place.
+	Location = storage.Location
+	// GeoPoint is the coordinates of a location.
+	GeoPoint = storage.GeoPoint
+	// TagCount is the number of events with the tag.
+	TagCount = storage.TagCount
+	// Attachment is a file attached to an event.
+	Attachment = storage.Attachment
+	// SearchResult is an event found by SearchEvents with its relevance.
+	SearchResult = storage.SearchResult
+)
+
+const (
+	// actorMetadata identifies the user on whose behalf the call is made.
+	actorMetadata = "x-user-id"
+	// idempotencyKeyMetadata makes retries of a creation call return the original result.
+	idempotencyKeyMetadata = "idempotency-key"
+
+	defaultTimeout      = 10 * time.Second
+	defaultAttempts     = 3
+	defaultBackoff      = 100 * time.Millisecond
+	defaultMaxBackoff   = 2 * time.Second
+	backoffJitterFactor = 0.2
+	// attachmentChunkSize is the size of the content sent in a single message of an upload.
+	attachmentChunkSize = 64 << 10
+)
+
+type options struct {
+	timeout     time.Duration
+	attempts    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	metadata    []string
+	tls         *tls.Config
+	dialOptions []grpc.DialOption
+}
+
+// Option configures the client.
+type Option func(*options)
+
+// WithTimeout bounds calls whose context has no deadline, retries included. Zero disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithRetry sets the number of attempts of a call while the server is unavailable
+// and the delay before the first retry, which doubles with every next one.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
+// WithUserID sends the user the changes are made on behalf of with every call.
+func WithUserID(userID string) Option {
+	return func(o *options) { o.metadata = append(o.metadata, actorMetadata, userID) }
+}
+
+// WithTLS connects to the server over TLS.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) { o.tls = config }
+}
+
+// WithDialOptions adds options of the connection made by New.
+func WithDialOptions(dialOptions ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, dialOptions...) }
+}
+
+type Client struct {
+	api     api.EventsClient
+	conn    *grpc.ClientConn
+	options options
+}
+
+// New connects to the calendar server at the address.
+func New(address string, opts ...Option) (*Client, error) {
+	o := newOptions(opts)
+	creds := insecure.NewCredentials()
+	if o.tls != nil {
+		creds = credentials.NewTLS(o.tls)
+	}
+	dialOptions := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, o.dialOptions...)
+	conn, err := grpc.Dial(address, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	return &Client{api: api.NewEventsClient(conn), conn: conn, options: o}, nil
+}
+
+// Wrap returns a client calling the API client, for instance one of a shared connection.
+func Wrap(client api.EventsClient, opts ...Option) *Client {
+	return &Client{api: client, options: newOptions(opts)}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		timeout:    defaultTimeout,
+		attempts:   defaultAttempts,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// API returns the generated client for the calls the client does not cover.
+func (c *Client) API() api.EventsClient {
+	return c.api
+}
+
+// Close closes the connection made by New.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// callContext bounds the call by the timeout and adds the metadata of the client.
+func (c *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok && c.options.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.options.timeout)
+	}
+	if len(c.options.metadata) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, c.options.metadata...)
+	}
+	return ctx, cancel
+}
+
+// invoke makes the call, retrying it while the server is unavailable.
+func (c *Client) invoke(ctx context.Context, call func(ctx context.Context) error) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+	backoff := c.options.backoff
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if err == nil {
+			return nil
+		}
+		if status.Code(err) != codes.Unavailable || attempt >= c.options.attempts {
+			return toError(err)
+		}
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return toError(err)
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > c.options.maxBackoff {
+			backoff = c.options.maxBackoff
+		}
+	}
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// jitter spreads retries of clients which failed at once.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Float64()*backoffJitterFactor*float64(d)) //nolint:gosec
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context making AddEvent send the key, so a call repeated with
+// the same key and event returns the originally created event instead of creating another one.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// AddEvent creates the event, the server generates the ID when it is empty. Retries of the call
+// share an idempotency key, a random one is used unless the context carries WithIdempotencyKey.
+func (c *Client) AddEvent(ctx context.Context, e Event) (Event, error) {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	if key == "" {
+		key = newIdempotencyKey()
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, key)
+	var resp *api.AddEventResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.api.AddEvent(ctx, &api.AddEventRequest{Event: toAPIEvent(e)})
+		return err
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	return fromAPIEvent(resp.GetEvent()), nil
+}
+
+// UpdateEvent replaces the event and returns it with the new version, the fields set by the server,
+// such as UpdatedAt, are read by GetEvent. A non-zero version must match the stored one.
+func (c *Client) UpdateEvent(ctx context.Context, id string, e Event, version int64) (Event, error) {
+	resp, err := c.update(ctx, &api.UpdateEventRequest{Id: id, Event: toAPIEvent(e), Version: version})
+	if err != nil {
+		return Event{}, err
+	}
+	// A full update returns only the version.
+	e.ID, e.Version = id, resp.GetVersion()
+	return e, nil
+}
+
+// PatchEvent updates the fields set in the patch. A non-zero version must match the stored one.
+func (c *Client) PatchEvent(ctx context.Context, id string, patch EventPatch, version int64) (Event, error) {
+	e, mask := toAPIPatch(patch)
+	if len(mask.Paths) == 0 {
+		// An empty mask would replace the whole event.
+		return Event{}, fmt.Errorf("%w: no fields to update", ErrInvalidPatch)
+	}
+	resp, err := c.update(ctx, &api.UpdateEventRequest{Id: id, Event: e, Version: version, UpdateMask: mask})
+	if err != nil {
+		return Event{}, err
+	}
+	return fromAPIEvent(resp.GetEvent()), nil
+}
+
+func (c *Client) update(ctx context.Context, r *api.UpdateEventRequest) (*api.UpdateEventResponse, error) {
+	var resp *api.UpdateEventResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.api.UpdateEvent(ctx, r)
+		return err
+	})
+	return resp, err
+}
+
+// RemoveEvent moves the event to the trash. A non-zero version must match the stored one.
+func (c *Client) RemoveEvent(ctx context.Context, id string, version int64) error {
+	return c.invoke(ctx, func(ctx context.Context) error {
+		_, err := c.api.RemoveEvent(ctx, &api.RemoveEventRequest{Id: id, Version: version})
+		return err
+	})
+}
+
+// UploadAttachment attaches the content read from r to the event. An empty content type is
+// detected by the server. The call is not retried since the content can't be read again.
+func (c *Client) UploadAttachment(
+	ctx context.Context,
+	eventID, name, contentType string,
+	r io.Reader,
+) (Attachment, error) {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+	stream, err := c.api.UploadAttachment(ctx)
+	if err != nil {
+		return Attachment{}, toError(err)
+	}
+	info := &api.AttachmentInfo{EventId: eventID, Name: name, ContentType: contentType}
+	err = stream.Send(&api.UploadAttachmentRequest{Payload: &api.UploadAttachmentRequest_Info{Info: info}})
+	buf := make([]byte, attachmentChunkSize)
+	for err == nil {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			chunk := &api.UploadAttachmentRequest_Chunk{Chunk: buf[:n]}
+			err = stream.Send(&api.UploadAttachmentRequest{Payload: chunk})
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return Attachment{}, fmt.Errorf("failed to read attachment: %w", readErr)
+		}
+	}
+	// A failed send means the server ended the call, the status is returned by CloseAndRecv.
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return Attachment{}, toError(err)
+	}
+	return fromAPIAttachment(resp.GetAttachment()), nil
+}
+
+func (c *Client) GetEvent(ctx context.Context, id string) (Event, error) {
+	return c.getEvent(ctx, func(ctx context.Context) (*api.GetEventResponse, error) {
+		return c.api.GetEvent(ctx, &api.GetEventRequest{Id: id})
+	})
+}
+
+// RestoreEvent moves the event back from the trash.
+func (c *Client) RestoreEvent(ctx context.Context, id string) (Event, error) {
+	return c.getEvent(ctx, func(ctx context.Context) (*api.GetEventResponse, error) {
+		return c.api.RestoreEvent(ctx, &api.RestoreEventRequest{Id: id})
+	})
+}
+
+func (c *Client) getEvent(
+	ctx context.Context,
+	call func(ctx context.Context) (*api.GetEventResponse, error),
+) (Event, error) {
+	var resp *api.GetEventResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = call(ctx)
+		return err
+	})
+	if err != nil {
+		return Event{}, err
+	}
+	return fromAPIEvent(resp.GetEvent()), nil
+}
+
+// ListTrash returns removed events of the owner, an empty owner lists the events of all owners.
+func (c *Client) ListTrash(ctx context.Context, ownerID string) ([]Event, error) {
+	return c.getEvents(ctx, func(ctx context.Context) (*api.GetEventsResponse, error) {
+		return c.api.ListTrash(ctx, &api.ListTrashRequest{OwnerId: ownerID})
+	})
+}
+
+func (c *Client) GetEventsForDay(ctx context.Context, date time.Time, tags ...string) ([]Event, error) {
+	return c.getEvents(ctx, func(ctx context.Context) (*api.GetEventsResponse, error) {
+		return c.api.GetEventsForDay(ctx, &api.GetEventsRequest{StartDate: timestamppb.New(date), Tags: tags})
+	})
+}
+
+// GetEventsForWeek returns events of the week, the date must be the first day of the week.
+func (c *Client) GetEventsForWeek(ctx context.Context, startDate time.Time, tags ...string) ([]Event, error) {
+	return c.getEvents(ctx, func(ctx context.Context) (*api.GetEventsResponse, error) {
+		return c.api.GetEventsForWeek(ctx, &api.GetEventsRequest{StartDate: timestamppb.New(startDate), Tags: tags})
+	})
+}
+
+// GetEventsForMonth returns events of the month, the date must be the first day of the month.
+func (c *Client) GetEventsForMonth(ctx context.Context, startDate time.Time, tags ...string) ([]Event, error) {
+	return c.getEvents(ctx, func(ctx context.Context) (*api.GetEventsResponse, error) {
+		return c.api.GetEventsForMonth(ctx, &api.GetEventsRequest{StartDate: timestamppb.New(startDate), Tags: tags})
+	})
+}
+
+// GetTagStats counts events of the owner per tag, the most used tags go first.
+// An empty owner counts events of all owners.
+func (c *Client) GetTagStats(ctx context.Context, ownerID string) ([]TagCount, error) {
+	var resp *api.TagStatsResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.api.GetTagStats(ctx, &api.GetTagStatsRequest{OwnerId: ownerID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]TagCount, 0, len(resp.GetStats()))
+	for _, stat := range resp.GetStats() {
+		stats = append(stats, TagCount{Tag: stat.GetTag(), Count: int(stat.GetCount())})
+	}
+	return stats, nil
+}
+
+// SearchEvents returns up to limit events matching the query, the most relevant go first. The query
+// matches words, "quoted phrases" and prefix* words, an empty owner searches events of all owners
+// and zero limit means the server default.
+func (c *Client) SearchEvents(ctx context.Context, query, ownerID string, limit int) ([]SearchResult, error) {
+	var resp *api.SearchEventsResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.api.SearchEvents(ctx, &api.SearchEventsRequest{Query: query, OwnerId: ownerID, Limit: int32(limit)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0, len(resp.GetResults()))
+	for _, result := range resp.GetResults() {
+		results = append(results, SearchResult{Event: fromAPIEvent(result.GetEvent()), Rank: result.GetRank()})
+	}
+	return results, nil
+}
+
+// QuickAddEvent creates the event of the owner described by the text, like "Lunch with Anna tomorrow
+// 13:00-14:00 remind 1d". Dates and times are taken in the IANA time zone, empty means UTC.
+func (c *Client) QuickAddEvent(ctx context.Context, text, ownerID, timeZone string) (Event, error) {
+	return c.getEvent(ctx, func(ctx context.Context) (*api.GetEventResponse, error) {
+		return c.api.QuickAddEvent(ctx, &api.QuickAddEventRequest{Text: text, OwnerId: ownerID, TimeZone: timeZone})
+	})
+}
+
+func (c *Client) getEvents(
+	ctx context.Context,
+	call func(ctx context.Context) (*api.GetEventsResponse, error),
+) ([]Event, error) {
+	var resp *api.GetEventsResponse
+	err := c.invoke(ctx, func(ctx context.Context) (err error) {
+		resp, err = call(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(resp.GetEvents()))
+	for _, e := range resp.GetEvents() {
+		events = append(events, fromAPIEvent(e))
+	}
+	return events, nil
+}
+
+func toAPIEvent(e Event) *api.Event {
+	return &api.Event{
+		Id:            e.ID,
+		Title:         e.Title,
+		StartTime:     timestamppb.New(e.StartTime),
+		EndTime:       timestamppb.New(e.EndTime),
+		Description:   e.Description,
+		OwnerId:       e.OwnerID,
+		NotifyBefore:  e.NotifyBefore,
+		Version:       e.Version,
+		Tags:          e.Tags,
+		Color:         e.Color,
+		Location:      toAPILocation(e.Location),
+		ConferenceUrl: e.ConferenceURL,
+		AllDay:        e.AllDay,
+	}
+}
+
+func toAPILocation(l Location) *api.Location {
+	location := &api.Location{Name: l.Name}
+	if l.Geo != nil {
+		location.Geo = &api.GeoPoint{Latitude: l.Geo.Latitude, Longitude: l.Geo.Longitude}
+	}
+	return location
+}
+
+func toAPIPatch(patch EventPatch) (*api.Event, *fieldmaskpb.FieldMask) {
+	e := &api.Event{}
+	mask := &fieldmaskpb.FieldMask{}
+	if patch.Title != nil {
+		e.Title = *patch.Title
+		mask.Paths = append(mask.Paths, "title")
+	}
+	if patch.StartTime != nil {
+		e.StartTime = timestamppb.New(*patch.StartTime)
+		mask.Paths = append(mask.Paths, "startTime")
+	}
+	if patch.EndTime != nil {
+		e.EndTime = timestamppb.New(*patch.EndTime)
+		mask.Paths = append(mask.Paths, "endTime")
+	}
+	if patch.Description != nil {
+		e.Description = *patch.Description
+		mask.Paths = append(mask.Paths, "description")
+	}
+	if patch.OwnerID != nil {
+		e.OwnerId = *patch.OwnerID
+		mask.Paths = append(mask.Paths, "ownerId")
+	}
+	if patch.NotifyBefore != nil {
+		e.NotifyBefore = *patch.NotifyBefore
+		mask.Paths = append(mask.Paths, "notifyBefore")
+	}
+	if patch.Tags != nil {
+		e.Tags = *patch.Tags
+		mask.Paths = append(mask.Paths, "tags")
+	}
+	if patch.Color != nil {
+		e.Color = *patch.Color
+		mask.Paths = append(mask.Paths, "color")
+	}
+	if patch.Location != nil {
+		e.Location = toAPILocation(*patch.Location)
+		mask.Paths = append(mask.Paths, "location")
+	}
+	if patch.ConferenceURL != nil {
+		e.ConferenceUrl = *patch.ConferenceURL
+		mask.Paths = append(mask.Paths, "conferenceUrl")
+	}
+	if patch.AllDay != nil {
+		e.AllDay = *patch.AllDay
+		mask.Paths = append(mask.Paths, "allDay")
+	}
+	return e, mask
+}
+
+func fromAPIEvent(e *api.Event) Event {
+	event := Event{
+		ID:            e.GetId(),
+		Title:         e.GetTitle(),
+		StartTime:     e.GetStartTime().AsTime(),
+		EndTime:       e.GetEndTime().AsTime(),
+		Description:   e.GetDescription(),
+		OwnerID:       e.GetOwnerId(),
+		NotifyBefore:  e.GetNotifyBefore(),
+		Version:       e.GetVersion(),
+		UpdatedAt:     e.GetUpdatedAt().AsTime(),
+		Tags:          e.GetTags(),
+		Color:         e.GetColor(),
+		Location:      Location{Name: e.GetLocation().GetName()},
+		ConferenceURL: e.GetConferenceUrl(),
+		AllDay:        e.GetAllDay(),
+	}
+	if geo := e.GetLocation().GetGeo(); geo != nil {
+		event.Location.Geo = &GeoPoint{Latitude: geo.GetLatitude(), Longitude: geo.GetLongitude()}
+	}
+	if e.GetDeletedAt() != nil {
+		deletedAt := e.GetDeletedAt().AsTime()
+		event.DeletedAt = &deletedAt
+	}
+	for _, a := range e.GetAttachments() {
+		event.Attachments = append(event.Attachments, fromAPIAttachment(a))
+	}
+	return event
+}
+
+func fromAPIAttachment(a *api.Attachment) Attachment {
+	return Attachment{
+		ID:          a.GetId(),
+		Name:        a.GetName(),
+		ContentType: a.GetContentType(),
+		Size:        a.GetSize(),
+		CreatedAt:   a.GetCreatedAt().AsTime(),
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/api"
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/app"
+	internalgrpc "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/server/grpc"
+	memorystorage "github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	lsn := bufconn.Listen(1 << 20)
+	server := internalgrpc.NewServer(internalgrpc.Config{}, app.New(memorystorage.New()), nil)
+	go server.Serve(lsn)
+	t.Cleanup(func() { server.Stop(context.Background()) })
+
+	c, err := New("bufnet", WithUserID("alice"), WithDialOptions(
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lsn.DialContext(ctx)
+		}),
+	))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	event, err := c.AddEvent(ctx, Event{
+		ID: "1", Title: "Standup", StartTime: start, EndTime: start.Add(time.Hour), OwnerID: "alice",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Standup", event.Title)
+	require.Equal(t, start, event.StartTime)
+	require.Equal(t, int64(1), event.Version)
+
+	_, err = c.AddEvent(ctx, event)
+	require.ErrorIs(t, err, ErrDuplicateEventID)
+
+	title := "Daily standup"
+	event, err = c.PatchEvent(ctx, "1", EventPatch{Title: &title}, event.Version)
+	require.NoError(t, err)
+	require.Equal(t, title, event.Title)
+	require.Equal(t, start, event.StartTime)
+
+	_, err = c.PatchEvent(ctx, "1", EventPatch{Title: &title}, 1)
+	require.ErrorIs(t, err, ErrVersionConflict)
+
+	event.Description = "Daily sync"
+	event, err = c.UpdateEvent(ctx, "1", event, event.Version)
+	require.NoError(t, err)
+	require.Equal(t, "1", event.ID)
+	require.Equal(t, int64(3), event.Version)
+	require.Equal(t, "Daily sync", event.Description)
+	require.Equal(t, start, event.StartTime)
+	stored, err := c.GetEvent(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, event.Version, stored.Version)
+	require.Equal(t, event.Description, stored.Description)
+	_, err = c.UpdateEvent(ctx, "1", event, 1)
+	require.ErrorIs(t, err, ErrVersionConflict)
+	_, err = c.PatchEvent(ctx, "1", EventPatch{}, 0)
+	require.ErrorIs(t, err, ErrInvalidPatch)
+
+	events, err := c.GetEventsForDay(ctx, start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	require.NoError(t, c.RemoveEvent(ctx, "1", 0))
+	_, err = c.GetEvent(ctx, "1")
+	require.ErrorIs(t, err, ErrNotFoundEvent)
+	var callErr *Error
+	require.True(t, errors.As(err, &callErr))
+	require.Equal(t, codes.NotFound, callErr.Code)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	trash, err := c.ListTrash(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.NotNil(t, trash[0].DeletedAt)
+
+	event, err = c.RestoreEvent(ctx, "1")
+	require.NoError(t, err)
+	require.Nil(t, event.DeletedAt)
+}
+
+func TestClientAttributes(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	start := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	event, err := c.AddEvent(ctx, Event{
+		Title: "On-call", StartTime: start, EndTime: start.Add(time.Hour), OwnerID: "alice",
+		Tags:     []string{"ops", "on-call"},
+		Location: Location{Name: "Room 1", Geo: &GeoPoint{Latitude: 55.75, Longitude: 37.62}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"on-call", "ops"}, event.Tags)
+	require.Equal(t, 55.75, event.Location.Geo.Latitude)
+
+	color := "#ff8800"
+	event, err = c.PatchEvent(ctx, event.ID, EventPatch{Color: &color, Location: &Location{Name: "Room 2"}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, color, event.Color)
+	require.Equal(t, Location{Name: "Room 2"}, event.Location)
+
+	events, err := c.GetEventsForDay(ctx, start, "ops")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	events, err = c.GetEventsForDay(ctx, start, "ops", "other")
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	stats, err := c.GetTagStats(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{Tag: "on-call", Count: 1}, {Tag: "ops", Count: 1}}, stats)
+
+	results, err := c.SearchEvents(ctx, "on-call", "alice", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, event.ID, results[0].Event.ID)
+	_, err = c.SearchEvents(ctx, "", "", 0)
+	var callErr *Error
+	require.ErrorAs(t, err, &callErr)
+	require.Equal(t, codes.InvalidArgument, callErr.Code)
+
+	quick, err := c.QuickAddEvent(ctx, "Standup tomorrow 9:30 for 15m", "alice", "UTC")
+	require.NoError(t, err)
+	require.NotEmpty(t, quick.ID)
+	require.Equal(t, "Standup", quick.Title)
+	require.Equal(t, 15*time.Minute, quick.EndTime.Sub(quick.StartTime))
+	_, err = c.QuickAddEvent(ctx, "Standup", "alice", "")
+	require.ErrorAs(t, err, &callErr)
+	require.Equal(t, codes.InvalidArgument, callErr.Code)
+}
+
+// flakyEvents fails the calls with Unavailable until the given number of failures is reached.
+type flakyEvents struct {
+	api.EventsClient
+	failures int
+	calls    int
+}
+
+func (f *flakyEvents) GetEvent(context.Context, *api.GetEventRequest, ...grpc.CallOption) (*api.GetEventResponse, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return &api.GetEventResponse{Event: &api.Event{Id: "1"}}, nil
+}
+
+func TestClientRetry(t *testing.T) {
+	ctx := context.Background()
+
+	flaky := &flakyEvents{failures: 2}
+	event, err := Wrap(flaky, WithRetry(3, time.Millisecond)).GetEvent(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "1", event.ID)
+	require.Equal(t, 3, flaky.calls)
+
+	flaky = &flakyEvents{failures: 3}
+	_, err = Wrap(flaky, WithRetry(3, time.Millisecond)).GetEvent(ctx, "1")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 3, flaky.calls)
+
+	flaky = &flakyEvents{failures: 10}
+	_, err = Wrap(flaky, WithRetry(10, time.Hour), WithTimeout(10*time.Millisecond)).GetEvent(ctx, "1")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 1, flaky.calls)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexjurev/hw-otus/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors of the storage are matched by errors.Is on the errors of the calls.
+var (
+	ErrNotFoundEvent    = storage.ErrNotFoundEvent
+	ErrDuplicateEventID = storage.ErrDuplicateEventID
+	ErrVersionConflict  = storage.ErrVersionConflict
+	ErrInvalidPatch     = storage.ErrInvalidPatch
+	// ErrIdempotencyKeyReused is returned when the idempotency key was used for another event.
+	ErrIdempotencyKeyReused = storage.ErrIdempotencyKeyReused
+)
+
+// Error is a failed call. It wraps the storage error the status code stands for,
+// deadline and cancellation codes wrap the errors of the context.
+type Error struct {
+	Code    codes.Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("calendar: %s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case codes.NotFound:
+		return ErrNotFoundEvent
+	case codes.AlreadyExists:
+		return ErrDuplicateEventID
+	case codes.Aborted:
+		return ErrVersionConflict
+	case codes.FailedPrecondition:
+		return ErrIdempotencyKeyReused
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Canceled:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+// GRPCStatus keeps the status of the call available to status.FromError.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Message)
+}
+
+func toError(err error) error {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return err
+	}
+	s := grpcErr.GRPCStatus()
+	return &Error{Code: s.Code(), Message: s.Message()}
+}
@@ -396,6 +396,8 @@ func compareEvents(t *testing.T, expected storage.Event, actual storage.Event) {
 		"start time is not equals %q != %q", expected.StartTime, actual.StartTime)
 	expected.StartTime = actual.StartTime
 	expected.EndTime = actual.EndTime
+	expected.Version = actual.Version
+	expected.UpdatedAt = actual.UpdatedAt
 	require.Equal(t, expected, actual)
 }
 